@@ -1,11 +1,19 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	rcvapi "github.com/cnych/promoter/api/receiver"
 	apiv1 "github.com/cnych/promoter/api/v1"
 	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/dedup"
+	"github.com/cnych/promoter/health"
+	"github.com/cnych/promoter/history"
+	"github.com/cnych/promoter/notify"
+	"github.com/cnych/promoter/silence"
 	"github.com/cnych/promoter/template"
 	"github.com/go-kit/log"
 	"github.com/prometheus/common/route"
@@ -14,11 +22,24 @@ import (
 type Options struct {
 	Logger log.Logger
 	Debug  bool
+	// History stores the received notifications, it may be nil.
+	History *history.Store
+	// Dedup suppresses duplicate notifications, it may be nil.
+	Dedup *dedup.Deduplicator
+	// Silences mutes the silenced alerts, it may be nil.
+	Silences *silence.Silences
+	// ReadyCheckDependencies makes /-/ready check the upstream services.
+	ReadyCheckDependencies bool
+	// ReadyCacheTTL is how long the results of /-/ready are reused.
+	ReadyCacheTTL time.Duration
 }
 
 type API struct {
-	v1       *apiv1.API
-	receiver *rcvapi.API
+	v1        *apiv1.API
+	receiver  *rcvapi.API
+	escalator *notify.Escalator
+	health    *health.Checker
+	silences  *silence.Silences
 }
 
 func New(opts Options) *API {
@@ -26,27 +47,101 @@ func New(opts Options) *API {
 	if l == nil {
 		l = log.NewNopLogger()
 	}
-	v1 := apiv1.New(log.With(l, "component", "apiv1"))
-	receiverAPI := rcvapi.New(log.With(l, "component", "receiver"), opts.Debug)
+	// 避免将 nil 指针包装成非 nil 的接口
+	var muter notify.Muter
+	if opts.Silences != nil {
+		muter = opts.Silences
+	}
+	var escalations notify.EscalationStore
+	if opts.History != nil {
+		escalations = opts.History
+	}
+	escalator := notify.NewEscalator(log.With(l, "component", "escalator"), muter, escalations)
+	v1 := apiv1.New(log.With(l, "component", "apiv1"), escalator, opts.History, opts.Silences)
+	receiverAPI := rcvapi.New(log.With(l, "component", "receiver"), opts.Debug, escalator, opts.History, opts.Dedup, muter)
+
+	checker := health.New(health.Options{
+		Dependencies: opts.ReadyCheckDependencies,
+		CacheTTL:     opts.ReadyCacheTTL,
+		History:      opts.History,
+		Logger:       log.With(l, "component", "health"),
+	})
 
 	return &API{
-		v1:       v1,
-		receiver: receiverAPI,
+		v1:        v1,
+		receiver:  receiverAPI,
+		escalator: escalator,
+		health:    checker,
+		silences:  opts.Silences,
 	}
 }
 
 func (api *API) Register(r *route.Router) *http.ServeMux {
-	api.v1.Register(r.WithPrefix("/api/v1"))
+	// v1 使用单独的路由，避免 POST /api/v1/... 与 POST /:name/send 在 httprouter 中冲突
+	v1 := route.New()
+	api.v1.Register(v1.WithPrefix("/api/v1"))
 	api.receiver.Register(r)
+	r.Get("/-/healthy", api.healthy)
+	r.Get("/-/ready", api.ready)
 
 	mux := http.NewServeMux()
+	mux.Handle("/api/v1/", v1)
 	mux.Handle("/", r)
 
 	return mux
 }
 
-// Update updates the config field of the API struct
-func (api *API) Update(conf *config.Config, tmpl *template.Template) {
-	api.v1.Update(conf)
-	api.receiver.Update(conf, tmpl)
+// healthy always succeeds while the process serves requests.
+func (api *API) healthy(w http.ResponseWriter, req *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "OK")
+}
+
+// ready reports the result of every dependency check, it fails until the
+// configuration is loaded or while any check fails.
+func (api *API) ready(w http.ResponseWriter, req *http.Request) {
+	ok, checks := api.health.Check()
+
+	var resp = struct {
+		Status string                   `json:"status"`
+		Checks map[string]health.Result `json:"checks,omitempty"`
+	}{
+		Status: "ready",
+		Checks: checks,
+	}
+	code := http.StatusOK
+	if !ok {
+		resp.Status = "not ready"
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Run runs the background tasks of the API until stop is closed.
+func (api *API) Run(stop <-chan struct{}) {
+	api.escalator.Run(stop)
+}
+
+// Flush sends the notifications buffered by the aggregation windows of the
+// receivers, it is called before exiting.
+func (api *API) Flush() {
+	api.receiver.Flush()
+}
+
+// Update updates the config field of the API struct. The receiver API is
+// updated first, if it rejects the configuration nothing is changed.
+func (api *API) Update(conf *config.Config, tmpl *template.Template) error {
+	if err := api.receiver.Update(conf, tmpl); err != nil {
+		return err
+	}
+	api.v1.Update(conf, tmpl)
+	api.health.Update(conf, api.receiver.Integrations())
+	if api.silences != nil {
+		api.silences.Update(conf)
+	}
+	return nil
 }
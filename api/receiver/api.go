@@ -2,124 +2,415 @@ package receiver
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/dedup"
+	"github.com/cnych/promoter/history"
 	"github.com/cnych/promoter/notify"
-	"github.com/cnych/promoter/notify/dingtalk"
-	"github.com/cnych/promoter/notify/wechat"
+	"github.com/cnych/promoter/notify/receivers"
 	"github.com/cnych/promoter/template"
 	"github.com/cnych/promoter/util"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/route"
 )
 
+// suppressedCheckTimeout bounds querying Alertmanager for suppressed alerts.
+const suppressedCheckTimeout = 10 * time.Second
+
 type API struct {
+	// mtx guards the fields replaced by Update on SIGHUP reload, handlers
+	// read them under RLock and use the snapshot.
 	mtx sync.RWMutex
 
 	config            *config.Config
 	tmpl              *template.Template
-	receiverNotifiers map[string][]ReceiveNotifier
+	receiverNotifiers map[string][]notify.Integration
+	ingesters         map[string]*notify.Ingester
+	imager            *notify.Imager
+	directory         *notify.Directory
+	linker            *notify.ActionLinker
+	alertmanager      *notify.Alertmanager
+	escalator         *notify.Escalator
+	aggregator        *notify.Aggregator
+	dedup             *dedup.Deduplicator
+	muter             notify.Muter
+	history           *history.Store
 	logger            log.Logger
 	debug             bool
 }
 
-type ReceiveNotifier struct {
-	receiver *config.Receiver
-	notifier notify.Notifier
+func New(logger log.Logger, debug bool, escalator *notify.Escalator, history *history.Store, dedup *dedup.Deduplicator, muter notify.Muter) *API {
+	api := &API{
+		logger:    logger,
+		debug:     debug,
+		escalator: escalator,
+		history:   history,
+		dedup:     dedup,
+		muter:     muter,
+	}
+	api.aggregator = notify.NewAggregator(logger, func(receiver string, data *notify.Data) {
+		api.dispatch(context.Background(), log.With(logger, "receiver", receiver), receiver, data)
+	})
+	return api
 }
 
-func New(logger log.Logger, debug bool) *API {
-	return &API{
-		logger: logger,
-		debug:  debug,
-	}
+// Integrations returns the integrations of every receiver.
+func (api *API) Integrations() map[string][]notify.Integration {
+	api.mtx.RLock()
+	defer api.mtx.RUnlock()
+
+	return api.receiverNotifiers
+}
+
+// Flush sends the notifications buffered by the aggregation windows.
+func (api *API) Flush() {
+	api.aggregator.Flush()
 }
 
 func (api *API) Register(r *route.Router) {
 	r.Post("/:name/send", api.serveReceiver)
+	r.Post("/:name/ingest", api.serveIngest)
 }
 
 func (api *API) serveReceiver(w http.ResponseWriter, r *http.Request) {
 	receiverName := route.Param(r.Context(), "name")
 	logger := log.With(api.logger, "receiver", receiverName)
 
+	api.mtx.RLock()
+	conf := api.config
+	api.mtx.RUnlock()
+
+	rcv := conf.GetReceiver(receiverName)
+	if rcv == nil {
+		level.Warn(logger).Log("msg", "receiver not found")
+		http.NotFound(w, r)
+		return
+	}
+
+	body, ok := api.readBody(w, r, logger)
+	if !ok {
+		return
+	}
+
+	// 支持 Alertmanager webhook、Alertmanager API v2 和 Grafana 的报警格式
+	data, format, err := notify.DecodePayload(body, rcv.PayloadFormat)
+	if err != nil {
+		level.Error(logger).Log("msg", "Cannot decode alert payload", "format", format, "err", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	level.Debug(logger).Log("msg", "Decoded alert payload", "format", format, "alerts", len(data.Alerts))
+
+	api.notify(w, r, logger, receiverName, data)
+}
+
+// serveIngest converts an arbitrary JSON payload to alerts with the ingest
+// configuration of the receiver.
+func (api *API) serveIngest(w http.ResponseWriter, r *http.Request) {
+	receiverName := route.Param(r.Context(), "name")
+	logger := log.With(api.logger, "receiver", receiverName)
+
+	api.mtx.RLock()
+	ingester := api.ingesters[receiverName]
+	api.mtx.RUnlock()
+
+	if ingester == nil {
+		level.Warn(logger).Log("msg", "receiver not found or no ingest configured")
+		http.NotFound(w, r)
+		return
+	}
+
+	body, ok := api.readBody(w, r, logger)
+	if !ok {
+		return
+	}
+
+	data, err := ingester.Decode(body, time.Now())
+	if err != nil {
+		level.Error(logger).Log("msg", "Cannot map ingested payload to alerts", "err", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	level.Debug(logger).Log("msg", "Ingested payload", "alerts", len(data.Alerts))
+
+	api.notify(w, r, logger, receiverName, data)
+}
+
+func (api *API) readBody(w http.ResponseWriter, r *http.Request, logger log.Logger) ([]byte, bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		level.Error(logger).Log("msg", "Cannot read request body", "err", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, false
+	}
+	if api.debug {
+		level.Debug(logger).Log("msg", "Received payload", "payload", string(body))
+	}
+	return body, true
+}
+
+// notify sends the notification right away, or buffers it when the receiver
+// has an aggregation window.
+func (api *API) notify(w http.ResponseWriter, r *http.Request, logger log.Logger, receiverName string, data *notify.Data) {
+	api.mtx.RLock()
+	conf := api.config
 	receiverNotifiers := api.receiverNotifiers[receiverName]
+	api.mtx.RUnlock()
+
 	if len(receiverNotifiers) == 0 {
 		level.Warn(logger).Log("msg", "receiver not found")
 		http.NotFound(w, r)
 		return
 	}
 
-	var data notify.Data
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		level.Error(logger).Log("msg", "Cannot decode prometheus webhook JSON request", "err", err)
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+	if data.Receiver == "" {
+		data.Receiver = receiverName
+	}
+
+	// 在聚合窗口内缓存通知，窗口结束后合并为一条消息发送
+	if window := time.Duration(conf.GetReceiver(receiverName).AggregationWindow); window > 0 {
+		api.aggregator.Add(receiverName, window, data)
+		io.WriteString(w, "OK")
 		return
 	}
 
-	// 生成监控图片
-	if err := data.MakeAlertImages(logger, api.config); err != nil {
-		level.Error(logger).Log("msg", "Cannot make alert images", "err", err)
+	if err := api.dispatch(r.Context(), logger, receiverName, data); err != nil {
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
+	io.WriteString(w, "OK")
+}
+
+// dispatch makes the images of the notification, sends it through every
+// notifier of the receiver and records it in the history.
+func (api *API) dispatch(ctx context.Context, logger log.Logger, receiverName string, data *notify.Data) error {
+	api.mtx.RLock()
+	conf, imager, directory, linker, am := api.config, api.imager, api.directory, api.linker, api.alertmanager
+	receiverNotifiers := api.receiverNotifiers[receiverName]
+	api.mtx.RUnlock()
+
+	// 配置重新加载后接收器可能已经被删除
+	if len(receiverNotifiers) == 0 {
+		level.Warn(logger).Log("msg", "receiver not found, dropping notification", "alerts", len(data.Alerts))
+		return fmt.Errorf("receiver %q not found", receiverName)
+	}
+
+	// 丢弃被静默或处于维护窗口内的报警，升级策略仍然跟踪这些报警的状态，
+	// 以便恢复后不再升级
+	if api.muter != nil {
+		now := time.Now()
+		mutes := func(a notify.Alert) bool { return api.muter.Mutes(receiverName, a, now) }
+		if muted := data.Filter(mutes); muted != nil {
+			api.escalator.Observe(receiverName, muted)
+			level.Info(logger).Log("msg", "Dropping silenced alerts", "muted", len(muted.Alerts), "alerts", len(data.Alerts))
+		}
+		data = data.Filter(func(a notify.Alert) bool { return !mutes(a) })
+		if data == nil {
+			return nil
+		}
+	}
+
+	// 通知可能在聚合窗口或 Alertmanager 的 group_wait 期间被静默，发送前再确认一次
+	if am != nil {
+		if data = api.dropSuppressed(ctx, logger, am, data); data == nil {
+			return nil
+		}
+	}
+
+	// 抑制去重间隔内已经发送过的相同通知，发送失败时取消记录以便重试
+	var release func()
+	if interval := time.Duration(conf.GetReceiver(receiverName).DedupInterval); interval > 0 && api.dedup != nil {
+		var send bool
+		if send, release = api.dedup.Claim(receiverName, data, interval); !send {
+			level.Info(logger).Log("msg", "Duplicate notification suppressed", "alerts", len(data.Alerts))
+			return nil
+		}
+	}
+
+	if api.history != nil {
+		api.attachAcks(logger, receiverName, data)
+	}
+	data.Actions = linker.Links(data, time.Now())
+	data.ResolveMentions(directory)
+
+	// 生成监控图片，部分图片生成失败时仍然发送已经生成的图片
+	if imager != nil {
+		if err := data.MakeAlertImages(ctx, logger, imager, conf.GetReceiver(receiverName).ImageProvider); err != nil {
+			level.Error(logger).Log("msg", "Cannot make alert images", "err", err)
+		}
+	}
+
+	// 记录仍在报警的告警，超时未恢复时按升级策略再次通知
+	api.escalator.Observe(receiverName, data)
+
 	errs := &util.MultiError{}
+	record := &history.Notification{
+		Receiver:   receiverName,
+		ReceivedAt: time.Now(),
+		Data:       data,
+		Deliveries: []history.Delivery{},
+	}
 
-	for _, rn := range receiverNotifiers {
-		if _, err := rn.notifier.Notify(context.Background(), &data); err != nil {
+	for _, integration := range receiverNotifiers {
+		delivery := history.Delivery{Integration: integration.String()}
+
+		// 每个通知只发送匹配其过滤条件的报警，没有剩余报警时跳过
+		filtered := integration.Filter(data)
+		if filtered == nil {
+			level.Debug(logger).Log("msg", "No alerts left after filtering, skip notifier", "integration", integration)
+			delivery.Skipped = true
+			record.Deliveries = append(record.Deliveries, delivery)
+			continue
+		}
+		if api.history != nil {
+			if r, ok := integration.Notifier.(notify.Renderer); ok {
+				delivery.Fields, _ = r.Render(filtered)
+			}
+		}
+		if _, err := integration.Notify(context.Background(), filtered); err != nil {
 			errs.Add(err)
+			delivery.Error = err.Error()
+		}
+		record.Deliveries = append(record.Deliveries, delivery)
+	}
+
+	if api.history != nil {
+		if err := api.history.Add(record); err != nil {
+			level.Error(logger).Log("msg", "Cannot store notification history", "err", err)
 		}
 	}
 
 	if errs.Len() > 0 {
 		level.Error(logger).Log("msg", "Send receiver notify failed", "err", errs)
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		if release != nil {
+			release()
+		}
+		return errs
+	}
+	return nil
+}
+
+// dropSuppressed removes the firing alerts silenced or inhibited in
+// Alertmanager, it returns nil if no alert is left. The notification is sent
+// unchanged if Alertmanager cannot be queried.
+func (api *API) dropSuppressed(ctx context.Context, logger log.Logger, am *notify.Alertmanager, data *notify.Data) *notify.Data {
+	firing := notify.Alerts(data.Alerts.Firing())
+	if len(firing) == 0 {
+		return data
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, suppressedCheckTimeout)
+	defer cancel()
+	suppressed, err := am.SuppressedAlerts(ctx, firing)
+	if err != nil {
+		level.Warn(logger).Log("msg", "Cannot query suppressed alerts, sending notification", "err", err)
+		return data
+	}
+
+	kept := data.Filter(func(a notify.Alert) bool {
+		return a.Status != string(model.AlertFiring) || !suppressed[a.LabelsFingerprint()]
+	})
+	if n := len(data.Alerts); kept == nil || len(kept.Alerts) < n {
+		dropped := n
+		if kept != nil {
+			dropped -= len(kept.Alerts)
+		}
+		level.Info(logger).Log("msg", "Dropping alerts suppressed in Alertmanager", "suppressed", dropped, "alerts", n)
+	}
+	return kept
+}
+
+// attachAcks sets the acknowledgements of the alerts, those of resolved
+// alerts are deleted after being attached.
+func (api *API) attachAcks(logger log.Logger, receiverName string, data *notify.Data) {
+	fps := make([]string, len(data.Alerts))
+	for i, a := range data.Alerts {
+		fps[i] = a.LabelsFingerprint()
+	}
+	acks, err := api.history.Acks(receiverName, fps)
+	if err != nil {
+		level.Error(logger).Log("msg", "Cannot get acknowledgements", "err", err)
 		return
 	}
 
-	io.WriteString(w, "OK")
+	var resolved []string
+	for i := range data.Alerts {
+		ack, ok := acks[fps[i]]
+		if !ok {
+			continue
+		}
+		data.Alerts[i].Ack = ack
+		if data.Alerts[i].Status == string(model.AlertResolved) {
+			resolved = append(resolved, fps[i])
+		}
+	}
+	if len(resolved) > 0 {
+		if err := api.history.Unack(receiverName, resolved); err != nil {
+			level.Error(logger).Log("msg", "Cannot delete acknowledgements", "err", err)
+		}
+	}
 }
 
-func (api *API) Update(conf *config.Config, tmpl *template.Template) {
+// Update replaces the configuration of the API. It fails without changing
+// anything if the imager of the configuration cannot be created, so that a
+// reload never keeps running with the datasources of the previous one.
+func (api *API) Update(conf *config.Config, tmpl *template.Template) error {
+	imager, err := notify.NewImager(conf)
+	if err != nil {
+		return fmt.Errorf("init imager: %v", err)
+	}
+
 	api.mtx.Lock()
 	defer api.mtx.Unlock()
 
 	api.config = conf
 	api.tmpl = tmpl
+	api.imager = imager
+	api.directory = notify.NewDirectory(conf)
+	api.linker = notify.NewActionLinker(conf.Actions, tmpl.ExternalURL)
+
+	api.alertmanager = nil
+	if conf.Alertmanager != nil && conf.Alertmanager.CheckSuppressed {
+		am, err := notify.NewAlertmanager(conf.Alertmanager)
+		if err != nil {
+			level.Error(api.logger).Log("msg", "Init Alertmanager client", "err", err)
+		}
+		api.alertmanager = am
+	}
 
 	// 将 Receivers 映射成 map，获取每个接收器的 notifier
-	var receiverNotifier = make(map[string][]ReceiveNotifier)
+	var receiverNotifier = make(map[string][]notify.Integration)
 	for _, rcv := range api.config.Receivers {
-		var receiverNotifiers []ReceiveNotifier
-		for _, dtc := range rcv.DingtalkConfigs {
-			notifier, err := dingtalk.New(dtc, api.tmpl, api.logger)
-			if err != nil {
-				level.Error(api.logger).Log("msg", "Init dingtalk notifier", "err", err)
-				continue
-			}
-			receiverNotifiers = append(receiverNotifiers, ReceiveNotifier{
-				receiver: rcv,
-				notifier: notifier,
-			})
-		}
-		for _, wcc := range rcv.WechatConfigs {
-			notifier, err := wechat.New(wcc, api.tmpl, api.logger)
-			if err != nil {
-				level.Error(api.logger).Log("msg", "Init wechat notifier", "err", err)
-				continue
-			}
-			receiverNotifiers = append(receiverNotifiers, ReceiveNotifier{
-				receiver: rcv,
-				notifier: notifier,
-			})
+		integrations, err := receivers.BuildIntegrations(rcv, api.tmpl, api.logger)
+		if err != nil {
+			level.Error(api.logger).Log("msg", "Init receiver notifiers", "receiver", rcv.Name, "err", err)
 		}
-		receiverNotifier[rcv.Name] = receiverNotifiers
+		receiverNotifier[rcv.Name] = integrations
 	}
 	api.receiverNotifiers = receiverNotifier
+
+	ingesters := make(map[string]*notify.Ingester)
+	for _, rcv := range api.config.Receivers {
+		if rcv.Ingest == nil {
+			continue
+		}
+		ingester, err := notify.NewIngester(rcv.Ingest)
+		if err != nil {
+			level.Error(api.logger).Log("msg", "Init receiver ingest", "receiver", rcv.Name, "err", err)
+			continue
+		}
+		ingesters[rcv.Name] = ingester
+	}
+	api.ingesters = ingesters
+	api.escalator.Update(conf, api.directory, api.linker, receiverNotifier)
+	return nil
 }
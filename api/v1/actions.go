@@ -0,0 +1,219 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cnych/promoter/labels"
+	"github.com/cnych/promoter/notify"
+	"github.com/cnych/promoter/silence"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/route"
+)
+
+// actionTimeout bounds creating a silence in Alertmanager.
+const actionTimeout = 30 * time.Second
+
+var actionNames = map[string]string{
+	notify.ActionAck:     "确认报警",
+	notify.ActionSilence: "静默报警",
+}
+
+// actionPage is shown for the links of notifications. GET only shows the
+// form, so that link previews of chat clients do not act on the alerts.
+var actionPage = template.Must(template.New("action").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .Title }} - Promoter</title>
+<style>
+body { font-family: -apple-system, "Helvetica Neue", "PingFang SC", "Microsoft YaHei", sans-serif; margin: 0 auto; max-width: 480px; padding: 16px; color: #333; }
+input, textarea, button { box-sizing: border-box; font-size: 16px; margin: 4px 0 12px; padding: 8px; width: 100%; }
+button { background: #1677ff; border: 0; border-radius: 4px; color: #fff; }
+code { background: #f4f4f4; padding: 2px 4px; }
+.error { color: #cf1322; }
+.success { color: #389e0d; }
+</style>
+</head>
+<body>
+<h2>{{ .Title }}</h2>
+{{ if .Error }}<p class="error">{{ .Error }}</p>
+{{ else if .Result }}<p class="success">{{ .Result }}</p>
+{{ else }}<p>接收器：{{ .Receiver }}</p>
+{{ if .Alerts }}<p>报警数量：{{ .Alerts }}</p>{{ end }}
+{{ if .Matchers }}<p>静默 {{ .Duration }}，匹配：{{ range .Matchers }}<code>{{ . }}</code> {{ end }}</p>{{ end }}
+<form method="post">
+<input type="hidden" name="token" value="{{ .Token }}">
+<label>操作人<input name="by" required></label>
+<label>备注<textarea name="comment" rows="3"></textarea></label>
+<button type="submit">{{ .Title }}</button>
+</form>
+{{ end }}
+</body>
+</html>
+`))
+
+type actionPageData struct {
+	Title    string
+	Token    string
+	Receiver string
+	Alerts   int
+	Matchers []string
+	Duration string
+	Error    string
+	Result   string
+}
+
+func (api *API) actionForm(w http.ResponseWriter, req *http.Request) {
+	page, claims, ok := api.verifyAction(w, req)
+	if !ok {
+		return
+	}
+	page.Token = req.FormValue("token")
+	page.Receiver = claims.Receiver
+	page.Alerts = len(claims.Fingerprints)
+	for _, p := range claims.Labels.SortedPairs() {
+		page.Matchers = append(page.Matchers, fmt.Sprintf("%s=%q", p.Name, p.Value))
+	}
+	if claims.Action == notify.ActionSilence {
+		api.mtx.RLock()
+		page.Duration = api.config.Actions.SilenceDuration.String()
+		api.mtx.RUnlock()
+	}
+	api.renderAction(w, http.StatusOK, page)
+}
+
+func (api *API) takeAction(w http.ResponseWriter, req *http.Request) {
+	page, claims, ok := api.verifyAction(w, req)
+	if !ok {
+		return
+	}
+	by := strings.TrimSpace(req.FormValue("by"))
+	if by == "" {
+		page.Error = "缺少操作人"
+		api.renderAction(w, http.StatusBadRequest, page)
+		return
+	}
+	comment := strings.TrimSpace(req.FormValue("comment"))
+
+	var err error
+	switch claims.Action {
+	case notify.ActionAck:
+		page.Result, err = api.ack(claims, by, comment)
+	case notify.ActionSilence:
+		page.Result, err = api.silence(req.Context(), claims, by, comment)
+	}
+	if err != nil {
+		level.Error(api.logger).Log("msg", "Action failed", "action", claims.Action, "receiver", claims.Receiver, "by", by, "err", err)
+		page.Error = err.Error()
+		api.renderAction(w, http.StatusInternalServerError, page)
+		return
+	}
+	level.Info(api.logger).Log("msg", "Action taken", "action", claims.Action, "receiver", claims.Receiver, "by", by, "result", page.Result)
+	api.renderAction(w, http.StatusOK, page)
+}
+
+// verifyAction checks the token of the request and renders the error page
+// if it is invalid.
+func (api *API) verifyAction(w http.ResponseWriter, req *http.Request) (actionPageData, *notify.ActionClaims, bool) {
+	action := route.Param(req.Context(), "action")
+	page := actionPageData{Title: actionNames[action]}
+	if page.Title == "" {
+		http.NotFound(w, req)
+		return page, nil, false
+	}
+
+	api.mtx.RLock()
+	linker := api.linker
+	api.mtx.RUnlock()
+	if linker == nil {
+		page.Error = "未启用通知操作"
+		api.renderAction(w, http.StatusServiceUnavailable, page)
+		return page, nil, false
+	}
+
+	claims, err := linker.Verify(req.FormValue("token"), time.Now())
+	if err == nil && claims.Action != action {
+		err = notify.ErrInvalidActionToken
+	}
+	switch err {
+	case nil:
+		return page, claims, true
+	case notify.ErrActionTokenExpired:
+		page.Error = "链接已过期"
+	default:
+		page.Error = "链接无效"
+	}
+	api.renderAction(w, http.StatusForbidden, page)
+	return page, nil, false
+}
+
+// ack records the acknowledgement in the history, it is shown in the
+// following notifications of the alerts, and stops their escalation.
+func (api *API) ack(claims *notify.ActionClaims, by, comment string) (string, error) {
+	if api.history == nil {
+		return "", fmt.Errorf("history store is disabled")
+	}
+	ack := notify.Ack{By: by, At: time.Now(), Comment: comment}
+	if err := api.history.Ack(claims.Receiver, claims.Fingerprints, ack); err != nil {
+		return "", err
+	}
+	api.escalator.Ack(claims.Receiver, claims.Fingerprints)
+	return fmt.Sprintf("已确认 %d 个报警", len(claims.Fingerprints)), nil
+}
+
+// silence creates the silence in Alertmanager if it is configured and in
+// Promoter otherwise.
+func (api *API) silence(ctx context.Context, claims *notify.ActionClaims, by, comment string) (string, error) {
+	api.mtx.RLock()
+	am, conf := api.alertmanager, api.config
+	api.mtx.RUnlock()
+
+	if comment == "" {
+		comment = fmt.Sprintf("Silenced from a notification of receiver %s", claims.Receiver)
+	}
+	now := time.Now()
+	endsAt := now.Add(time.Duration(conf.Actions.SilenceDuration))
+
+	if am != nil {
+		ctx, cancel := context.WithTimeout(ctx, actionTimeout)
+		defer cancel()
+		id, err := am.CreateSilence(ctx, notify.AlertmanagerSilence{
+			Matchers:  notify.EqualMatchers(claims.Labels),
+			StartsAt:  now,
+			EndsAt:    endsAt,
+			CreatedBy: by,
+			Comment:   comment,
+		})
+		if err != nil {
+			return "", fmt.Errorf("create Alertmanager silence: %v", err)
+		}
+		return fmt.Sprintf("已在 Alertmanager 中创建静默 %s，持续到 %s", id, endsAt.Format("2006-01-02 15:04")), nil
+	}
+
+	if api.silences == nil {
+		return "", fmt.Errorf("silences are disabled")
+	}
+	s := &silence.Silence{StartsAt: now, EndsAt: endsAt, CreatedBy: by, Comment: comment}
+	for _, p := range claims.Labels.SortedPairs() {
+		s.Matchers = append(s.Matchers, &labels.Matcher{Name: p.Name, Type: labels.MatchEqual, Value: p.Value})
+	}
+	id, err := api.silences.Set(s)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("已创建静默 %s，持续到 %s", id, endsAt.Format("2006-01-02 15:04")), nil
+}
+
+func (api *API) renderAction(w http.ResponseWriter, code int, page actionPageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := actionPage.Execute(w, page); err != nil {
+		level.Error(api.logger).Log("msg", "error rendering action page", "err", err)
+	}
+}
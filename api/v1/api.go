@@ -2,13 +2,24 @@ package v1
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/history"
+	"github.com/cnych/promoter/labels"
+	"github.com/cnych/promoter/notify"
+	"github.com/cnych/promoter/notify/receivers"
+	"github.com/cnych/promoter/oncall"
+	"github.com/cnych/promoter/silence"
+	"github.com/cnych/promoter/template"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/common/version"
 )
@@ -29,20 +40,30 @@ func setCORS(w http.ResponseWriter) {
 }
 
 type API struct {
-	logger log.Logger
-	config *config.Config
+	logger    log.Logger
+	config    *config.Config
+	tmpl      *template.Template
+	escalator *notify.Escalator
+	history   *history.Store
+	silences  *silence.Silences
+
+	linker       *notify.ActionLinker
+	alertmanager *notify.Alertmanager
 
 	uptime time.Time
 	mtx    sync.RWMutex
 }
 
-func New(l log.Logger) *API {
+func New(l log.Logger, escalator *notify.Escalator, history *history.Store, silences *silence.Silences) *API {
 	if l == nil {
 		l = log.NewNopLogger()
 	}
 	return &API{
-		logger: l,
-		uptime: time.Now(),
+		logger:    l,
+		escalator: escalator,
+		history:   history,
+		silences:  silences,
+		uptime:    time.Now(),
 	}
 }
 
@@ -58,17 +79,35 @@ func (api *API) Register(r *route.Router) {
 
 	r.Get("/status", wrap(api.status))
 	r.Get("/receivers", wrap(api.receivers))
-
-	//todo，将报警数据保存
-	//r.Get("/alerts", wrap(api.listAlerts))
-	//r.Post("/alerts", wrap(api.addAlerts))
+	r.Post("/receivers/:name/test", wrap(api.testReceiver))
+	r.Post("/templates/render", wrap(api.renderTemplate))
+	r.Get("/oncall", wrap(api.oncall))
+	r.Get("/alerts", wrap(api.listAlerts))
+	r.Get("/notifications/:id", wrap(api.getNotification))
+	r.Get("/silences", wrap(api.listSilences))
+	r.Post("/silences", wrap(api.setSilence))
+	r.Get("/silences/:id", wrap(api.getSilence))
+	r.Del("/silences/:id", wrap(api.expireSilence))
+	r.Get("/actions/:action", api.actionForm)
+	r.Post("/actions/:action", api.takeAction)
 }
 
-func (api *API) Update(conf *config.Config) {
+func (api *API) Update(conf *config.Config, tmpl *template.Template) {
 	api.mtx.Lock()
 	defer api.mtx.Unlock()
 
 	api.config = conf
+	api.tmpl = tmpl
+	api.linker = notify.NewActionLinker(conf.Actions, tmpl.ExternalURL)
+
+	api.alertmanager = nil
+	if conf.Alertmanager != nil {
+		am, err := notify.NewAlertmanager(conf.Alertmanager)
+		if err != nil {
+			level.Error(api.logger).Log("msg", "Init Alertmanager client", "err", err)
+		}
+		api.alertmanager = am
+	}
 }
 
 func (api *API) receivers(w http.ResponseWriter, req *http.Request) {
@@ -83,6 +122,353 @@ func (api *API) receivers(w http.ResponseWriter, req *http.Request) {
 	api.respond(w, receivers)
 }
 
+func (api *API) testReceiver(w http.ResponseWriter, req *http.Request) {
+	name := route.Param(req.Context(), "name")
+
+	var opts receivers.TestOptions
+	if req.ContentLength != 0 {
+		if err := json.NewDecoder(req.Body).Decode(&opts); err != nil {
+			api.respondError(w, apiError{typ: errorBadData, err: err}, nil)
+			return
+		}
+	}
+	if opts.Status != "" && opts.Status != "firing" && opts.Status != "resolved" {
+		api.respondError(w, apiError{typ: errorBadData, err: fmt.Errorf("invalid status %q", opts.Status)}, nil)
+		return
+	}
+
+	api.mtx.RLock()
+	conf, tmpl := api.config, api.tmpl
+	api.mtx.RUnlock()
+
+	var rcv *config.Receiver
+	for _, r := range conf.Receivers {
+		if r.Name == name {
+			rcv = r
+			break
+		}
+	}
+	if rcv == nil {
+		api.respondError(w, apiError{typ: errorNotFound, err: fmt.Errorf("receiver %q not found", name)}, nil)
+		return
+	}
+
+	var imager *notify.Imager
+	if opts.Plot {
+		var err error
+		if imager, err = notify.NewImager(conf); err != nil {
+			api.respondError(w, apiError{typ: errorInternal, err: err}, nil)
+			return
+		}
+	}
+
+	results, err := receivers.Test(req.Context(), api.logger, rcv, tmpl, notify.NewDirectory(conf), imager, opts)
+	if err != nil {
+		api.respondError(w, apiError{typ: errorInternal, err: err}, results)
+		return
+	}
+	api.respond(w, results)
+}
+
+func (api *API) renderTemplate(w http.ResponseWriter, req *http.Request) {
+	var rr receivers.RenderRequest
+	if err := json.NewDecoder(req.Body).Decode(&rr); err != nil {
+		api.respondError(w, apiError{typ: errorBadData, err: err}, nil)
+		return
+	}
+
+	api.mtx.RLock()
+	conf, tmpl := api.config, api.tmpl
+	api.mtx.RUnlock()
+
+	results, err := receivers.Render(conf, tmpl, api.logger, rr)
+	if err != nil {
+		api.respondError(w, apiError{typ: errorBadData, err: err}, nil)
+		return
+	}
+	api.respond(w, results)
+}
+
+type rotationStatus struct {
+	oncall.Shift
+	Next oncall.Shift `json:"next"`
+}
+
+type scheduleStatus struct {
+	Name      string           `json:"name"`
+	Timezone  string           `json:"timezone"`
+	Rotations []rotationStatus `json:"rotations"`
+}
+
+type escalationStepStatus struct {
+	After   model.Duration `json:"after"`
+	Targets []string       `json:"targets"`
+	// Users are the users the step would notify now.
+	Users []string `json:"users"`
+}
+
+type escalationPolicyStatus struct {
+	Name      string                 `json:"name"`
+	Receivers []string               `json:"receivers"`
+	Steps     []escalationStepStatus `json:"steps"`
+}
+
+func (api *API) oncall(w http.ResponseWriter, req *http.Request) {
+	api.mtx.RLock()
+	conf := api.config
+	api.mtx.RUnlock()
+
+	now := time.Now()
+	directory := notify.NewDirectory(conf)
+
+	var status = struct {
+		Schedules          []scheduleStatus           `json:"schedules"`
+		EscalationPolicies []escalationPolicyStatus   `json:"escalationPolicies"`
+		Escalations        []notify.PendingEscalation `json:"escalations"`
+	}{
+		Schedules:          []scheduleStatus{},
+		EscalationPolicies: []escalationPolicyStatus{},
+		Escalations:        api.escalator.Pending(),
+	}
+
+	for _, s := range conf.Schedules {
+		ss := scheduleStatus{Name: s.Name, Timezone: s.Location().String(), Rotations: []rotationStatus{}}
+		for _, r := range s.Rotations {
+			shift, ok := oncall.Current(s, r, now)
+			if !ok {
+				// 轮值还没有开始
+				shift = oncall.Shift{Rotation: r.Name}
+			}
+			ss.Rotations = append(ss.Rotations, rotationStatus{Shift: shift, Next: oncall.Next(r, now)})
+		}
+		status.Schedules = append(status.Schedules, ss)
+	}
+
+	for _, p := range conf.EscalationPolicies {
+		ps := escalationPolicyStatus{Name: p.Name, Receivers: []string{}}
+		for _, rcv := range conf.Receivers {
+			if rcv.EscalationPolicy == p.Name {
+				ps.Receivers = append(ps.Receivers, rcv.Name)
+			}
+		}
+		for _, step := range p.Steps {
+			users := directory.ResolveNames(step.Targets, now).Names()
+			if users == nil {
+				users = []string{}
+			}
+			ps.Steps = append(ps.Steps, escalationStepStatus{After: step.After, Targets: step.Targets, Users: users})
+		}
+		status.EscalationPolicies = append(status.EscalationPolicies, ps)
+	}
+
+	api.respond(w, status)
+}
+
+func (api *API) listAlerts(w http.ResponseWriter, req *http.Request) {
+	if api.history == nil {
+		api.respondError(w, apiError{typ: errorUnavailable, err: fmt.Errorf("history store is disabled")}, nil)
+		return
+	}
+
+	q := history.Query{
+		Receiver: req.FormValue("receiver"),
+		Status:   req.FormValue("status"),
+		Limit:    defaultAlertsLimit,
+	}
+	if q.Status != "" && q.Status != "firing" && q.Status != "resolved" {
+		api.respondError(w, apiError{typ: errorBadData, err: fmt.Errorf("invalid status %q", q.Status)}, nil)
+		return
+	}
+	for _, f := range req.Form["filter"] {
+		m, err := labels.ParseMatcher(f)
+		if err != nil {
+			api.respondError(w, apiError{typ: errorBadData, err: err}, nil)
+			return
+		}
+		q.Matchers = append(q.Matchers, m)
+	}
+
+	var err error
+	if q.Start, err = parseTime(req.FormValue("start")); err != nil {
+		api.respondError(w, apiError{typ: errorBadData, err: err}, nil)
+		return
+	}
+	if q.End, err = parseTime(req.FormValue("end")); err != nil {
+		api.respondError(w, apiError{typ: errorBadData, err: err}, nil)
+		return
+	}
+	if s := req.FormValue("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit < 0 {
+			api.respondError(w, apiError{typ: errorBadData, err: fmt.Errorf("invalid limit %q", s)}, nil)
+			return
+		}
+	}
+
+	alerts, err := api.history.Alerts(q)
+	if err != nil {
+		api.respondError(w, apiError{typ: errorInternal, err: err}, nil)
+		return
+	}
+	api.respond(w, alerts)
+}
+
+func (api *API) getNotification(w http.ResponseWriter, req *http.Request) {
+	if api.history == nil {
+		api.respondError(w, apiError{typ: errorUnavailable, err: fmt.Errorf("history store is disabled")}, nil)
+		return
+	}
+
+	n, err := api.history.Get(route.Param(req.Context(), "id"))
+	if err == history.ErrNotFound {
+		api.respondError(w, apiError{typ: errorNotFound, err: err}, nil)
+		return
+	}
+	if err != nil {
+		api.respondError(w, apiError{typ: errorInternal, err: err}, nil)
+		return
+	}
+	api.respond(w, n)
+}
+
+func (api *API) listSilences(w http.ResponseWriter, req *http.Request) {
+	if api.silences == nil {
+		api.respondError(w, apiError{typ: errorUnavailable, err: fmt.Errorf("silences are disabled")}, nil)
+		return
+	}
+
+	if err := req.ParseForm(); err != nil {
+		api.respondError(w, apiError{typ: errorBadData, err: err}, nil)
+		return
+	}
+	var matchers labels.Matchers
+	for _, f := range req.Form["filter"] {
+		m, err := labels.ParseMatcher(f)
+		if err != nil {
+			api.respondError(w, apiError{typ: errorBadData, err: err}, nil)
+			return
+		}
+		matchers = append(matchers, m)
+	}
+
+	// filter 选择匹配器包含相同条件的静默规则
+	silences := []*silence.Silence{}
+	for _, s := range api.silences.List() {
+		if containsMatchers(s.Matchers, matchers) {
+			silences = append(silences, s)
+		}
+	}
+	api.respond(w, silences)
+}
+
+// containsMatchers reports whether every filter equals a matcher.
+func containsMatchers(ms, filters labels.Matchers) bool {
+	for _, f := range filters {
+		found := false
+		for _, m := range ms {
+			if m.String() == f.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (api *API) setSilence(w http.ResponseWriter, req *http.Request) {
+	if api.silences == nil {
+		api.respondError(w, apiError{typ: errorUnavailable, err: fmt.Errorf("silences are disabled")}, nil)
+		return
+	}
+
+	var s silence.Silence
+	if err := json.NewDecoder(req.Body).Decode(&s); err != nil {
+		api.respondError(w, apiError{typ: errorBadData, err: err}, nil)
+		return
+	}
+	if err := s.Validate(); err != nil {
+		api.respondError(w, apiError{typ: errorBadData, err: err}, nil)
+		return
+	}
+	id, err := api.silences.Set(&s)
+	switch err {
+	case nil:
+	case silence.ErrNotFound:
+		api.respondError(w, apiError{typ: errorNotFound, err: err}, nil)
+		return
+	case silence.ErrExpired:
+		api.respondError(w, apiError{typ: errorBadData, err: err}, nil)
+		return
+	default:
+		api.respondError(w, apiError{typ: errorInternal, err: err}, nil)
+		return
+	}
+	level.Info(api.logger).Log("msg", "Silence set", "id", id, "matchers", fmt.Sprint(s.Matchers), "createdBy", s.CreatedBy)
+
+	api.respond(w, struct {
+		SilenceID string `json:"silenceID"`
+	}{SilenceID: id})
+}
+
+func (api *API) getSilence(w http.ResponseWriter, req *http.Request) {
+	if api.silences == nil {
+		api.respondError(w, apiError{typ: errorUnavailable, err: fmt.Errorf("silences are disabled")}, nil)
+		return
+	}
+
+	s, err := api.silences.Get(route.Param(req.Context(), "id"))
+	if err == silence.ErrNotFound {
+		api.respondError(w, apiError{typ: errorNotFound, err: err}, nil)
+		return
+	}
+	if err != nil {
+		api.respondError(w, apiError{typ: errorInternal, err: err}, nil)
+		return
+	}
+	api.respond(w, s)
+}
+
+func (api *API) expireSilence(w http.ResponseWriter, req *http.Request) {
+	if api.silences == nil {
+		api.respondError(w, apiError{typ: errorUnavailable, err: fmt.Errorf("silences are disabled")}, nil)
+		return
+	}
+
+	id := route.Param(req.Context(), "id")
+	switch err := api.silences.Expire(id); err {
+	case nil:
+	case silence.ErrNotFound:
+		api.respondError(w, apiError{typ: errorNotFound, err: err}, nil)
+		return
+	case silence.ErrExpired:
+		api.respondError(w, apiError{typ: errorBadData, err: err}, nil)
+		return
+	default:
+		api.respondError(w, apiError{typ: errorInternal, err: err}, nil)
+		return
+	}
+	level.Info(api.logger).Log("msg", "Silence expired", "id", id)
+	api.respond(w, nil)
+}
+
+// parseTime parses a RFC3339 time or a Unix timestamp, an empty string is the
+// zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(t)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+}
+
 func (api *API) status(w http.ResponseWriter, req *http.Request) {
 	api.mtx.RLock()
 
@@ -129,14 +515,62 @@ func (api *API) respond(w http.ResponseWriter, data interface{}) {
 	}
 }
 
+func (api *API) respondError(w http.ResponseWriter, apiErr apiError, data interface{}) {
+	b, err := json.Marshal(&response{
+		Status:    statusError,
+		ErrorType: apiErr.typ,
+		Error:     apiErr.err.Error(),
+		Data:      data,
+	})
+	if err != nil {
+		level.Error(api.logger).Log("msg", "error marshaling json response", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var code int
+	switch apiErr.typ {
+	case errorBadData:
+		code = http.StatusBadRequest
+	case errorNotFound:
+		code = http.StatusNotFound
+	case errorUnavailable:
+		code = http.StatusServiceUnavailable
+	default:
+		code = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if n, err := w.Write(b); err != nil {
+		level.Error(api.logger).Log("msg", "error writing response", "bytesWritten", n, "err", err)
+	}
+}
+
 type status string
 
 const (
 	statusSuccess status = "success"
+	statusError   status = "error"
 )
 
 type errorType string
 
+const (
+	errorInternal    errorType = "server_error"
+	errorBadData     errorType = "bad_data"
+	errorNotFound    errorType = "not_found"
+	errorUnavailable errorType = "unavailable"
+)
+
+// defaultAlertsLimit is the number of alerts listed when no limit is given.
+const defaultAlertsLimit = 100
+
+type apiError struct {
+	typ errorType
+	err error
+}
+
 type response struct {
 	Status    status      `json:"status"`
 	Data      interface{} `json:"data,omitempty"`
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/notify"
+	"github.com/cnych/promoter/notify/receivers"
+	"github.com/cnych/promoter/template"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+// checkConfig loads the configuration and the templates, validates the image
+// storage and renders every notifier of every receiver with sample data. It
+// prints a report and returns the exit code.
+func checkConfig(out io.Writer, configFile string, expandEnv bool, externalURL string) int {
+	fmt.Fprintf(out, "Checking %s\n", configFile)
+
+	conf, err := config.LoadFile(configFile, expandEnv)
+	if err != nil {
+		fmt.Fprintf(out, "  FAILED: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(out, "  SUCCESS: configuration loaded")
+
+	tmpl, err := template.FromGlobs(conf.Templates...)
+	if err != nil {
+		fmt.Fprintf(out, "  FAILED: %v\n", errors.Wrap(err, "failed to parse templates"))
+		return 1
+	}
+	fmt.Fprintln(out, "  SUCCESS: templates parsed")
+
+	amURL, err := extURL(log.NewNopLogger(), os.Hostname, ":8080", externalURL)
+	if err != nil {
+		fmt.Fprintf(out, "  FAILED: invalid external URL: %v\n", err)
+		return 1
+	}
+	setTemplateURLs(tmpl, conf, amURL)
+
+	failed := false
+	if err := checkImages(conf); err != nil {
+		fmt.Fprintf(out, "  FAILED: images: %v\n", err)
+		failed = true
+	} else {
+		fmt.Fprintln(out, "  SUCCESS: images")
+	}
+
+	for _, rcv := range conf.Receivers {
+		fmt.Fprintf(out, "Receiver %q:\n", rcv.Name)
+
+		integrations, err := receivers.BuildIntegrations(rcv, tmpl, log.NewNopLogger())
+		if err != nil {
+			fmt.Fprintf(out, "  FAILED: %v\n", err)
+			failed = true
+		}
+		if len(integrations) == 0 && err == nil {
+			fmt.Fprintln(out, "  WARNING: no notifiers configured")
+		}
+
+		for _, i := range integrations {
+			if err := checkIntegration(rcv.Name, i); err != nil {
+				fmt.Fprintf(out, "  FAILED: %s: %v\n", i, err)
+				failed = true
+				continue
+			}
+			fmt.Fprintf(out, "  SUCCESS: %s\n", i)
+		}
+
+		if rcv.Ingest != nil {
+			if _, err := notify.NewIngester(rcv.Ingest); err != nil {
+				fmt.Fprintf(out, "  FAILED: ingest: %v\n", err)
+				failed = true
+			} else {
+				fmt.Fprintln(out, "  SUCCESS: ingest")
+			}
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// checkImages validates the datasources and, if images can be made from a
+// datasource or Grafana for any receiver, the object storage settings.
+func checkImages(conf *config.Config) error {
+	imager, err := notify.NewImager(conf)
+	if err != nil {
+		return err
+	}
+	if !imager.HasSources() {
+		return nil
+	}
+
+	needsStorage := false
+	for _, rcv := range conf.Receivers {
+		if rcv.ImageProvider != notify.ImageProviderNone {
+			needsStorage = true
+		}
+	}
+	if !needsStorage {
+		return nil
+	}
+
+	if conf.S3 == nil {
+		return fmt.Errorf("no s3 storage configured, set image_provider: none on receivers without images")
+	}
+	missing := map[string]bool{
+		"access_key": conf.S3.AccessKey == "",
+		"secret_key": conf.S3.SecretKey == "",
+		"endpoint":   conf.S3.Endpoint == "",
+		"region":     conf.S3.Region == "",
+		"bucket":     conf.S3.Bucket == "",
+	}
+	var names []string
+	for name, m := range missing {
+		if m {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return fmt.Errorf("missing s3 settings %v", names)
+	}
+	return nil
+}
+
+// checkIntegration renders the notifier with firing and resolved sample data.
+func checkIntegration(receiver string, i notify.Integration) error {
+	renderer, ok := i.Notifier.(notify.Renderer)
+	if !ok {
+		return nil
+	}
+	for _, status := range []model.AlertStatus{model.AlertFiring, model.AlertResolved} {
+		fields, err := renderer.Render(notify.SampleData(receiver, string(status), nil))
+		if err != nil {
+			return errors.Wrapf(err, "%s notification", status)
+		}
+		if u := fields["image_url"]; u != "" {
+			if err := checkImageURL(u); err != nil {
+				return errors.Wrapf(err, "%s notification: invalid image_url", status)
+			}
+		}
+	}
+	return nil
+}
+
+// checkImageURL checks that the URL is an absolute http(s) URL with a host,
+// as the chat clients fetch the image from it.
+func checkImageURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q is not an http(s) URL", s)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", s)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cnych/promoter/config"
+)
+
+func TestCheckImages(t *testing.T) {
+	const s3 = `
+s3:
+  access_key: key
+  secret_key: secret
+  endpoint: https://s3.example.com
+  region: us-east-1
+  bucket: promoter
+`
+
+	for _, tc := range []struct {
+		name string
+		// global and extra are added to the global section and the top level
+		// of the configuration.
+		global        string
+		extra         string
+		imageProvider string
+		err           string
+	}{
+		{
+			name: "no image source",
+		},
+		{
+			name:   "prometheus_url without s3",
+			global: "prometheus_url: http://prometheus:9090",
+			err:    "no s3 storage configured",
+		},
+		{
+			name:  "datasources without s3",
+			extra: "datasources:\n  - name: prod\n    url: http://prometheus:9090",
+			err:   "no s3 storage configured",
+		},
+		{
+			name:  "grafana without s3",
+			extra: "grafana:\n  url: http://grafana:3000",
+			err:   "no s3 storage configured",
+		},
+		{
+			name:          "image source without receivers making images",
+			global:        "prometheus_url: http://prometheus:9090",
+			imageProvider: "none",
+		},
+		{
+			name:   "image source with s3",
+			global: "prometheus_url: http://prometheus:9090",
+			extra:  s3,
+		},
+		{
+			name:   "incomplete s3",
+			global: "prometheus_url: http://prometheus:9090",
+			extra:  strings.Replace(s3, "  region: us-east-1\n", "", 1),
+			err:    "missing s3 settings [region]",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf, err := config.Load(`
+global:
+  dingtalk_api_url: http://dingtalk.example.com/robot/send
+  dingtalk_api_token: token
+  dingtalk_api_secret: secret
+  ` + tc.global + `
+receivers:
+  - name: ops
+    image_provider: "` + tc.imageProvider + `"
+    dingtalk_configs:
+      - message_type: markdown
+` + tc.extra)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = checkImages(conf)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -1,19 +1,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/cnych/promoter/api"
 	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/dedup"
+	"github.com/cnych/promoter/history"
+	"github.com/cnych/promoter/notify/receivers"
+	"github.com/cnych/promoter/silence"
 	"github.com/cnych/promoter/template"
+	"github.com/cnych/promoter/ui"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/pkg/errors"
@@ -24,6 +32,9 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
+// shutdownTimeout bounds waiting for the requests in progress on SIGTERM.
+const shutdownTimeout = 30 * time.Second
+
 var (
 	promlogConfig = promlog.Config{}
 	term          = make(chan os.Signal, 1)
@@ -41,25 +52,60 @@ func run() int {
 
 	var (
 		configFile    = kingpin.Flag("config.file", "Promoter configuration file.").Default("config.yaml").ExistingFile()
+		expandEnv     = kingpin.Flag("config.expand-env", "Replace ${VAR} references in the configuration file with environment variables.").Default("false").Bool()
 		debug         = kingpin.Flag("web.debug", "Dump request data").Default("false").Bool()
 		externalURL   = kingpin.Flag("web.external-url", "The URL under which Promoter is externally reachable (for example, if Promoter is served via a reverse proxy). Used for generating relative and absolute links back to Promoter itself. If the URL has a path portion, it will be used to prefix all HTTP endpoints served by Promoter. If omitted, relevant URL components will be derived automatically.").String()
 		listenAddress = kingpin.Flag("web.listen-address", "Address to listen on for the web interface and API.").Default(":8080").String()
+		readyDeps     = kingpin.Flag("web.ready-check-dependencies", "Make /-/ready check that the datasources, the S3 storage and the WeChat token acquisition are reachable.").Default("false").Bool()
+		readyCacheTTL = kingpin.Flag("web.ready-cache-ttl", "How long the results of the /-/ready checks are reused.").Default("30s").Duration()
+		storagePath   = kingpin.Flag("storage.path", "Base path for data storage.").Default("data/").String()
+		retention     = kingpin.Flag("history.retention", "How long to keep the history of notifications, 0 keeps it forever.").Default("120h").Duration()
+		maxHistory    = kingpin.Flag("history.max-notifications", "Maximum number of notifications kept in the history, 0 means no limit.").Default("10000").Int()
+		dedupBackend  = kingpin.Flag("dedup.backend", "Backend storing the notifications sent recently for the dedup_interval of receivers: file survives restarts and can be shared by replicas through a shared directory, memory does neither.").Default("file").Enum("file", "memory")
+		dedupPath     = kingpin.Flag("dedup.path", "Directory of the file dedup backend, defaults to dedup/ in the storage path.").String()
 	)
 
 	promlogflag.AddFlags(kingpin.CommandLine, &promlogConfig)
 
+	kingpin.Command("run", "Run the Promoter server.").Default()
+	checkConfigCmd := kingpin.Command("check-config", "Check the configuration file, the templates and every notifier of every receiver.")
+	sendTestCmd := kingpin.Command("send-test", "Send test notifications through every notifier of a receiver.")
+	sendTestReceiver := sendTestCmd.Flag("receiver", "Name of the receiver to test.").Required().String()
+	sendTestStatus := sendTestCmd.Flag("status", "Status of the test notification, both sends a firing and a resolved one.").Default("both").Enum("firing", "resolved", "both")
+	sendTestLabels := sendTestCmd.Flag("label", "Label added to the test alerts, repeatable (e.g. --label team=ops).").StringMap()
+	sendTestPlot := sendTestCmd.Flag("plot", "Attach a demo chart, requires the s3 configuration.").Bool()
+	renderCmd := kingpin.Command("render", "Render a template, or the notifiers of a receiver, without sending anything.")
+	renderTemplateStr := renderCmd.Flag("template", "Template string to render.").String()
+	renderReceiver := renderCmd.Flag("receiver", "Name of the receiver whose notifiers are rendered.").String()
+	renderIntegration := renderCmd.Flag("integration", "Only render this notifier of the receiver, e.g. dingtalk[0].").String()
+	renderData := renderCmd.Flag("data", "JSON file with the notification data, sample data is used if omitted.").ExistingFile()
+
 	kingpin.CommandLine.UsageWriter(os.Stdout)
 	kingpin.Version(version.Print("promoter"))
 	kingpin.CommandLine.GetFlag("help").Short('h')
-	kingpin.Parse()
+	cmd := kingpin.Parse()
 
 	logger := promlog.New(&promlogConfig)
 
+	switch cmd {
+	case checkConfigCmd.FullCommand():
+		return checkConfig(os.Stdout, *configFile, *expandEnv, *externalURL)
+	case sendTestCmd.FullCommand():
+		opts := receivers.TestOptions{Labels: *sendTestLabels, Plot: *sendTestPlot}
+		if *sendTestStatus != "both" {
+			opts.Status = *sendTestStatus
+		}
+		return sendTest(os.Stdout, logger, *configFile, *expandEnv, *externalURL, *sendTestReceiver, opts)
+	case renderCmd.FullCommand():
+		req := receivers.RenderRequest{Template: *renderTemplateStr, Receiver: *renderReceiver, Integration: *renderIntegration}
+		return renderTemplate(os.Stdout, logger, *configFile, *expandEnv, *externalURL, *renderData, req)
+	}
+
 	level.Info(logger).Log("msg", "Staring Promoter", "version", version.Info())
 	level.Info(logger).Log("build_context", version.BuildContext())
 
 	// 加载配置文件和模板
-	conf, err := loadConfiguration(logger, *configFile)
+	conf, err := loadConfiguration(logger, *configFile, *expandEnv)
 	if err != nil {
 		return 1
 	}
@@ -74,13 +120,62 @@ func run() int {
 		return 1
 	}
 
+	// 保存收到的报警和每个通知的发送结果
+	hist, err := history.Open(*storagePath, history.Options{
+		Retention:        *retention,
+		MaxNotifications: *maxHistory,
+	}, log.With(logger, "component", "history"))
+	if err != nil {
+		level.Error(logger).Log("msg", "Opening history store failed", "err", err)
+		return 1
+	}
+	defer hist.Close()
+
+	// 去重状态默认保存在文件中，重启后仍然有效，多个副本可以共享同一个目录
+	var dedupStore dedup.Backend = dedup.NewMemory()
+	if *dedupBackend == "file" {
+		if *dedupPath == "" {
+			*dedupPath = filepath.Join(*storagePath, "dedup")
+		}
+		if dedupStore, err = dedup.NewFile(*dedupPath); err != nil {
+			level.Error(logger).Log("msg", "Opening dedup store failed", "err", err)
+			return 1
+		}
+	}
+	dd := dedup.New(dedupStore, log.With(logger, "component", "dedup"))
+
+	// 静默规则保存在存储目录中，重启后仍然有效
+	silences, err := silence.Open(*storagePath, log.With(logger, "component", "silence"))
+	if err != nil {
+		level.Error(logger).Log("msg", "Opening silences failed", "err", err)
+		return 1
+	}
+
 	api := api.New(api.Options{
-		Logger: logger,
-		Debug:  *debug,
+		Logger:                 logger,
+		Debug:                  *debug,
+		History:                hist,
+		Dedup:                  dd,
+		Silences:               silences,
+		ReadyCheckDependencies: *readyDeps,
+		ReadyCacheTTL:          *readyCacheTTL,
 	})
-	api.Update(conf, tmpl) // 更新配置对象
+	// 更新配置对象
+	if err := api.Update(conf, tmpl); err != nil {
+		level.Error(logger).Log("msg", "Applying configuration failed", "err", err)
+		return 1
+	}
+
+	stopc := make(chan struct{})
+	defer close(stopc)
+	go api.Run(stopc) // 运行报警升级等后台任务
+	go hist.Run(stopc)
+	go dd.Run(stopc)
+	go silences.Run(stopc)
 
-	mux := api.Register(route.New()) // 注册路由
+	router := route.New()
+	ui.Register(router)         // 注册 Web 页面
+	mux := api.Register(router) // 注册路由
 	srv := http.Server{Addr: *listenAddress, Handler: mux}
 	srvc := make(chan struct{})
 
@@ -97,12 +192,36 @@ func run() int {
 		}()
 	}()
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	signal.Notify(term, os.Interrupt, syscall.SIGTERM)
 
 	for {
 		select {
+		case <-hup:
+			// 重新加载配置文件、模板和密钥文件，失败时继续使用旧的配置
+			conf, err := loadConfiguration(logger, *configFile, *expandEnv)
+			if err != nil {
+				continue
+			}
+			tmpl, err := loadTemplate(logger, conf, amURL)
+			if err != nil {
+				continue
+			}
+			if err := api.Update(conf, tmpl); err != nil {
+				level.Error(logger).Log("msg", "Applying configuration failed, keeping the previous one", "err", err)
+				continue
+			}
+			level.Info(logger).Log("msg", "Reloaded configuration", "file", *configFile)
 		case <-term:
 			level.Info(logger).Log("msg", "Received SIGTERM, exiting gracefully...")
+			// 先停止接收新的通知并等待处理中的请求，再发送聚合窗口中缓存的通知
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			if err := srv.Shutdown(ctx); err != nil {
+				level.Error(logger).Log("msg", "Error on shutting down the server", "err", err)
+			}
+			cancel()
+			api.Flush()
 			return 0
 		case <-srvc:
 			return 1
@@ -118,16 +237,25 @@ func loadTemplate(logger log.Logger, conf *config.Config, externalURL *url.URL)
 		level.Error(tmplLogger).Log("msg", errors.Wrap(err, "failed to parse templates"))
 		return nil, err
 	}
-	tmpl.ExternalURL = externalURL
+	setTemplateURLs(tmpl, conf, externalURL)
 	return tmpl, nil
 }
 
-func loadConfiguration(logger log.Logger, configFilePath string) (*config.Config, error) {
+// setTemplateURLs sets the URLs of Promoter and of the Alertmanager web UI
+// used by the templates.
+func setTemplateURLs(tmpl *template.Template, conf *config.Config, externalURL *url.URL) {
+	tmpl.ExternalURL = externalURL
+	if conf.Alertmanager != nil {
+		tmpl.AlertmanagerURL = conf.Alertmanager.WebURL()
+	}
+}
+
+func loadConfiguration(logger log.Logger, configFilePath string, expandEnv bool) (*config.Config, error) {
 	configLogger := log.With(logger, "component", "configuration")
 	level.Info(configLogger).Log("msg", "Loading configuration file", "file", configFilePath)
 
 	// 加载配置文件和模板
-	conf, err := config.LoadFile(configFilePath)
+	conf, err := config.LoadFile(configFilePath, expandEnv)
 	if err != nil {
 		level.Error(configLogger).Log(
 			"msg", "Loading configuration file failed",
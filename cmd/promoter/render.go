@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/notify"
+	"github.com/cnych/promoter/notify/receivers"
+	"github.com/cnych/promoter/template"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+)
+
+// renderTemplate renders a template string, or the notifiers of a receiver,
+// with the data read from dataFile (sample data if empty) and prints the
+// output. Rendered fields are printed as indented JSON so that the output is
+// stable and can be compared with golden files. It returns the exit code.
+func renderTemplate(out io.Writer, logger log.Logger, configFile string, expandEnv bool, externalURL, dataFile string, req receivers.RenderRequest) int {
+	conf, err := config.LoadFile(configFile, expandEnv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAILED: %v\n", err)
+		return 1
+	}
+
+	tmpl, err := template.FromGlobs(conf.Templates...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAILED: %v\n", errors.Wrap(err, "failed to parse templates"))
+		return 1
+	}
+	amURL, err := extURL(logger, os.Hostname, ":8080", externalURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAILED: invalid external URL: %v\n", err)
+		return 1
+	}
+	setTemplateURLs(tmpl, conf, amURL)
+
+	if dataFile != "" {
+		b, err := ioutil.ReadFile(dataFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "FAILED: %v\n", err)
+			return 1
+		}
+		if req.Data, _, err = notify.DecodePayload(b, notify.PayloadFormatAuto); err != nil {
+			fmt.Fprintf(os.Stderr, "FAILED: invalid data file %s: %v\n", dataFile, err)
+			return 1
+		}
+	}
+
+	results, err := receivers.Render(conf, tmpl, logger, req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAILED: %v\n", err)
+		return 1
+	}
+
+	failed := false
+	for _, res := range results {
+		if res.Error != "" {
+			fmt.Fprintf(os.Stderr, "FAILED: %s: %s\n", res.Integration, res.Error)
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+
+	if req.Template != "" {
+		fmt.Fprint(out, results[0].Output)
+		return 0
+	}
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAILED: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(out, string(b))
+	return 0
+}
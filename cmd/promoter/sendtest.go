@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/notify"
+	"github.com/cnych/promoter/notify/receivers"
+	"github.com/cnych/promoter/template"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+)
+
+// sendTest sends test notifications through every notifier of the receiver
+// and prints the result of each of them. It returns the exit code.
+func sendTest(out io.Writer, logger log.Logger, configFile string, expandEnv bool, externalURL, receiver string, opts receivers.TestOptions) int {
+	conf, err := config.LoadFile(configFile, expandEnv)
+	if err != nil {
+		fmt.Fprintf(out, "FAILED: %v\n", err)
+		return 1
+	}
+
+	var rcv *config.Receiver
+	for _, r := range conf.Receivers {
+		if r.Name == receiver {
+			rcv = r
+			break
+		}
+	}
+	if rcv == nil {
+		fmt.Fprintf(out, "FAILED: receiver %q not found\n", receiver)
+		return 1
+	}
+
+	tmpl, err := template.FromGlobs(conf.Templates...)
+	if err != nil {
+		fmt.Fprintf(out, "FAILED: %v\n", errors.Wrap(err, "failed to parse templates"))
+		return 1
+	}
+	amURL, err := extURL(logger, os.Hostname, ":8080", externalURL)
+	if err != nil {
+		fmt.Fprintf(out, "FAILED: invalid external URL: %v\n", err)
+		return 1
+	}
+	setTemplateURLs(tmpl, conf, amURL)
+
+	var imager *notify.Imager
+	if opts.Plot {
+		if imager, err = notify.NewImager(conf); err != nil {
+			fmt.Fprintf(out, "FAILED: %v\n", err)
+			return 1
+		}
+	}
+
+	results, err := receivers.Test(context.Background(), logger, rcv, tmpl, notify.NewDirectory(conf), imager, opts)
+	failed := false
+	if err != nil {
+		fmt.Fprintf(out, "FAILED: %v\n", err)
+		failed = true
+	}
+	if len(results) == 0 && err == nil {
+		fmt.Fprintf(out, "WARNING: receiver %q has no notifiers\n", receiver)
+	}
+	for _, res := range results {
+		if res.Skipped {
+			fmt.Fprintf(out, "SKIPPED: %s (%s): no alerts left after filtering\n", res.Integration, res.Status)
+			continue
+		}
+		if res.Error != "" {
+			fmt.Fprintf(out, "FAILED: %s (%s): %s\n", res.Integration, res.Status, res.Error)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(out, "SUCCESS: %s (%s)\n", res.Integration, res.Status)
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	commoncfg "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+)
+
+// DefaultActionsConfig defines default values for the actions configuration.
+var DefaultActionsConfig = ActionsConfig{
+	LinkTTL:         model.Duration(24 * time.Hour),
+	SilenceDuration: model.Duration(2 * time.Hour),
+}
+
+// ActionsConfig enables the acknowledge and silence links of notifications.
+// The links point to Promoter under --web.external-url and are signed with
+// the secret, so that they cannot be forged for other alerts.
+type ActionsConfig struct {
+	Secret     Secret `yaml:"secret,omitempty" json:"secret,omitempty"`
+	SecretFile string `yaml:"secret_file,omitempty" json:"secret_file,omitempty"`
+	// LinkTTL is how long the links of a notification stay valid.
+	LinkTTL model.Duration `yaml:"link_ttl,omitempty" json:"link_ttl,omitempty"`
+	// SilenceDuration is the duration of the silences created by the links.
+	SilenceDuration model.Duration `yaml:"silence_duration,omitempty" json:"silence_duration,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for ActionsConfig.
+func (c *ActionsConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultActionsConfig
+	type plain ActionsConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Secret == "" && c.SecretFile == "" {
+		return fmt.Errorf("missing secret in actions config")
+	}
+	if c.LinkTTL <= 0 {
+		return fmt.Errorf("link_ttl of actions must be positive")
+	}
+	if c.SilenceDuration <= 0 {
+		return fmt.Errorf("silence_duration of actions must be positive")
+	}
+	return checkSecretFile("secret", c.Secret, c.SecretFile)
+}
+
+// AlertmanagerConfig configures the Alertmanager the silences are created
+// in and linked to.
+type AlertmanagerConfig struct {
+	// URL is the base URL of the Alertmanager API, including any path prefix.
+	URL *URL `yaml:"url" json:"url"`
+	// ExternalURL is the URL of the web UI used in the links of templates,
+	// defaults to URL.
+	ExternalURL *URL                        `yaml:"external_url,omitempty" json:"external_url,omitempty"`
+	HTTPConfig  *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+	// CheckSuppressed queries Alertmanager before sending a notification and
+	// drops the firing alerts it silenced or inhibited in the meantime.
+	CheckSuppressed bool `yaml:"check_suppressed,omitempty" json:"check_suppressed,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for AlertmanagerConfig.
+func (c *AlertmanagerConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain AlertmanagerConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.URL == nil {
+		return fmt.Errorf("missing url in alertmanager config")
+	}
+	return nil
+}
+
+// WebURL returns the URL of the web UI.
+func (c *AlertmanagerConfig) WebURL() *url.URL {
+	if c.ExternalURL != nil {
+		return c.ExternalURL.URL
+	}
+	return c.URL.URL
+}
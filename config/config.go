@@ -174,21 +174,92 @@ func Load(s string) (*Config, error) {
 	return cfg, nil
 }
 
-// LoadFile parses the given YAML file into a Config.
-func LoadFile(filename string) (*Config, error) {
-	content, err := ioutil.ReadFile(filename)
+// LoadFile parses the given YAML file into a Config, merging the receivers of
+// the receiver_files fragments. If expandEnv is true, ${NAME} references in
+// the files are replaced with environment variables before parsing. Secrets
+// configured with *_file options are read relative to the directory of the
+// file configuring them.
+func LoadFile(filename string, expandEnv bool) (*Config, error) {
+	s, err := readConfigFile(filename, expandEnv)
 	if err != nil {
 		return nil, err
 	}
-	cfg, err := Load(string(content))
+	cfg, err := Load(s)
 	if err != nil {
 		return nil, err
 	}
 
 	resolveFilepaths(filepath.Dir(filename), cfg)
+	if err := cfg.loadReceiverFiles(expandEnv); err != nil {
+		return nil, err
+	}
+	if err := readSecretFiles(cfg); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
+func readConfigFile(filename string, expandEnv bool) (string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	s := string(content)
+	if expandEnv {
+		if s, err = expandEnvVars(s); err != nil {
+			return "", errors.Wrapf(err, "%s", filename)
+		}
+	}
+	return s, nil
+}
+
+// receiverFile is a configuration fragment included with receiver_files.
+type receiverFile struct {
+	Receivers []*Receiver `yaml:"receivers,omitempty"`
+}
+
+// loadReceiverFiles merges the receivers of all files matching the
+// receiver_files globs into the configuration. Receiver names must be unique
+// across all files.
+func (c *Config) loadReceiverFiles(expandEnv bool) error {
+	files := map[string]string{}
+	for _, rcv := range c.Receivers {
+		files[rcv.Name] = "main configuration"
+	}
+
+	for _, pattern := range c.ReceiverFiles {
+		// 和模板一样，允许通配符没有匹配到任何文件
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		for _, filename := range matches {
+			s, err := readConfigFile(filename, expandEnv)
+			if err != nil {
+				return err
+			}
+			var rf receiverFile
+			if err := yaml.UnmarshalStrict([]byte(s), &rf); err != nil {
+				return errors.Wrapf(err, "%s", filename)
+			}
+
+			// 先按片段所在目录解析相对路径，再继承全局配置，避免全局路径被错误地改写
+			resolveReceiverFilepaths(filepath.Dir(filename), rf.Receivers)
+			for _, rcv := range rf.Receivers {
+				if f, ok := files[rcv.Name]; ok {
+					return fmt.Errorf("%s: notification config name %q is not unique, already defined in %s", filename, rcv.Name, f)
+				}
+				if err := c.inheritGlobal(rcv); err != nil {
+					return errors.Wrapf(err, "%s", filename)
+				}
+				files[rcv.Name] = filename
+			}
+			c.Receivers = append(c.Receivers, rf.Receivers...)
+		}
+	}
+	return nil
+}
+
 // resolveFilepaths joins all relative paths in a configuration
 // with a given base directory.
 func resolveFilepaths(baseDir string, cfg *Config) {
@@ -202,34 +273,126 @@ func resolveFilepaths(baseDir string, cfg *Config) {
 	for i, tf := range cfg.Templates {
 		cfg.Templates[i] = join(tf)
 	}
+	for i, rf := range cfg.ReceiverFiles {
+		cfg.ReceiverFiles[i] = join(rf)
+	}
+	cfg.Plot.FontFile = join(cfg.Plot.FontFile)
 
 	cfg.Global.HTTPConfig.SetDirectory(baseDir)
-	for _, receiver := range cfg.Receivers {
+	cfg.Global.WeChatAPISecretFile = join(cfg.Global.WeChatAPISecretFile)
+	cfg.Global.WeChatAPICorpIDFile = join(cfg.Global.WeChatAPICorpIDFile)
+	cfg.Global.DingTalkAPITokenFile = join(cfg.Global.DingTalkAPITokenFile)
+	cfg.Global.DingTalkAPISecretFile = join(cfg.Global.DingTalkAPISecretFile)
+	resolveReceiverFilepaths(baseDir, cfg.Receivers)
+	if cfg.S3 != nil {
+		cfg.S3.AccessKeyFile = join(cfg.S3.AccessKeyFile)
+		cfg.S3.SecretKeyFile = join(cfg.S3.SecretKeyFile)
+	}
+	for _, ds := range cfg.Datasources {
+		ds.HTTPConfig.SetDirectory(baseDir)
+	}
+	if cfg.Grafana != nil {
+		cfg.Grafana.HTTPConfig.SetDirectory(baseDir)
+		cfg.Grafana.APIKeyFile = join(cfg.Grafana.APIKeyFile)
+	}
+	if cfg.Actions != nil {
+		cfg.Actions.SecretFile = join(cfg.Actions.SecretFile)
+	}
+	if cfg.Alertmanager != nil {
+		cfg.Alertmanager.HTTPConfig.SetDirectory(baseDir)
+	}
+}
+
+// resolveReceiverFilepaths joins all relative paths in the receivers with a
+// given base directory.
+func resolveReceiverFilepaths(baseDir string, receivers []*Receiver) {
+	join := func(fp string) string {
+		if len(fp) > 0 && !filepath.IsAbs(fp) {
+			fp = filepath.Join(baseDir, fp)
+		}
+		return fp
+	}
+
+	for _, receiver := range receivers {
 		for _, cfg := range receiver.WechatConfigs {
 			cfg.HTTPConfig.SetDirectory(baseDir)
+			cfg.APISecretFile = join(cfg.APISecretFile)
+			cfg.CorpIDFile = join(cfg.CorpIDFile)
 		}
 		for _, cfg := range receiver.DingtalkConfigs {
 			cfg.HTTPConfig.SetDirectory(baseDir)
+			cfg.APISecretFile = join(cfg.APISecretFile)
+			cfg.APITokenFile = join(cfg.APITokenFile)
 		}
 	}
 }
 
+// copyHTTPConfig returns a copy of hc whose relative paths can be resolved
+// without changing hc, SetDirectory also changes the nested auth settings.
+func copyHTTPConfig(hc *commoncfg.HTTPClientConfig) *commoncfg.HTTPClientConfig {
+	if hc == nil {
+		return nil
+	}
+	c := *hc
+	if hc.BasicAuth != nil {
+		ba := *hc.BasicAuth
+		c.BasicAuth = &ba
+	}
+	if hc.Authorization != nil {
+		auth := *hc.Authorization
+		c.Authorization = &auth
+	}
+	if hc.OAuth2 != nil {
+		oauth2 := *hc.OAuth2
+		c.OAuth2 = &oauth2
+	}
+	return &c
+}
+
 // Config 整个应用最顶层的配置文件
 type Config struct {
-	Global    *GlobalConfig `yaml:"global,omitempty" json:"global,omitempty"`
-	Receivers []*Receiver   `yaml:"receivers,omitempty" json:"receivers,omitempty"`
-	Templates []string      `yaml:"templates" json:"templates"`
-	S3        *S3Config     `yaml:"s3" json:"s3"`
+	Global      *GlobalConfig       `yaml:"global,omitempty" json:"global,omitempty"`
+	Datasources []*DatasourceConfig `yaml:"datasources,omitempty" json:"datasources,omitempty"`
+	Receivers   []*Receiver         `yaml:"receivers,omitempty" json:"receivers,omitempty"`
+	// ReceiverFiles 是包含更多接收器配置的文件通配符，这些接收器会合并到 Receivers 中
+	ReceiverFiles []string       `yaml:"receiver_files,omitempty" json:"receiver_files,omitempty"`
+	Templates     []string       `yaml:"templates" json:"templates"`
+	S3            *S3Config      `yaml:"s3" json:"s3"`
+	Plot          *PlotConfig    `yaml:"plot,omitempty" json:"plot,omitempty"`
+	Grafana       *GrafanaConfig `yaml:"grafana,omitempty" json:"grafana,omitempty"`
+	// Users 和 Teams 组成值班通讯录，用于根据报警标签 @ 相关人员
+	Users []*UserConfig `yaml:"users,omitempty" json:"users,omitempty"`
+	Teams []*TeamConfig `yaml:"teams,omitempty" json:"teams,omitempty"`
+	// Schedules 是值班表，EscalationPolicies 定义报警持续未恢复时逐级通知的人员
+	Schedules          []*ScheduleConfig         `yaml:"schedules,omitempty" json:"schedules,omitempty"`
+	EscalationPolicies []*EscalationPolicyConfig `yaml:"escalation_policies,omitempty" json:"escalation_policies,omitempty"`
+	// Actions 启用通知中的确认和静默链接，Alertmanager 配置后静默规则创建在 Alertmanager 中
+	Actions      *ActionsConfig      `yaml:"actions,omitempty" json:"actions,omitempty"`
+	Alertmanager *AlertmanagerConfig `yaml:"alertmanager,omitempty" json:"alertmanager,omitempty"`
 	// original is the input from which the config was parsed.
 	original string
 }
 
 type S3Config struct {
-	AccessKey Secret `yaml:"access_key" json:"access_key"`
-	SecretKey Secret `yaml:"secret_key" json:"secret_key"`
-	Endpoint  string `yaml:"endpoint" json:"endpoint"`
-	Region    string `yaml:"region" json:"region"`
-	Bucket    string `yaml:"bucket" json:"bucket"`
+	AccessKey     Secret `yaml:"access_key" json:"access_key"`
+	AccessKeyFile string `yaml:"access_key_file,omitempty" json:"access_key_file,omitempty"`
+	SecretKey     Secret `yaml:"secret_key" json:"secret_key"`
+	SecretKeyFile string `yaml:"secret_key_file,omitempty" json:"secret_key_file,omitempty"`
+	Endpoint      string `yaml:"endpoint" json:"endpoint"`
+	Region        string `yaml:"region" json:"region"`
+	Bucket        string `yaml:"bucket" json:"bucket"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for S3Config.
+func (c *S3Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain S3Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if err := checkSecretFile("access_key", c.AccessKey, c.AccessKeyFile); err != nil {
+		return err
+	}
+	return checkSecretFile("secret_key", c.SecretKey, c.SecretKeyFile)
 }
 
 func (c Config) GetReceiver(name string) *Receiver {
@@ -264,6 +427,34 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		c.Global = &GlobalConfig{}
 		*c.Global = DefaultGlobalConfig()
 	}
+	if c.Plot == nil {
+		c.Plot = &PlotConfig{}
+		*c.Plot = DefaultPlotConfig
+	}
+
+	// 复制全局的 HTTP 配置，解析相对路径时不会重复改写全局配置
+	if c.Grafana != nil && c.Grafana.HTTPConfig == nil {
+		c.Grafana.HTTPConfig = copyHTTPConfig(c.Global.HTTPConfig)
+	}
+	if c.Alertmanager != nil && c.Alertmanager.HTTPConfig == nil {
+		c.Alertmanager.HTTPConfig = copyHTTPConfig(c.Global.HTTPConfig)
+	}
+
+	dsNames := map[string]struct{}{}
+	for _, ds := range c.Datasources {
+		// 数据源名称需要唯一
+		if _, ok := dsNames[ds.Name]; ok {
+			return fmt.Errorf("datasource name %q is not unique", ds.Name)
+		}
+		if ds.HTTPConfig == nil {
+			ds.HTTPConfig = copyHTTPConfig(c.Global.HTTPConfig)
+		}
+		dsNames[ds.Name] = struct{}{}
+	}
+
+	if err := c.validateDirectory(); err != nil {
+		return err
+	}
 
 	names := map[string]struct{}{}
 
@@ -272,60 +463,78 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		if _, ok := names[rcv.Name]; ok {
 			return fmt.Errorf("notification config name %q is not unique", rcv.Name)
 		}
-		// 循环 wechat 配置
-		for _, wcc := range rcv.WechatConfigs {
-			if wcc.HTTPConfig == nil {
-				wcc.HTTPConfig = c.Global.HTTPConfig
-			}
-			if wcc.APIURL == nil {
-				if c.Global.WeChatAPIURL == nil {
-					return fmt.Errorf("no global Wechat URL set")
-				}
-				wcc.APIURL = c.Global.WeChatAPIURL
-			}
-			if wcc.APISecret == "" {
-				if c.Global.WeChatAPISecret == "" {
-					return fmt.Errorf("no global Wechat ApiSecret set")
-				}
-				wcc.APISecret = c.Global.WeChatAPISecret
-			}
-			if wcc.CorpID == "" {
-				if c.Global.WeChatAPICorpID == "" {
-					return fmt.Errorf("no global Wechat CorpID set")
-				}
-				wcc.CorpID = c.Global.WeChatAPICorpID
+		if err := c.inheritGlobal(rcv); err != nil {
+			return err
+		}
+		names[rcv.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// inheritGlobal validates the receiver against the rest of the configuration
+// and fills the notifier settings it leaves unset from the global settings.
+func (c *Config) inheritGlobal(rcv *Receiver) error {
+	if rcv.ImageProvider == "grafana" && c.Grafana == nil {
+		return fmt.Errorf("receiver %q uses the grafana image provider but no grafana is configured", rcv.Name)
+	}
+	if rcv.EscalationPolicy != "" && c.GetEscalationPolicy(rcv.EscalationPolicy) == nil {
+		return fmt.Errorf("receiver %q uses unknown escalation policy %q", rcv.Name, rcv.EscalationPolicy)
+	}
+	// 循环 wechat 配置
+	for _, wcc := range rcv.WechatConfigs {
+		if wcc.HTTPConfig == nil {
+			wcc.HTTPConfig = copyHTTPConfig(c.Global.HTTPConfig)
+		}
+		if wcc.APIURL == nil {
+			if c.Global.WeChatAPIURL == nil {
+				return fmt.Errorf("no global Wechat URL set")
 			}
-			if !strings.HasSuffix(wcc.APIURL.Path, "/") {
-				wcc.APIURL.Path += "/"
+			wcc.APIURL = c.Global.WeChatAPIURL
+		}
+		if wcc.APISecret == "" && wcc.APISecretFile == "" {
+			if c.Global.WeChatAPISecret == "" && c.Global.WeChatAPISecretFile == "" {
+				return fmt.Errorf("no global Wechat ApiSecret set")
 			}
+			wcc.APISecret = c.Global.WeChatAPISecret
+			wcc.APISecretFile = c.Global.WeChatAPISecretFile
 		}
-		for _, dtc := range rcv.DingtalkConfigs {
-			if dtc.HTTPConfig == nil {
-				dtc.HTTPConfig = c.Global.HTTPConfig
+		if wcc.CorpID == "" && wcc.CorpIDFile == "" {
+			if c.Global.WeChatAPICorpID == "" && c.Global.WeChatAPICorpIDFile == "" {
+				return fmt.Errorf("no global Wechat CorpID set")
 			}
-			if dtc.APIURL == nil {
-				if c.Global.DingTalkAPIURL == nil {
-					return fmt.Errorf("no global Dingtalk URL set")
-				}
-				dtc.APIURL = c.Global.DingTalkAPIURL
+			wcc.CorpID = c.Global.WeChatAPICorpID
+			wcc.CorpIDFile = c.Global.WeChatAPICorpIDFile
+		}
+		if !strings.HasSuffix(wcc.APIURL.Path, "/") {
+			wcc.APIURL.Path += "/"
+		}
+	}
+	for _, dtc := range rcv.DingtalkConfigs {
+		if dtc.HTTPConfig == nil {
+			dtc.HTTPConfig = copyHTTPConfig(c.Global.HTTPConfig)
+		}
+		if dtc.APIURL == nil {
+			if c.Global.DingTalkAPIURL == nil {
+				return fmt.Errorf("no global Dingtalk URL set")
 			}
-			if dtc.APISecret == "" {
-				if c.Global.DingTalkAPISecret == "" {
-					return fmt.Errorf("no global Dingtalk ApiSecret set")
-				}
-				dtc.APISecret = c.Global.DingTalkAPISecret
+			dtc.APIURL = c.Global.DingTalkAPIURL
+		}
+		if dtc.APISecret == "" && dtc.APISecretFile == "" {
+			if c.Global.DingTalkAPISecret == "" && c.Global.DingTalkAPISecretFile == "" {
+				return fmt.Errorf("no global Dingtalk ApiSecret set")
 			}
-			if dtc.APIToken == "" {
-				if c.Global.DingTalkAPIToken == "" {
-					return fmt.Errorf("no global Dingtalk ApiToken set")
-				}
-				dtc.APIToken = c.Global.DingTalkAPIToken
+			dtc.APISecret = c.Global.DingTalkAPISecret
+			dtc.APISecretFile = c.Global.DingTalkAPISecretFile
+		}
+		if dtc.APIToken == "" && dtc.APITokenFile == "" {
+			if c.Global.DingTalkAPIToken == "" && c.Global.DingTalkAPITokenFile == "" {
+				return fmt.Errorf("no global Dingtalk ApiToken set")
 			}
+			dtc.APIToken = c.Global.DingTalkAPIToken
+			dtc.APITokenFile = c.Global.DingTalkAPITokenFile
 		}
-
-		names[rcv.Name] = struct{}{}
 	}
-
 	return nil
 }
 
@@ -335,6 +544,7 @@ func DefaultGlobalConfig() GlobalConfig {
 	return GlobalConfig{
 		MetricResolution: 100,
 		HTTPConfig:       &defaultHTTPConfig,
+		MentionLabels:    DefaultMentionLabels,
 
 		WeChatAPIURL:   mustParseURL("https://qyapi.weixin.qq.com/cgi-bin/"),
 		DingTalkAPIURL: mustParseURL("https://oapi.dingtalk.com/robot/send"),
@@ -435,23 +645,48 @@ type GlobalConfig struct {
 	ExternalURL      *URL  `yaml:"external_url,omitempty" json:"external_url,omitempty"`
 	MetricResolution int64 `yaml:"metric_resolution,omitempty" json:"metric_resolution,omitempty"`
 	PrometheusURL    *URL  `yaml:"prometheus_url" json:"prometheus_url"` // 配置 prometheus 地址，方便获取监控图表数据
+	// DatasourceLabel 报警中该标签的值与数据源名称相同时，使用该数据源查询图表数据，比如 cluster
+	DatasourceLabel string `yaml:"datasource_label,omitempty" json:"datasource_label,omitempty"`
+	// MentionLabels 报警中这些标签或注解的值为通讯录中的用户或团队名称（多个用逗号分隔）时，通知中会 @ 对应的人员
+	MentionLabels []string `yaml:"mention_labels,omitempty" json:"mention_labels,omitempty"`
 
 	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
 
-	WeChatAPIURL    *URL   `yaml:"wechat_api_url,omitempty" json:"wechat_api_url,omitempty"`
-	WeChatAPISecret Secret `yaml:"wechat_api_secret,omitempty" json:"wechat_api_secret,omitempty"`
-	WeChatAPICorpID Secret `yaml:"wechat_api_corp_id,omitempty" json:"wechat_api_corp_id,omitempty"`
+	WeChatAPIURL        *URL   `yaml:"wechat_api_url,omitempty" json:"wechat_api_url,omitempty"`
+	WeChatAPISecret     Secret `yaml:"wechat_api_secret,omitempty" json:"wechat_api_secret,omitempty"`
+	WeChatAPISecretFile string `yaml:"wechat_api_secret_file,omitempty" json:"wechat_api_secret_file,omitempty"`
+	WeChatAPICorpID     Secret `yaml:"wechat_api_corp_id,omitempty" json:"wechat_api_corp_id,omitempty"`
+	WeChatAPICorpIDFile string `yaml:"wechat_api_corp_id_file,omitempty" json:"wechat_api_corp_id_file,omitempty"`
 
-	DingTalkAPIURL    *URL   `yaml:"dingtalk_api_url,omitempty" json:"dingtalk_api_url,omitempty"`
-	DingTalkAPIToken  Secret `yaml:"dingtalk_api_token,omitempty" json:"dingtalk_api_token,omitempty"`
-	DingTalkAPISecret Secret `yaml:"dingtalk_api_secret,omitempty" json:"dingtalk_api_secret,omitempty"`
+	DingTalkAPIURL        *URL   `yaml:"dingtalk_api_url,omitempty" json:"dingtalk_api_url,omitempty"`
+	DingTalkAPIToken      Secret `yaml:"dingtalk_api_token,omitempty" json:"dingtalk_api_token,omitempty"`
+	DingTalkAPITokenFile  string `yaml:"dingtalk_api_token_file,omitempty" json:"dingtalk_api_token_file,omitempty"`
+	DingTalkAPISecret     Secret `yaml:"dingtalk_api_secret,omitempty" json:"dingtalk_api_secret,omitempty"`
+	DingTalkAPISecretFile string `yaml:"dingtalk_api_secret_file,omitempty" json:"dingtalk_api_secret_file,omitempty"`
 }
 
 // UnmarshalYAML implements the yaml.Unmarshaler interface for GlobalConfig.
 func (c *GlobalConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	*c = DefaultGlobalConfig()
 	type plain GlobalConfig
-	return unmarshal((*plain)(c))
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	for _, s := range []struct {
+		name   string
+		secret Secret
+		file   string
+	}{
+		{"wechat_api_secret", c.WeChatAPISecret, c.WeChatAPISecretFile},
+		{"wechat_api_corp_id", c.WeChatAPICorpID, c.WeChatAPICorpIDFile},
+		{"dingtalk_api_token", c.DingTalkAPIToken, c.DingTalkAPITokenFile},
+		{"dingtalk_api_secret", c.DingTalkAPISecret, c.DingTalkAPISecretFile},
+	} {
+		if err := checkSecretFile(s.name, s.secret, s.file); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Receiver configuration provides configuration on how to contact a receiver.
@@ -462,8 +697,35 @@ type Receiver struct {
 	//EmailConfigs     []*EmailConfig     `yaml:"email_configs,omitempty" json:"email_configs,omitempty"`
 	WechatConfigs   []*WechatConfig   `yaml:"wechat_configs,omitempty" json:"wechat_configs,omitempty"`
 	DingtalkConfigs []*DingtalkConfig `yaml:"dingtalk_configs,omitempty" json:"dingtalk_configs,omitempty"`
+
+	// ImageProvider makes the alert images: prometheus (default), grafana or none.
+	ImageProvider string `yaml:"image_provider,omitempty" json:"image_provider,omitempty"`
+	// EscalationPolicy re-notifies the alerts of the receiver that keep firing.
+	EscalationPolicy string `yaml:"escalation_policy,omitempty" json:"escalation_policy,omitempty"`
+	// PayloadFormat is the format of the received payloads: auto (default),
+	// alertmanager, alertmanager_v2 or grafana.
+	PayloadFormat string `yaml:"payload_format,omitempty" json:"payload_format,omitempty"`
+	// Ingest maps the JSON payloads received on /<receiver>/ingest to alerts.
+	Ingest *IngestConfig `yaml:"ingest,omitempty" json:"ingest,omitempty"`
+	// AggregationWindow buffers the notifications of the receiver and sends
+	// their merged alerts in one message, disabled if zero.
+	AggregationWindow model.Duration `yaml:"aggregation_window,omitempty" json:"aggregation_window,omitempty"`
+	// DedupInterval suppresses the notifications with the same alerts and
+	// statuses already sent within the interval, disabled if zero.
+	DedupInterval model.Duration `yaml:"dedup_interval,omitempty" json:"dedup_interval,omitempty"`
+	// MaintenanceWindows are recurring periods during which the matching
+	// alerts of the receiver are not notified.
+	MaintenanceWindows []*MaintenanceWindowConfig `yaml:"maintenance_windows,omitempty" json:"maintenance_windows,omitempty"`
 }
 
+const imageProviderValidRe = `^(prometheus|grafana|none)$`
+
+var imageProviderMatcher = regexp.MustCompile(imageProviderValidRe)
+
+const payloadFormatValidRe = `^(auto|alertmanager|alertmanager_v2|grafana)$`
+
+var payloadFormatMatcher = regexp.MustCompile(payloadFormatValidRe)
+
 // UnmarshalYAML implements the yaml.Unmarshaler interface for Receiver.
 func (c *Receiver) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	type plain Receiver
@@ -473,6 +735,18 @@ func (c *Receiver) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if c.Name == "" {
 		return fmt.Errorf("missing name in receiver")
 	}
+	if c.ImageProvider == "" {
+		c.ImageProvider = "prometheus"
+	}
+	if !imageProviderMatcher.MatchString(c.ImageProvider) {
+		return fmt.Errorf("image provider %q does not match valid options %s", c.ImageProvider, imageProviderValidRe)
+	}
+	if c.PayloadFormat == "" {
+		c.PayloadFormat = "auto"
+	}
+	if !payloadFormatMatcher.MatchString(c.PayloadFormat) {
+		return fmt.Errorf("payload format %q does not match valid options %s", c.PayloadFormat, payloadFormatValidRe)
+	}
 	return nil
 }
 
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	commoncfg "github.com/prometheus/common/config"
+)
+
+func TestLoadFileInheritedHTTPConfig(t *testing.T) {
+	conf, err := LoadFile("testdata/http_config.yml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs := map[string]*commoncfg.HTTPClientConfig{
+		"global":       conf.Global.HTTPConfig,
+		"datasource":   conf.Datasources[0].HTTPConfig,
+		"grafana":      conf.Grafana.HTTPConfig,
+		"alertmanager": conf.Alertmanager.HTTPConfig,
+		"dingtalk":     conf.Receivers[0].DingtalkConfigs[0].HTTPConfig,
+	}
+	for name, hc := range configs {
+		if hc.TLSConfig.CAFile != "testdata/certs/ca.pem" {
+			t.Errorf("%s: expected ca_file %q, got %q", name, "testdata/certs/ca.pem", hc.TLSConfig.CAFile)
+		}
+		if hc.BasicAuth.PasswordFile != "testdata/secrets/password" {
+			t.Errorf("%s: expected password_file %q, got %q", name, "testdata/secrets/password", hc.BasicAuth.PasswordFile)
+		}
+		if name != "global" && hc.BasicAuth == conf.Global.HTTPConfig.BasicAuth {
+			t.Errorf("%s: basic_auth is shared with the global http_config", name)
+		}
+	}
+}
+
+func TestLoadFileReceiverFiles(t *testing.T) {
+	t.Setenv("PROMOTER_TEST_TEAM_B_TOKEN", "team-b-token")
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"config.yml": `
+global:
+  dingtalk_api_url: http://dingtalk.example.com/robot/send
+  dingtalk_api_token: token
+  dingtalk_api_secret_file: secrets/dingtalk_secret
+receiver_files:
+  - teams/*/receivers.yml
+  - missing/*.yml
+receivers:
+  - name: ops
+    dingtalk_configs:
+      - message_type: markdown
+`,
+		"secrets/dingtalk_secret": "secret",
+		"teams/a/receivers.yml": `
+receivers:
+  - name: team-a
+    dingtalk_configs:
+      - message_type: markdown
+        api_token_file: secrets/token
+`,
+		"teams/a/secrets/token": "team-a-token",
+		"teams/b/receivers.yml": `
+receivers:
+  - name: team-b
+    dingtalk_configs:
+      - message_type: markdown
+        api_token: ${PROMOTER_TEST_TEAM_B_TOKEN}
+  - name: team-b-oncall
+    dingtalk_configs:
+      - message_type: actionCard
+`,
+	})
+
+	conf, err := LoadFile(filepath.Join(dir, "config.yml"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, rcv := range conf.Receivers {
+		names = append(names, rcv.Name)
+	}
+	if expected := []string{"ops", "team-a", "team-b", "team-b-oncall"}; strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected receivers %v, got %v", expected, names)
+	}
+
+	teamA := conf.GetReceiver("team-a").DingtalkConfigs[0]
+	// 片段中的相对路径相对于片段所在目录，未设置的配置继承 global
+	if teamA.APITokenFile != filepath.Join(dir, "teams/a/secrets/token") || teamA.APIToken != "team-a-token" {
+		t.Fatalf("expected the token of team-a to be read from its directory, got %q from %q", teamA.APIToken, teamA.APITokenFile)
+	}
+	if teamA.APISecret != "secret" || teamA.APIURL.String() != "http://dingtalk.example.com/robot/send" {
+		t.Fatalf("expected team-a to inherit the global settings, got %q and %s", teamA.APISecret, teamA.APIURL)
+	}
+	if teamA.HTTPConfig == nil || teamA.HTTPConfig == conf.Global.HTTPConfig {
+		t.Fatal("expected team-a to get a copy of the global http_config")
+	}
+	if token := conf.GetReceiver("team-b").DingtalkConfigs[0].APIToken; token != "team-b-token" {
+		t.Fatalf("expected the environment to be expanded in receiver files, got %q", token)
+	}
+}
+
+func TestLoadFileReceiverFilesInvalid(t *testing.T) {
+	const main = `
+global:
+  dingtalk_api_url: http://dingtalk.example.com/robot/send
+  dingtalk_api_token: token
+  dingtalk_api_secret: secret
+receiver_files: [teams/*.yml]
+receivers:
+  - name: ops
+    dingtalk_configs:
+      - message_type: markdown
+`
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{
+			name:  "name defined in the main configuration",
+			files: map[string]string{"teams/a.yml": "receivers: [{name: ops}]"},
+			err:   `notification config name "ops" is not unique, already defined in main configuration`,
+		},
+		{
+			name: "name defined in another file",
+			files: map[string]string{
+				"teams/a.yml": "receivers: [{name: team}]",
+				"teams/b.yml": "receivers: [{name: team}]",
+			},
+			err: `teams/b.yml: notification config name "team" is not unique, already defined in `,
+		},
+		{
+			name:  "other sections",
+			files: map[string]string{"teams/a.yml": "global: {}\nreceivers: [{name: team}]"},
+			err:   "teams/a.yml: yaml: unmarshal errors",
+		},
+		{
+			name:  "unknown escalation policy",
+			files: map[string]string{"teams/a.yml": "receivers: [{name: team, escalation_policy: missing}]"},
+			err:   `teams/a.yml: receiver "team" uses unknown escalation policy "missing"`,
+		},
+		{
+			name:  "unset variable",
+			files: map[string]string{"teams/a.yml": "receivers: [{name: '${PROMOTER_TEST_UNSET}'}]"},
+			err:   "teams/a.yml: environment variables not set: PROMOTER_TEST_UNSET",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tc.files["config.yml"] = main
+			writeTestFiles(t, dir, tc.files)
+			_, err := LoadFile(filepath.Join(dir, "config.yml"), true)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+
+	commoncfg "github.com/prometheus/common/config"
+)
+
+// DatasourceConfig configures a Prometheus-compatible query API (Prometheus,
+// Thanos, VictoriaMetrics, Mimir, ...) used to render alert images.
+type DatasourceConfig struct {
+	// A unique identifier for this datasource.
+	Name string `yaml:"name" json:"name"`
+	// URL is the base URL of the query API, including any path prefix
+	// (e.g. http://mimir/prometheus).
+	URL        *URL                        `yaml:"url" json:"url"`
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+	// Headers are added to every query request, e.g. X-Scope-OrgID for multi-tenant backends.
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+
+	// MatchRE selects this datasource for alerts whose labels match all regexps.
+	MatchRE MatchRegexps `yaml:"match_re,omitempty" json:"match_re,omitempty"`
+	// GeneratorHosts selects this datasource for alerts whose generatorURL
+	// points to one of the hosts. The host of URL always matches.
+	GeneratorHosts []string `yaml:"generator_hosts,omitempty" json:"generator_hosts,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for DatasourceConfig.
+func (c *DatasourceConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain DatasourceConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Name == "" {
+		return fmt.Errorf("missing name in datasource")
+	}
+	if c.URL == nil {
+		return fmt.Errorf("missing url in datasource %q", c.Name)
+	}
+	return nil
+}
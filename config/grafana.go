@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+
+	commoncfg "github.com/prometheus/common/config"
+)
+
+// DefaultGrafanaConfig defines default values for Grafana panel rendering.
+var DefaultGrafanaConfig = GrafanaConfig{
+	OrgID:  1,
+	Width:  1000,
+	Height: 500,
+	Theme:  "light",
+}
+
+// GrafanaConfig configures rendering alert images from Grafana panels through
+// the /render/d-solo API.
+type GrafanaConfig struct {
+	URL        *URL                        `yaml:"url" json:"url"`
+	APIKey     Secret                      `yaml:"api_key,omitempty" json:"api_key,omitempty"`
+	APIKeyFile string                      `yaml:"api_key_file,omitempty" json:"api_key_file,omitempty"`
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+
+	OrgID int `yaml:"org_id,omitempty" json:"org_id,omitempty"`
+	// Width and Height of the rendered panel in pixels.
+	Width    int    `yaml:"width,omitempty" json:"width,omitempty"`
+	Height   int    `yaml:"height,omitempty" json:"height,omitempty"`
+	Theme    string `yaml:"theme,omitempty" json:"theme,omitempty"`
+	Timezone string `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	// VarLabels are the alert labels passed to the dashboard as var-<label> variables.
+	VarLabels []string `yaml:"var_labels,omitempty" json:"var_labels,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for GrafanaConfig.
+func (c *GrafanaConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultGrafanaConfig
+	type plain GrafanaConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.URL == nil {
+		return fmt.Errorf("missing url in grafana config")
+	}
+	if !plotThemeMatcher.MatchString(c.Theme) {
+		return fmt.Errorf("grafana theme %q does not match valid options %s", c.Theme, plotValidThemesRe)
+	}
+	return checkSecretFile("api_key", c.APIKey, c.APIKeyFile)
+}
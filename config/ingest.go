@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	tmpltext "text/template"
+
+	"github.com/cnych/promoter/template"
+)
+
+// IngestConfig maps the arbitrary JSON payloads received on
+// /<receiver>/ingest to alerts. All fields except Alerts are Go templates
+// executed with the decoded JSON of an alert.
+type IngestConfig struct {
+	// Alerts is the dotted path of the list of alerts in the payload
+	// (e.g. data.events), every element becomes an alert. The whole payload
+	// is a single alert if empty.
+	Alerts string `yaml:"alerts,omitempty" json:"alerts,omitempty"`
+
+	Labels      map[string]string `yaml:"labels" json:"labels"`
+	Annotations map[string]string `yaml:"annotations,omitempty" json:"annotations,omitempty"`
+	// Status must render to firing or resolved, alerts are firing if empty.
+	Status       string `yaml:"status,omitempty" json:"status,omitempty"`
+	StartsAt     string `yaml:"starts_at,omitempty" json:"starts_at,omitempty"`
+	EndsAt       string `yaml:"ends_at,omitempty" json:"ends_at,omitempty"`
+	GeneratorURL string `yaml:"generator_url,omitempty" json:"generator_url,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for IngestConfig.
+func (c *IngestConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain IngestConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if len(c.Labels) == 0 {
+		return fmt.Errorf("missing labels in ingest config")
+	}
+	return c.checkTemplates()
+}
+
+// checkTemplates parses the templates, so that an invalid one rejects the
+// configuration instead of disabling the ingest endpoint.
+func (c *IngestConfig) checkTemplates() error {
+	texts := map[string]string{
+		"status":        c.Status,
+		"starts_at":     c.StartsAt,
+		"ends_at":       c.EndsAt,
+		"generator_url": c.GeneratorURL,
+	}
+	for name, text := range c.Labels {
+		texts["labels."+name] = text
+	}
+	for name, text := range c.Annotations {
+		texts["annotations."+name] = text
+	}
+	for name, text := range texts {
+		if _, err := tmpltext.New(name).Funcs(tmpltext.FuncMap(template.DefaultFuncs)).Parse(text); err != nil {
+			return fmt.Errorf("invalid ingest template %s: %v", name, err)
+		}
+	}
+	return nil
+}
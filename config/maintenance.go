@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cnych/promoter/labels"
+	"github.com/prometheus/common/model"
+	"github.com/robfig/cron/v3"
+)
+
+// MaintenanceWindowConfig is a recurring period during which the matching
+// alerts of a receiver are not notified, e.g. the weekly release window.
+type MaintenanceWindowConfig struct {
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Schedule is the cron expression of the start of the window, such as
+	// "0 2 * * 6" for every Saturday at 02:00.
+	Schedule string         `yaml:"schedule" json:"schedule"`
+	Duration model.Duration `yaml:"duration" json:"duration"`
+	// Timezone of the schedule, defaults to the local timezone.
+	Timezone string `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	// Matchers select the muted alerts, all alerts if empty.
+	Matchers labels.Matchers `yaml:"matchers,omitempty" json:"matchers,omitempty"`
+
+	schedule cron.Schedule
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for MaintenanceWindowConfig.
+func (c *MaintenanceWindowConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain MaintenanceWindowConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Schedule == "" {
+		return fmt.Errorf("missing schedule in maintenance window %q", c.Name)
+	}
+	if c.Duration <= 0 {
+		return fmt.Errorf("maintenance window %q must have a positive duration", c.Name)
+	}
+
+	spec := c.Schedule
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q in maintenance window %q: %v", c.Timezone, c.Name, err)
+		}
+		spec = "CRON_TZ=" + c.Timezone + " " + spec
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q in maintenance window %q: %v", c.Schedule, c.Name, err)
+	}
+	c.schedule = schedule
+	return nil
+}
+
+// Active reports whether the time is within an occurrence of the window.
+func (c *MaintenanceWindowConfig) Active(t time.Time) bool {
+	if c.schedule == nil {
+		return false
+	}
+	// 窗口在 (t-duration, t] 之间开始时 t 处于窗口内
+	start := c.schedule.Next(t.Add(-time.Duration(c.Duration)))
+	return !start.IsZero() && !start.After(t)
+}
+
+// Mutes reports whether the window is active and the labels match.
+func (c *MaintenanceWindowConfig) Mutes(lset map[string]string, t time.Time) bool {
+	return c.Active(t) && c.Matchers.Matches(lset)
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("timezone database not available: %v", err)
+	}
+	var w MaintenanceWindowConfig
+	if err := yaml.UnmarshalStrict([]byte(`
+name: release
+schedule: "0 2 * * 6"
+duration: 2h
+timezone: Asia/Shanghai
+matchers: ['severity!="critical"']
+`), &w); err != nil {
+		t.Fatal(err)
+	}
+	// 2026-10-17 是周六
+	start := time.Date(2026, 10, 17, 2, 0, 0, 0, shanghai)
+
+	for _, tc := range []struct {
+		name   string
+		t      time.Time
+		active bool
+	}{
+		{name: "before the start", t: start.Add(-time.Nanosecond)},
+		{name: "at the start", t: start, active: true},
+		{name: "within", t: start.Add(time.Hour), active: true},
+		{name: "just before the end", t: start.Add(2*time.Hour - time.Nanosecond), active: true},
+		{name: "at the end", t: start.Add(2 * time.Hour)},
+		{name: "same instant in UTC", t: start.Add(time.Hour).UTC(), active: true},
+		// CRON_TZ 使用窗口的时区，而不是 t 的时区
+		{name: "02:00 UTC", t: time.Date(2026, 10, 17, 2, 30, 0, 0, time.UTC)},
+		{name: "another weekday", t: start.AddDate(0, 0, 1).Add(time.Hour)},
+		{name: "next week", t: start.AddDate(0, 0, 7).Add(time.Hour), active: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if active := w.Active(tc.t); active != tc.active {
+				t.Fatalf("expected active %v at %s, got %v", tc.active, tc.t, active)
+			}
+		})
+	}
+
+	if !w.Mutes(map[string]string{"severity": "warning"}, start) {
+		t.Fatal("expected the warning alert to be muted")
+	}
+	if w.Mutes(map[string]string{"severity": "critical"}, start) {
+		t.Fatal("expected the critical alert not to be muted")
+	}
+	if w.Mutes(map[string]string{"severity": "warning"}, start.Add(-time.Minute)) {
+		t.Fatal("expected no alert to be muted outside the window")
+	}
+}
+
+func TestMaintenanceWindowSpanningMidnight(t *testing.T) {
+	var w MaintenanceWindowConfig
+	if err := yaml.UnmarshalStrict([]byte(`
+schedule: "0 23 * * *"
+duration: 3h
+timezone: UTC
+`), &w); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		t      time.Time
+		active bool
+	}{
+		{t: time.Date(2026, 10, 17, 22, 59, 0, 0, time.UTC)},
+		{t: time.Date(2026, 10, 17, 23, 30, 0, 0, time.UTC), active: true},
+		{t: time.Date(2026, 10, 18, 1, 59, 0, 0, time.UTC), active: true},
+		{t: time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)},
+	} {
+		if active := w.Active(tc.t); active != tc.active {
+			t.Errorf("expected active %v at %s, got %v", tc.active, tc.t, active)
+		}
+	}
+	if !w.Mutes(map[string]string{"alertname": "Down"}, time.Date(2026, 10, 17, 23, 30, 0, 0, time.UTC)) {
+		t.Fatal("expected a window without matchers to mute all alerts")
+	}
+}
+
+func TestMaintenanceWindowInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+	}{
+		{name: "missing schedule", in: `duration: 1h`},
+		{name: "no duration", in: `schedule: "0 2 * * 6"`},
+		{name: "negative duration", in: "schedule: \"0 2 * * 6\"\nduration: -1h"},
+		{name: "invalid schedule", in: "schedule: \"0 2 * *\"\nduration: 1h"},
+		{name: "invalid timezone", in: "schedule: \"0 2 * * 6\"\nduration: 1h\ntimezone: Mars/Olympus"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var w MaintenanceWindowConfig
+			if err := yaml.UnmarshalStrict([]byte(tc.in), &w); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
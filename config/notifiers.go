@@ -10,6 +10,9 @@ import (
 var (
 	// DefaultWechatConfig defines default values for wechat configurations.
 	DefaultWechatConfig = WechatConfig{
+		NotifierConfig: NotifierConfig{
+			VSendResolved: true,
+		},
 		Message: `{{ template "wechat.default.message" . }}`,
 		ToUser:  `{{ template "wechat.default.to_user" . }}`,
 		ToParty: `{{ template "wechat.default.to_party" . }}`,
@@ -18,20 +21,45 @@ var (
 	}
 	// DefaultDingtalkConfig ......
 	DefaultDingtalkConfig = DingtalkConfig{
+		NotifierConfig: NotifierConfig{
+			VSendResolved: true,
+		},
 		Markdown: &DingtalkMarkdown{
 			Title: `{{ template "dingtalk.default.title" . }}`,
 			Text:  `{{ template "dingtalk.default.content" . }}`,
 		},
+		ActionCard: &DingtalkActionCard{
+			Title:          `{{ template "dingtalk.default.title" . }}`,
+			Text:           `{{ template "dingtalk.default.content" . }}`,
+			BtnOrientation: "1",
+		},
 	}
 )
 
+// NotifierConfig contains base options common across all notifier configurations.
+type NotifierConfig struct {
+	// VSendResolved 为 false 时不发送已恢复的报警
+	VSendResolved bool `yaml:"send_resolved" json:"send_resolved"`
+	// Matchers 只发送所有标签都匹配的报警，标签不存在时按空字符串匹配
+	Matchers MatchRegexps `yaml:"matchers,omitempty" json:"matchers,omitempty"`
+}
+
+// SendResolved reports whether resolved alerts are sent.
+func (nc *NotifierConfig) SendResolved() bool {
+	return nc.VSendResolved
+}
+
 // WechatConfig configures notifications via Wechat.
 type WechatConfig struct {
-	//NotifierConfig `yaml:",inline" json:",inline"`
+	NotifierConfig `yaml:",inline" json:",inline"`
+
 	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
 
-	APISecret    Secret              `yaml:"api_secret,omitempty" json:"api_secret,omitempty"`
-	CorpID       Secret              `yaml:"corp_id,omitempty" json:"corp_id,omitempty"`
+	APISecret     Secret `yaml:"api_secret,omitempty" json:"api_secret,omitempty"`
+	APISecretFile string `yaml:"api_secret_file,omitempty" json:"api_secret_file,omitempty"`
+	CorpID        Secret `yaml:"corp_id,omitempty" json:"corp_id,omitempty"`
+	CorpIDFile    string `yaml:"corp_id_file,omitempty" json:"corp_id_file,omitempty"`
+
 	Message      string              `yaml:"message,omitempty" json:"message,omitempty"`
 	TemplateCard *WechatTemplateCard `yaml:"template_card,omitempty" json:"template_card,omitempty"`
 	APIURL       *URL                `yaml:"api_url,omitempty" json:"api_url,omitempty"`
@@ -68,29 +96,49 @@ func (c *WechatConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return errors.Errorf("WeChat message type %q does not match valid options %s", c.MessageType, wechatValidTypesRe)
 	}
 
-	return nil
+	if c.MessageType == "template_card" && c.TemplateCard == nil {
+		return errors.Errorf("WeChat message type template_card requires template_card")
+	}
+
+	if err := checkSecretFile("api_secret", c.APISecret, c.APISecretFile); err != nil {
+		return err
+	}
+	return checkSecretFile("corp_id", c.CorpID, c.CorpIDFile)
 }
 
 type DingtalkConfig struct {
-	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
+	NotifierConfig `yaml:",inline" json:",inline"`
 
-	APISecret Secret `yaml:"api_secret,omitempty" json:"api_secret,omitempty"`
-	APIToken  Secret `yaml:"api_token,omitempty" json:"api_token,omitempty"`
-	APIURL    *URL   `yaml:"api_url,omitempty" json:"api_url,omitempty"`
+	HTTPConfig *commoncfg.HTTPClientConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
 
-	Text        *DingtalkText     `yaml:"text,omitempty" json:"text,omitempty"`
-	Markdown    *DingtalkMarkdown `yaml:"markdown,omitempty" json:"markdown,omitempty"`
-	At          *DingtalkAt       `yaml:"at,omitempty" json:"at,omitempty"`
-	MessageType string            `yaml:"message_type,omitempty" json:"message_type,omitempty"`
+	APISecret     Secret `yaml:"api_secret,omitempty" json:"api_secret,omitempty"`
+	APISecretFile string `yaml:"api_secret_file,omitempty" json:"api_secret_file,omitempty"`
+	APIToken      Secret `yaml:"api_token,omitempty" json:"api_token,omitempty"`
+	APITokenFile  string `yaml:"api_token_file,omitempty" json:"api_token_file,omitempty"`
+	APIURL        *URL   `yaml:"api_url,omitempty" json:"api_url,omitempty"`
+
+	Text     *DingtalkText     `yaml:"text,omitempty" json:"text,omitempty"`
+	Markdown *DingtalkMarkdown `yaml:"markdown,omitempty" json:"markdown,omitempty"`
+	// ActionCard is the message of the actionCard type, its buttons link to
+	// the actions of the notification.
+	ActionCard  *DingtalkActionCard `yaml:"action_card,omitempty" json:"action_card,omitempty"`
+	At          *DingtalkAt         `yaml:"at,omitempty" json:"at,omitempty"`
+	MessageType string              `yaml:"message_type,omitempty" json:"message_type,omitempty"`
 }
 
-const dingtalkValidTypesRe = `^(text|markdown)$`
+const dingtalkValidTypesRe = `^(text|markdown|actionCard)$`
 
 var dingtalkTypeMatcher = regexp.MustCompile(dingtalkValidTypesRe)
 
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
 func (c *DingtalkConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	*c = DefaultDingtalkConfig
+	// 拷贝默认的 markdown 和 action_card 配置，避免多个接收器的配置共享同一个指针，
+	// 修改其中一个时影响其他接收器和默认配置
+	markdown := *DefaultDingtalkConfig.Markdown
+	c.Markdown = &markdown
+	actionCard := *DefaultDingtalkConfig.ActionCard
+	c.ActionCard = &actionCard
 	type plain DingtalkConfig
 	if err := unmarshal((*plain)(c)); err != nil {
 		return err
@@ -104,7 +152,18 @@ func (c *DingtalkConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 		return errors.Errorf("Dingtalk message type %q does not match valid options %s", c.MessageType, dingtalkValidTypesRe)
 	}
 
-	return nil
+	if c.MessageType == "markdown" && c.Markdown == nil {
+		return errors.Errorf("Dingtalk message type markdown requires markdown")
+	}
+
+	if c.MessageType == "actionCard" && c.ActionCard == nil {
+		return errors.Errorf("Dingtalk message type actionCard requires action_card")
+	}
+
+	if err := checkSecretFile("api_secret", c.APISecret, c.APISecretFile); err != nil {
+		return err
+	}
+	return checkSecretFile("api_token", c.APIToken, c.APITokenFile)
 }
 
 type DingtalkText struct {
@@ -117,6 +176,14 @@ type DingtalkMarkdown struct {
 	Text  string `yaml:"text" json:"text"`
 }
 
+type DingtalkActionCard struct {
+	Title string `yaml:"title" json:"title"`
+	Text  string `yaml:"text" json:"text"`
+	// BtnOrientation is 0 to stack the buttons vertically, 1 to lay them out
+	// horizontally.
+	BtnOrientation string `yaml:"btn_orientation,omitempty" json:"btn_orientation,omitempty"`
+}
+
 type DingtalkAt struct {
 	AtMobiles []string `yaml:"atMobiles" json:"atMobiles,omitempty"`
 	IsAtAll   bool     `yaml:"isAtAll" json:"isAtAll,omitempty"`
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	scheduleDateFormat     = "2006-01-02"
+	scheduleTimeFormat     = "15:04"
+	scheduleDateTimeFormat = "2006-01-02 15:04"
+
+	rotationValidTypesRe = `^(daily|weekly)$`
+)
+
+var rotationTypeMatcher = regexp.MustCompile(rotationValidTypesRe)
+
+// DefaultRotationConfig defines default values for rotations.
+var DefaultRotationConfig = RotationConfig{
+	Type:     "weekly",
+	Length:   1,
+	Handover: "09:00",
+}
+
+// ScheduleConfig is an on-call schedule made of rotations. Its name can be
+// used like a user or team name to mention whoever is currently on call.
+type ScheduleConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// Timezone of the handover and override times, defaults to the local timezone.
+	Timezone  string            `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	Rotations []*RotationConfig `yaml:"rotations" json:"rotations"`
+	Overrides []*OverrideConfig `yaml:"overrides,omitempty" json:"overrides,omitempty"`
+
+	location *time.Location
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for ScheduleConfig.
+func (c *ScheduleConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain ScheduleConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Name == "" {
+		return fmt.Errorf("missing name in schedule config")
+	}
+	if strings.Contains(c.Name, "/") {
+		return fmt.Errorf("schedule name %q must not contain /", c.Name)
+	}
+	if len(c.Rotations) == 0 {
+		return fmt.Errorf("schedule %q has no rotations", c.Name)
+	}
+
+	c.location = time.Local
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %q in schedule %q: %v", c.Timezone, c.Name, err)
+		}
+		c.location = loc
+	}
+
+	rotations := map[string]struct{}{}
+	for _, r := range c.Rotations {
+		if _, ok := rotations[r.Name]; ok {
+			return fmt.Errorf("rotation name %q is not unique in schedule %q", r.Name, c.Name)
+		}
+		rotations[r.Name] = struct{}{}
+
+		start, err := time.ParseInLocation(scheduleDateTimeFormat, r.Start+" "+r.Handover, c.location)
+		if err != nil {
+			return fmt.Errorf("invalid start %q or handover %q of rotation %q: %v", r.Start, r.Handover, r.Name, err)
+		}
+		r.start = start
+	}
+
+	for _, o := range c.Overrides {
+		if o.Rotation == "" {
+			o.Rotation = c.Rotations[0].Name
+		}
+		if _, ok := rotations[o.Rotation]; !ok {
+			return fmt.Errorf("override of schedule %q references unknown rotation %q", c.Name, o.Rotation)
+		}
+		start, err := time.ParseInLocation(scheduleDateTimeFormat, o.Start, c.location)
+		if err != nil {
+			return fmt.Errorf("invalid override start %q in schedule %q: %v", o.Start, c.Name, err)
+		}
+		end, err := time.ParseInLocation(scheduleDateTimeFormat, o.End, c.location)
+		if err != nil {
+			return fmt.Errorf("invalid override end %q in schedule %q: %v", o.End, c.Name, err)
+		}
+		if !end.After(start) {
+			return fmt.Errorf("override end %q must be after start %q in schedule %q", o.End, o.Start, c.Name)
+		}
+		o.start, o.end = start, end
+	}
+	return nil
+}
+
+// rotation returns the rotation with the given name.
+func (c *ScheduleConfig) rotation(name string) *RotationConfig {
+	for _, r := range c.Rotations {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Location returns the timezone of the schedule.
+func (c *ScheduleConfig) Location() *time.Location {
+	if c.location == nil {
+		return time.Local
+	}
+	return c.location
+}
+
+// RotationConfig rotates the on-call duty between its members, handing over
+// every Length days or weeks at the handover time.
+type RotationConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// Type is either daily or weekly.
+	Type   string `yaml:"type,omitempty" json:"type,omitempty"`
+	Length int    `yaml:"length,omitempty" json:"length,omitempty"`
+	// Start is the date (2006-01-02) the first member's shift begins, weekly
+	// rotations hand over on the same weekday.
+	Start string `yaml:"start" json:"start"`
+	// Handover is the time of day (15:04) shifts begin.
+	Handover string   `yaml:"handover,omitempty" json:"handover,omitempty"`
+	Members  []string `yaml:"members" json:"members"`
+
+	start time.Time
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for RotationConfig.
+func (c *RotationConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultRotationConfig
+	type plain RotationConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Name == "" {
+		return fmt.Errorf("missing name in rotation config")
+	}
+	if !rotationTypeMatcher.MatchString(c.Type) {
+		return fmt.Errorf("rotation type %q does not match valid options %s", c.Type, rotationValidTypesRe)
+	}
+	if c.Length <= 0 {
+		return fmt.Errorf("rotation length must be positive")
+	}
+	if len(c.Members) == 0 {
+		return fmt.Errorf("rotation %q has no members", c.Name)
+	}
+	if _, err := time.Parse(scheduleDateFormat, c.Start); err != nil {
+		return fmt.Errorf("invalid rotation start %q: %v", c.Start, err)
+	}
+	if _, err := time.Parse(scheduleTimeFormat, c.Handover); err != nil {
+		return fmt.Errorf("invalid rotation handover %q: %v", c.Handover, err)
+	}
+	return nil
+}
+
+// StartTime returns the beginning of the first shift.
+func (c *RotationConfig) StartTime() time.Time {
+	return c.start
+}
+
+// ShiftDays returns the length of a shift in days.
+func (c *RotationConfig) ShiftDays() int {
+	if c.Type == "daily" {
+		return c.Length
+	}
+	return 7 * c.Length
+}
+
+// OverrideConfig puts a user on call for a rotation between two times, e.g.
+// when the regular member is on leave.
+type OverrideConfig struct {
+	// Rotation defaults to the first rotation of the schedule.
+	Rotation string `yaml:"rotation,omitempty" json:"rotation,omitempty"`
+	User     string `yaml:"user" json:"user"`
+	// Start and End are local times (2006-01-02 15:04) of the schedule.
+	Start string `yaml:"start" json:"start"`
+	End   string `yaml:"end" json:"end"`
+
+	start, end time.Time
+}
+
+// StartTime returns the beginning of the override.
+func (c *OverrideConfig) StartTime() time.Time {
+	return c.start
+}
+
+// EndTime returns the end of the override.
+func (c *OverrideConfig) EndTime() time.Time {
+	return c.end
+}
+
+// EscalationPolicyConfig re-notifies more people about alerts of receivers
+// using the policy while they keep firing.
+type EscalationPolicyConfig struct {
+	Name  string                  `yaml:"name" json:"name"`
+	Steps []*EscalationStepConfig `yaml:"steps" json:"steps"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for EscalationPolicyConfig.
+func (c *EscalationPolicyConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain EscalationPolicyConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Name == "" {
+		return fmt.Errorf("missing name in escalation policy config")
+	}
+	if len(c.Steps) == 0 {
+		return fmt.Errorf("escalation policy %q has no steps", c.Name)
+	}
+	for i := 1; i < len(c.Steps); i++ {
+		if c.Steps[i].After <= c.Steps[i-1].After {
+			return fmt.Errorf("steps of escalation policy %q must be in increasing order of after", c.Name)
+		}
+	}
+	return nil
+}
+
+// EscalationStepConfig notifies the targets once an alert has been firing for
+// the given duration.
+type EscalationStepConfig struct {
+	After model.Duration `yaml:"after" json:"after"`
+	// Targets are user, team or schedule names, schedule/rotation targets a
+	// single rotation of a schedule.
+	Targets []string `yaml:"targets" json:"targets"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for EscalationStepConfig.
+func (c *EscalationStepConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain EscalationStepConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.After <= 0 {
+		return fmt.Errorf("escalation step after must be positive")
+	}
+	if len(c.Targets) == 0 {
+		return fmt.Errorf("escalation step has no targets")
+	}
+	return nil
+}
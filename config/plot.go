@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gonum.org/v1/plot/palette/brewer"
+)
+
+// PlotPaletteSize is the number of colors of the palette the series lines
+// cycle through.
+const PlotPaletteSize = 8
+
+// DefaultPlotConfig defines default values for alert image rendering.
+var DefaultPlotConfig = PlotConfig{
+	Width:           20,
+	Height:          10,
+	DPI:             96,
+	Theme:           "light",
+	TimeFormat:      "15:04:05",
+	Palette:         "Dark2",
+	LegendPosition:  "top-right",
+	Format:          "png",
+	TimeAlignment:   model.Duration(time.Minute),
+	CacheTTL:        model.Duration(5 * time.Minute),
+	Concurrency:     4,
+	Timeout:         model.Duration(10 * time.Second),
+	GroupImages:     true,
+	MaxSeries:       8,
+	SeriesOrder:     "auto",
+	Others:          "avg",
+	IgnoreLabels:    []string{"alertname", "severity"},
+	Lookback:        model.Duration(15 * time.Minute),
+	ResolvedPadding: model.Duration(5 * time.Minute),
+	MinRange:        model.Duration(20 * time.Minute),
+	MaxRange:        model.Duration(6 * time.Hour),
+}
+
+const (
+	plotValidThemesRe  = `^(light|dark)$`
+	plotValidFormatsRe = `^(png|svg)$`
+	plotValidLegendRe  = `^(top-right|top-left|bottom-right|bottom-left|none)$`
+	plotValidOrderRe   = `^(auto|top|bottom)$`
+	plotValidOthersRe  = `^(sum|avg|max|none)$`
+)
+
+var (
+	plotThemeMatcher  = regexp.MustCompile(plotValidThemesRe)
+	plotFormatMatcher = regexp.MustCompile(plotValidFormatsRe)
+	plotLegendMatcher = regexp.MustCompile(plotValidLegendRe)
+	plotOrderMatcher  = regexp.MustCompile(plotValidOrderRe)
+	plotOthersMatcher = regexp.MustCompile(plotValidOthersRe)
+	hexColorMatcher   = regexp.MustCompile(`^#([0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+)
+
+// PlotConfig configures how alert images are rendered.
+type PlotConfig struct {
+	// Width and Height of the image in centimeters.
+	Width  float64 `yaml:"width,omitempty" json:"width,omitempty"`
+	Height float64 `yaml:"height,omitempty" json:"height,omitempty"`
+	DPI    int     `yaml:"dpi,omitempty" json:"dpi,omitempty"`
+	// Theme is either light or dark.
+	Theme string `yaml:"theme,omitempty" json:"theme,omitempty"`
+	// FontFile is a TTF font used for all texts of png images, e.g. a CJK font
+	// so that Chinese metric names are rendered properly.
+	FontFile string `yaml:"font_file,omitempty" json:"font_file,omitempty"`
+	// Timezone of the time axis, e.g. Asia/Shanghai. Defaults to the local timezone.
+	Timezone   string `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	TimeFormat string `yaml:"time_format,omitempty" json:"time_format,omitempty"`
+	// Palette is the name of a ColorBrewer palette used for the series lines.
+	Palette string `yaml:"palette,omitempty" json:"palette,omitempty"`
+	// ThresholdColor is the #RRGGBB[AA] color of the threshold area.
+	ThresholdColor string `yaml:"threshold_color,omitempty" json:"threshold_color,omitempty"`
+	LegendPosition string `yaml:"legend_position,omitempty" json:"legend_position,omitempty"`
+	// Format is either png or svg.
+	Format string `yaml:"format,omitempty" json:"format,omitempty"`
+
+	// TimeAlignment truncates the end of the query window so that repeated
+	// notifications of the same alert share query results and images.
+	TimeAlignment model.Duration `yaml:"time_alignment,omitempty" json:"time_alignment,omitempty"`
+	// CacheTTL is how long query results and uploaded images are reused, 0 disables caching.
+	CacheTTL model.Duration `yaml:"cache_ttl,omitempty" json:"cache_ttl,omitempty"`
+	// Concurrency is the maximum number of images generated at the same time.
+	Concurrency int `yaml:"concurrency,omitempty" json:"concurrency,omitempty"`
+	// Timeout bounds the generation of all images of a notification, the
+	// notification is sent with the images ready by then. 0 means no timeout.
+	Timeout model.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+
+	// Lookback is how long before the alert started the chart begins.
+	Lookback model.Duration `yaml:"lookback,omitempty" json:"lookback,omitempty"`
+	// ResolvedPadding is how long after a resolved alert ended the chart ends.
+	ResolvedPadding model.Duration `yaml:"resolved_padding,omitempty" json:"resolved_padding,omitempty"`
+	// MinRange and MaxRange bound the time range of the chart, a zero
+	// MaxRange means no upper bound.
+	MinRange model.Duration `yaml:"min_range,omitempty" json:"min_range,omitempty"`
+	MaxRange model.Duration `yaml:"max_range,omitempty" json:"max_range,omitempty"`
+
+	// IgnoreLabels are the alert labels not used to find the alert's series.
+	IgnoreLabels []string `yaml:"ignore_labels,omitempty" json:"ignore_labels,omitempty"`
+	// GroupImages draws a single chart for all alerts of a notification
+	// sharing the same expression instead of one chart per alert. It is not
+	// omitted when false, as it defaults to true.
+	GroupImages bool `yaml:"group_images" json:"group_images"`
+	// MaxSeries limits the number of series drawn, 0 means no limit.
+	MaxSeries int `yaml:"max_series,omitempty" json:"max_series,omitempty"`
+	// SeriesOrder keeps the top or bottom series by peak value, auto follows
+	// the direction of the alert threshold.
+	SeriesOrder string `yaml:"series_order,omitempty" json:"series_order,omitempty"`
+	// Others aggregates the dropped series into one line with sum, avg or
+	// max, none drops them.
+	Others string `yaml:"others,omitempty" json:"others,omitempty"`
+
+	location *time.Location
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for PlotConfig.
+func (c *PlotConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultPlotConfig
+	type plain PlotConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return c.validate()
+}
+
+func (c *PlotConfig) validate() error {
+	if c.Width <= 0 || c.Height <= 0 {
+		return fmt.Errorf("plot width and height must be positive")
+	}
+	if c.DPI <= 0 {
+		return fmt.Errorf("plot dpi must be positive")
+	}
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("plot concurrency must be positive")
+	}
+	if !plotThemeMatcher.MatchString(c.Theme) {
+		return fmt.Errorf("plot theme %q does not match valid options %s", c.Theme, plotValidThemesRe)
+	}
+	if !plotFormatMatcher.MatchString(c.Format) {
+		return fmt.Errorf("plot format %q does not match valid options %s", c.Format, plotValidFormatsRe)
+	}
+	if !plotLegendMatcher.MatchString(c.LegendPosition) {
+		return fmt.Errorf("plot legend position %q does not match valid options %s", c.LegendPosition, plotValidLegendRe)
+	}
+	if !plotOrderMatcher.MatchString(c.SeriesOrder) {
+		return fmt.Errorf("plot series order %q does not match valid options %s", c.SeriesOrder, plotValidOrderRe)
+	}
+	if !plotOthersMatcher.MatchString(c.Others) {
+		return fmt.Errorf("plot others %q does not match valid options %s", c.Others, plotValidOthersRe)
+	}
+	if c.MaxRange > 0 && c.MinRange > c.MaxRange {
+		return fmt.Errorf("plot min_range must not be greater than max_range")
+	}
+	if c.MaxSeries < 0 {
+		return fmt.Errorf("plot max_series must not be negative")
+	}
+	if _, err := brewer.GetPalette(brewer.TypeAny, c.Palette, PlotPaletteSize); err != nil {
+		return fmt.Errorf("invalid plot palette %q: %v", c.Palette, err)
+	}
+	if c.ThresholdColor != "" && !hexColorMatcher.MatchString(c.ThresholdColor) {
+		return fmt.Errorf("invalid plot threshold color %q", c.ThresholdColor)
+	}
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid plot timezone %q: %v", c.Timezone, err)
+		}
+		c.location = loc
+	}
+	return nil
+}
+
+// Location returns the timezone of the time axis.
+func (c *PlotConfig) Location() *time.Location {
+	if c.location == nil {
+		return time.Local
+	}
+	return c.location
+}
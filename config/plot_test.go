@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestPlotConfigWindow(t *testing.T) {
+	var c PlotConfig
+	if err := yaml.UnmarshalStrict([]byte(`lookback: 30m`), &c); err != nil {
+		t.Fatal(err)
+	}
+	// 未设置的字段使用默认值
+	if time.Duration(c.Lookback) != 30*time.Minute || time.Duration(c.ResolvedPadding) != 5*time.Minute ||
+		time.Duration(c.MinRange) != 20*time.Minute || time.Duration(c.MaxRange) != 6*time.Hour {
+		t.Fatalf("unexpected plot window %+v", c)
+	}
+
+	for _, tc := range []struct {
+		in  string
+		err bool
+	}{
+		{in: "min_range: 1h\nmax_range: 1h"},
+		{in: "min_range: 2h\nmax_range: 0s"},
+		{in: "min_range: 2h\nmax_range: 1h", err: true},
+	} {
+		var c PlotConfig
+		err := yaml.UnmarshalStrict([]byte(tc.in), &c)
+		if tc.err && err == nil {
+			t.Errorf("%q: expected an error", tc.in)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.in, err)
+		}
+	}
+}
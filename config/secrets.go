@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envVarRe matches ${NAME} references. Plain $NAME is left alone because Go
+// templates in the configuration use $ for variables.
+var envVarRe = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// expandEnvVars replaces every ${NAME} in s with the value of the environment
+// variable NAME. Referencing an unset variable is an error.
+func expandEnvVars(s string) (string, error) {
+	var missing []string
+	expanded := envVarRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := envVarRe.FindStringSubmatch(m)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variables not set: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// checkSecretFile returns an error if both the secret and its file are set.
+func checkSecretFile(name string, secret Secret, file string) error {
+	if secret != "" && file != "" {
+		return fmt.Errorf("at most one of %s & %s_file must be configured", name, name)
+	}
+	return nil
+}
+
+// readSecretFile sets the secret to the content of the file, without the
+// trailing newline, if the file is set.
+func readSecretFile(secret *Secret, file string) error {
+	if file == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("unable to read secret file: %v", err)
+	}
+	*secret = Secret(strings.TrimRight(string(b), "\r\n"))
+	return nil
+}
+
+// readSecretFiles reads all secrets configured with a *_file option. It must
+// be called after resolveFilepaths.
+func readSecretFiles(cfg *Config) error {
+	var files []struct {
+		secret *Secret
+		file   string
+	}
+	add := func(secret *Secret, file string) {
+		files = append(files, struct {
+			secret *Secret
+			file   string
+		}{secret, file})
+	}
+
+	add(&cfg.Global.WeChatAPISecret, cfg.Global.WeChatAPISecretFile)
+	add(&cfg.Global.WeChatAPICorpID, cfg.Global.WeChatAPICorpIDFile)
+	add(&cfg.Global.DingTalkAPIToken, cfg.Global.DingTalkAPITokenFile)
+	add(&cfg.Global.DingTalkAPISecret, cfg.Global.DingTalkAPISecretFile)
+	for _, rcv := range cfg.Receivers {
+		for _, c := range rcv.WechatConfigs {
+			add(&c.APISecret, c.APISecretFile)
+			add(&c.CorpID, c.CorpIDFile)
+		}
+		for _, c := range rcv.DingtalkConfigs {
+			add(&c.APISecret, c.APISecretFile)
+			add(&c.APIToken, c.APITokenFile)
+		}
+	}
+	if cfg.S3 != nil {
+		add(&cfg.S3.AccessKey, cfg.S3.AccessKeyFile)
+		add(&cfg.S3.SecretKey, cfg.S3.SecretKeyFile)
+	}
+	if cfg.Grafana != nil {
+		add(&cfg.Grafana.APIKey, cfg.Grafana.APIKeyFile)
+	}
+	if cfg.Actions != nil {
+		add(&cfg.Actions.Secret, cfg.Actions.SecretFile)
+	}
+
+	for _, f := range files {
+		if err := readSecretFile(f.secret, f.file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnvVars(t *testing.T) {
+	t.Setenv("PROMOTER_TEST_TOKEN", "token")
+	t.Setenv("PROMOTER_TEST_EMPTY", "")
+
+	for _, tc := range []struct {
+		name     string
+		in       string
+		expected string
+		err      string
+	}{
+		{name: "variable", in: "token: ${PROMOTER_TEST_TOKEN}", expected: "token: token"},
+		{name: "empty variable", in: "token: '${PROMOTER_TEST_EMPTY}'", expected: "token: ''"},
+		{name: "several variables", in: "${PROMOTER_TEST_TOKEN}-${PROMOTER_TEST_TOKEN}", expected: "token-token"},
+		// 模板中的 $ 变量不会被替换
+		{name: "template variable", in: `text: '{{ $x := .Status }}{{ $x }} $PROMOTER_TEST_TOKEN'`, expected: `text: '{{ $x := .Status }}{{ $x }} $PROMOTER_TEST_TOKEN'`},
+		{name: "invalid name", in: "${1TOKEN} ${}", expected: "${1TOKEN} ${}"},
+		{name: "unset variables", in: "${PROMOTER_TEST_UNSET_A} ${PROMOTER_TEST_TOKEN} ${PROMOTER_TEST_UNSET_B}", err: "environment variables not set: PROMOTER_TEST_UNSET_A, PROMOTER_TEST_UNSET_B"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := expandEnvVars(tc.in)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadFileSecrets(t *testing.T) {
+	t.Setenv("PROMOTER_TEST_WECHAT_SECRET", "wechat-secret")
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"config.yml": `
+global:
+  dingtalk_api_url: http://dingtalk.example.com/robot/send
+  dingtalk_api_token_file: secrets/dingtalk_token
+  dingtalk_api_secret: dingtalk-secret
+  wechat_api_url: http://wechat.example.com/cgi-bin/
+  wechat_api_secret: ${PROMOTER_TEST_WECHAT_SECRET}
+  wechat_api_corp_id_file: secrets/corp_id
+receivers:
+  - name: ops
+    dingtalk_configs:
+      - message_type: markdown
+      - message_type: markdown
+        api_token: own-token
+        api_secret_file: secrets/own_secret
+    wechat_configs:
+      - message_type: markdown
+        agent_id: "1000002"
+s3:
+  access_key_file: secrets/s3_access_key
+  secret_key: s3-secret
+  endpoint: https://s3.example.com
+  region: us-east-1
+  bucket: promoter
+`,
+		// 只去掉末尾的换行
+		"secrets/dingtalk_token": "file-token\n",
+		"secrets/own_secret":     "own-secret\r\n",
+		"secrets/corp_id":        " corp\n\n",
+		"secrets/s3_access_key":  "s3-key",
+	})
+
+	conf, err := LoadFile(filepath.Join(dir, "config.yml"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dingtalk, wechat := conf.Receivers[0].DingtalkConfigs, conf.Receivers[0].WechatConfigs
+	for _, tc := range []struct {
+		name     string
+		got      Secret
+		expected Secret
+	}{
+		{name: "global dingtalk_api_token", got: conf.Global.DingTalkAPIToken, expected: "file-token"},
+		{name: "inherited api_token", got: dingtalk[0].APIToken, expected: "file-token"},
+		{name: "inherited api_secret", got: dingtalk[0].APISecret, expected: "dingtalk-secret"},
+		{name: "own api_token", got: dingtalk[1].APIToken, expected: "own-token"},
+		{name: "own api_secret", got: dingtalk[1].APISecret, expected: "own-secret"},
+		{name: "wechat api_secret from the environment", got: wechat[0].APISecret, expected: "wechat-secret"},
+		{name: "wechat corp_id", got: wechat[0].CorpID, expected: " corp"},
+		{name: "s3 access_key", got: conf.S3.AccessKey, expected: "s3-key"},
+		{name: "s3 secret_key", got: conf.S3.SecretKey, expected: "s3-secret"},
+	} {
+		if tc.got != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, tc.got)
+		}
+	}
+
+	// 不展开环境变量时保留原样
+	conf, err = LoadFile(filepath.Join(dir, "config.yml"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret := conf.Global.WeChatAPISecret; secret != "${PROMOTER_TEST_WECHAT_SECRET}" {
+		t.Fatalf("expected the reference to be kept, got %q", secret)
+	}
+}
+
+func TestLoadFileSecretsInvalid(t *testing.T) {
+	const receivers = `
+receivers:
+  - name: ops
+    dingtalk_configs:
+      - message_type: markdown
+`
+	for _, tc := range []struct {
+		name string
+		conf string
+		err  string
+	}{
+		{
+			name: "secret and file",
+			conf: `
+global:
+  dingtalk_api_url: http://dingtalk.example.com/robot/send
+  dingtalk_api_token: token
+  dingtalk_api_token_file: secrets/token
+  dingtalk_api_secret: secret
+` + receivers,
+			err: "at most one of dingtalk_api_token & dingtalk_api_token_file must be configured",
+		},
+		{
+			name: "missing file",
+			conf: `
+global:
+  dingtalk_api_url: http://dingtalk.example.com/robot/send
+  dingtalk_api_token_file: secrets/missing
+  dingtalk_api_secret: secret
+` + receivers,
+			err: "unable to read secret file",
+		},
+		{
+			name: "unset variable",
+			conf: `
+global:
+  dingtalk_api_url: http://dingtalk.example.com/robot/send
+  dingtalk_api_token: ${PROMOTER_TEST_UNSET}
+  dingtalk_api_secret: secret
+` + receivers,
+			err: "environment variables not set: PROMOTER_TEST_UNSET",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFiles(t, dir, map[string]string{"config.yml": tc.conf, "secrets/token": "token"})
+			_, err := LoadFile(filepath.Join(dir, "config.yml"), true)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
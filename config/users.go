@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultMentionLabels are the alert labels and annotations holding the
+// users or teams mentioned in notifications.
+var DefaultMentionLabels = []string{"owner", "team"}
+
+// UserConfig is a user of the on-call directory with their accounts on every
+// notification channel.
+type UserConfig struct {
+	Name         string `yaml:"name" json:"name"`
+	Mobile       string `yaml:"mobile,omitempty" json:"mobile,omitempty"`
+	WechatUserID string `yaml:"wechat_user_id,omitempty" json:"wechat_user_id,omitempty"`
+	FeishuOpenID string `yaml:"feishu_open_id,omitempty" json:"feishu_open_id,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for UserConfig.
+func (c *UserConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain UserConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Name == "" {
+		return fmt.Errorf("missing name in user config")
+	}
+	return nil
+}
+
+// TeamConfig is a named group of users of the on-call directory.
+type TeamConfig struct {
+	Name    string   `yaml:"name" json:"name"`
+	Members []string `yaml:"members" json:"members"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for TeamConfig.
+func (c *TeamConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain TeamConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Name == "" {
+		return fmt.Errorf("missing name in team config")
+	}
+	return nil
+}
+
+// validateDirectory checks that user, team and schedule names are unique,
+// they share the same namespace, that teams and schedules only reference known
+// users and that escalation policies only target known names.
+func (c *Config) validateDirectory() error {
+	names := map[string]struct{}{}
+	for _, u := range c.Users {
+		if _, ok := names[u.Name]; ok {
+			return fmt.Errorf("user name %q is not unique", u.Name)
+		}
+		names[u.Name] = struct{}{}
+	}
+	for _, t := range c.Teams {
+		if _, ok := names[t.Name]; ok {
+			return fmt.Errorf("team name %q is not unique", t.Name)
+		}
+		names[t.Name] = struct{}{}
+	}
+	schedules := map[string]*ScheduleConfig{}
+	for _, s := range c.Schedules {
+		if _, ok := names[s.Name]; ok {
+			return fmt.Errorf("schedule name %q is not unique", s.Name)
+		}
+		names[s.Name] = struct{}{}
+		schedules[s.Name] = s
+	}
+
+	users := map[string]struct{}{}
+	for _, u := range c.Users {
+		users[u.Name] = struct{}{}
+	}
+	for _, t := range c.Teams {
+		for _, m := range t.Members {
+			if _, ok := users[m]; !ok {
+				return fmt.Errorf("team %q references unknown user %q", t.Name, m)
+			}
+		}
+	}
+	for _, s := range c.Schedules {
+		for _, r := range s.Rotations {
+			for _, m := range r.Members {
+				if _, ok := users[m]; !ok {
+					return fmt.Errorf("rotation %q of schedule %q references unknown user %q", r.Name, s.Name, m)
+				}
+			}
+		}
+		for _, o := range s.Overrides {
+			if _, ok := users[o.User]; !ok {
+				return fmt.Errorf("override of schedule %q references unknown user %q", s.Name, o.User)
+			}
+		}
+	}
+
+	policies := map[string]struct{}{}
+	for _, p := range c.EscalationPolicies {
+		if _, ok := policies[p.Name]; ok {
+			return fmt.Errorf("escalation policy name %q is not unique", p.Name)
+		}
+		policies[p.Name] = struct{}{}
+		for _, step := range p.Steps {
+			for _, target := range step.Targets {
+				// schedule/rotation 只通知某个轮值中正在值班的人员
+				if i := strings.Index(target, "/"); i >= 0 {
+					s, ok := schedules[target[:i]]
+					if !ok || s.rotation(target[i+1:]) == nil {
+						return fmt.Errorf("escalation policy %q targets unknown rotation %q", p.Name, target)
+					}
+					continue
+				}
+				if _, ok := names[target]; !ok {
+					return fmt.Errorf("escalation policy %q targets unknown name %q", p.Name, target)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// GetEscalationPolicy returns the escalation policy with the given name.
+func (c Config) GetEscalationPolicy(name string) *EscalationPolicyConfig {
+	for _, p := range c.EscalationPolicies {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/cnych/promoter/notify"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// gcInterval is how often expired entries are removed from the backend.
+const gcInterval = 10 * time.Minute
+
+// Backend stores the notifications sent recently. Implementations must make
+// Claim atomic, including across Promoter replicas sharing the backend.
+type Backend interface {
+	// Claim records the key until expiresAt unless it is already recorded
+	// and not expired. It reports whether the key was recorded.
+	Claim(key string, now, expiresAt time.Time) (bool, error)
+	// Release removes the key.
+	Release(key string) error
+	// GC removes the keys expired at now and returns how many were removed.
+	GC(now time.Time) (int, error)
+}
+
+// Deduplicator suppresses the notifications of a receiver already sent with
+// the same alerts and statuses within the dedup interval, e.g. repeated by
+// Alertmanager or sent by both Alertmanagers of an HA pair.
+type Deduplicator struct {
+	backend Backend
+	logger  log.Logger
+}
+
+// New returns a Deduplicator storing its state in the backend.
+func New(backend Backend, logger log.Logger) *Deduplicator {
+	return &Deduplicator{backend: backend, logger: logger}
+}
+
+// Key identifies the notification of the receiver by the fingerprints and
+// statuses of its alerts.
+func Key(receiver string, data *notify.Data) string {
+	alerts := make([]string, 0, len(data.Alerts))
+	for _, a := range data.Alerts {
+		alerts = append(alerts, a.Fingerprint+":"+a.Status)
+	}
+	sort.Strings(alerts)
+
+	h := sha256.New()
+	h.Write([]byte(receiver))
+	for _, a := range alerts {
+		h.Write([]byte{0xff})
+		h.Write([]byte(a))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Claim reports whether the notification should be sent and records it for
+// the interval. The returned release function forgets the notification again,
+// it must be called if sending fails so that a retry is not suppressed.
+// Backend errors are logged and the notification is sent.
+func (d *Deduplicator) Claim(receiver string, data *notify.Data, interval time.Duration) (bool, func()) {
+	key := Key(receiver, data)
+	now := time.Now()
+
+	claimed, err := d.backend.Claim(key, now, now.Add(interval))
+	if err != nil {
+		level.Error(d.logger).Log("msg", "Cannot check duplicate notification, sending it", "receiver", receiver, "err", err)
+		return true, func() {}
+	}
+	release := func() {
+		if err := d.backend.Release(key); err != nil {
+			level.Error(d.logger).Log("msg", "Cannot release notification", "receiver", receiver, "err", err)
+		}
+	}
+	return claimed, release
+}
+
+// Run removes expired entries periodically until stop is closed.
+func (d *Deduplicator) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			n, err := d.backend.GC(time.Now())
+			if err != nil {
+				level.Error(d.logger).Log("msg", "Dedup garbage collection failed", "err", err)
+				continue
+			}
+			level.Debug(d.logger).Log("msg", "Dedup garbage collection completed", "removed", n)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package dedup
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cnych/promoter/notify"
+	"github.com/go-kit/log"
+)
+
+// testBackend runs the checks every Backend must pass.
+func testBackend(t *testing.T, b Backend) {
+	now := time.Now()
+
+	t.Run("claim", func(t *testing.T) {
+		if claimed, err := b.Claim("a", now, now.Add(time.Minute)); err != nil || !claimed {
+			t.Fatalf("expected first claim to succeed, got %v %v", claimed, err)
+		}
+		if claimed, err := b.Claim("a", now.Add(30*time.Second), now.Add(time.Minute)); err != nil || claimed {
+			t.Fatalf("expected duplicate claim to fail, got %v %v", claimed, err)
+		}
+		if claimed, err := b.Claim("b", now, now.Add(time.Minute)); err != nil || !claimed {
+			t.Fatalf("expected claim of another key to succeed, got %v %v", claimed, err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		if claimed, err := b.Claim("c", now, now.Add(time.Minute)); err != nil || !claimed {
+			t.Fatalf("expected first claim to succeed, got %v %v", claimed, err)
+		}
+		later := now.Add(time.Minute)
+		if claimed, err := b.Claim("c", later, later.Add(time.Minute)); err != nil || !claimed {
+			t.Fatalf("expected claim of expired key to succeed, got %v %v", claimed, err)
+		}
+		// 替换后的记录使用新的过期时间
+		if claimed, err := b.Claim("c", later.Add(30*time.Second), later.Add(time.Minute)); err != nil || claimed {
+			t.Fatalf("expected claim of replaced key to fail, got %v %v", claimed, err)
+		}
+	})
+
+	t.Run("release", func(t *testing.T) {
+		if claimed, err := b.Claim("d", now, now.Add(time.Minute)); err != nil || !claimed {
+			t.Fatalf("expected first claim to succeed, got %v %v", claimed, err)
+		}
+		if err := b.Release("d"); err != nil {
+			t.Fatal(err)
+		}
+		if claimed, err := b.Claim("d", now, now.Add(time.Minute)); err != nil || !claimed {
+			t.Fatalf("expected claim after release to succeed, got %v %v", claimed, err)
+		}
+		if err := b.Release("missing"); err != nil {
+			t.Fatalf("expected release of a missing key to succeed, got %v", err)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		for round := 0; round < 20; round++ {
+			// 每轮的过期时间都早于下一轮，所以每轮都会替换上一轮的记录
+			at := now.Add(time.Duration(round+2) * time.Hour)
+			var (
+				wg      sync.WaitGroup
+				claimed int32
+			)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ok, err := b.Claim("e", at, at.Add(time.Minute))
+					if err != nil {
+						t.Error(err)
+					}
+					if ok {
+						atomic.AddInt32(&claimed, 1)
+					}
+				}()
+			}
+			wg.Wait()
+			if claimed != 1 {
+				t.Fatalf("round %d: expected exactly 1 claim, got %d", round, claimed)
+			}
+		}
+	})
+}
+
+func TestKey(t *testing.T) {
+	data := &notify.Data{Alerts: notify.Alerts{
+		{Fingerprint: "a1", Status: "firing"},
+		{Fingerprint: "b2", Status: "firing"},
+	}}
+	reordered := &notify.Data{Alerts: notify.Alerts{data.Alerts[1], data.Alerts[0]}}
+	if Key("ops", data) != Key("ops", reordered) {
+		t.Fatal("expected the key not to depend on the order of the alerts")
+	}
+	if Key("ops", data) == Key("dev", data) {
+		t.Fatal("expected the key to depend on the receiver")
+	}
+	resolved := &notify.Data{Alerts: notify.Alerts{
+		{Fingerprint: "a1", Status: "resolved"},
+		{Fingerprint: "b2", Status: "firing"},
+	}}
+	if Key("ops", data) == Key("ops", resolved) {
+		t.Fatal("expected the key to depend on the statuses of the alerts")
+	}
+}
+
+func TestDeduplicatorReleaseAfterFailedSend(t *testing.T) {
+	d := New(NewMemory(), log.NewNopLogger())
+	data := &notify.Data{Alerts: notify.Alerts{{Fingerprint: "a1", Status: "firing"}}}
+
+	claimed, release := d.Claim("ops", data, time.Hour)
+	if !claimed {
+		t.Fatal("expected the first notification to be sent")
+	}
+	if claimed, _ := d.Claim("ops", data, time.Hour); claimed {
+		t.Fatal("expected the duplicate notification to be suppressed")
+	}
+
+	// 发送失败后释放，重试时不会被当作重复通知
+	release()
+	if claimed, _ := d.Claim("ops", data, time.Hour); !claimed {
+		t.Fatal("expected the retry to be sent after release")
+	}
+}
@@ -0,0 +1,131 @@
+package dedup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockSuffix is appended to the file of a key while an expired file is being
+// replaced.
+const lockSuffix = ".lock"
+
+// File is a Backend storing every key in its own file of a directory. The
+// files are created exclusively and expired files are only replaced while
+// holding the lock file of the key, so replicas sharing the directory (e.g. a
+// shared volume) never send the same notification twice, and the state
+// survives restarts.
+type File struct {
+	dir string
+}
+
+// NewFile returns a backend storing its state in the directory.
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &File{dir: dir}, nil
+}
+
+// Claim implements Backend.
+func (f *File) Claim(key string, now, expiresAt time.Time) (bool, error) {
+	path := filepath.Join(f.dir, key)
+	claimed, err := create(path, expiresAt)
+	if claimed || !os.IsExist(err) {
+		return claimed, err
+	}
+
+	// 替换已过期的文件需要持有锁文件，否则两个副本可能都读到过期时间，一个删除
+	// 另一个刚创建的文件后都发送通知。锁文件被其他副本持有时，由该副本处理；
+	// 进程退出时残留的锁文件由 GC 删除
+	lock := path + lockSuffix
+	fd, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	fd.Close()
+	defer os.Remove(lock)
+
+	exp, err := readExpiry(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil || exp.After(now):
+		// 其他副本刚创建、还没有写入内容的文件也视为未过期
+		return false, nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	claimed, err = create(path, expiresAt)
+	if os.IsExist(err) {
+		// 删除后其他副本先创建了文件
+		return false, nil
+	}
+	return claimed, err
+}
+
+// create creates the file of a key exclusively with the expiry as content.
+func create(path string, expiresAt time.Time) (bool, error) {
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return false, err
+	}
+	_, err = fd.WriteString(strconv.FormatInt(expiresAt.UnixNano(), 10))
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	return true, err
+}
+
+// Release implements Backend.
+func (f *File) Release(key string) error {
+	if err := os.Remove(filepath.Join(f.dir, key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// GC implements Backend.
+func (f *File) GC(now time.Time) (int, error) {
+	files, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, fi := range files {
+		if fi.IsDir() {
+			continue
+		}
+		path := filepath.Join(f.dir, fi.Name())
+		exp, err := readExpiry(path)
+		if err != nil {
+			// 写入失败的文件和残留的锁文件在一段时间后删除，避免一直抑制通知
+			exp = fi.ModTime().Add(time.Minute)
+		}
+		if exp.After(now) {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func readExpiry(path string) (time.Time, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ns, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ns), nil
+}
@@ -0,0 +1,153 @@
+package dedup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestFile(t *testing.T, dir string) *File {
+	t.Helper()
+
+	f, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFile(t *testing.T) {
+	testBackend(t, newTestFile(t, t.TempDir()))
+}
+
+func TestFileReplicas(t *testing.T) {
+	dir := t.TempDir()
+	replicas := []*File{newTestFile(t, dir), newTestFile(t, dir)}
+	now := time.Now()
+
+	// 两个副本同时替换同一个已过期的文件，只有一个可以发送
+	for round := 0; round < 100; round++ {
+		at := now.Add(time.Duration(round+1) * time.Hour)
+		var (
+			wg      sync.WaitGroup
+			claimed int32
+		)
+		for i := 0; i < 30; i++ {
+			wg.Add(1)
+			go func(f *File) {
+				defer wg.Done()
+				ok, err := f.Claim("key", at, at.Add(time.Minute))
+				if err != nil {
+					t.Error(err)
+				}
+				if ok {
+					atomic.AddInt32(&claimed, 1)
+				}
+			}(replicas[i%len(replicas)])
+		}
+		wg.Wait()
+		if claimed != 1 {
+			t.Fatalf("round %d: expected exactly 1 claim, got %d", round, claimed)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "key"+lockSuffix)); !os.IsNotExist(err) {
+		t.Fatalf("expected the lock file to be removed, got %v", err)
+	}
+}
+
+func TestFileClaimLocked(t *testing.T) {
+	dir := t.TempDir()
+	f := newTestFile(t, dir)
+	now := time.Now()
+
+	if claimed, err := f.Claim("key", now, now.Add(time.Minute)); err != nil || !claimed {
+		t.Fatalf("expected first claim to succeed, got %v %v", claimed, err)
+	}
+	// 其他副本正在替换已过期的文件
+	lock := filepath.Join(dir, "key"+lockSuffix)
+	if err := ioutil.WriteFile(lock, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := now.Add(time.Hour)
+	if claimed, err := f.Claim("key", later, later.Add(time.Minute)); err != nil || claimed {
+		t.Fatalf("expected claim to fail while locked, got %v %v", claimed, err)
+	}
+
+	if err := os.Remove(lock); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := f.Claim("key", later, later.Add(time.Minute)); err != nil || !claimed {
+		t.Fatalf("expected claim to succeed once unlocked, got %v %v", claimed, err)
+	}
+}
+
+func TestFileClaimUnwritten(t *testing.T) {
+	dir := t.TempDir()
+	f := newTestFile(t, dir)
+
+	// 其他副本刚创建还没有写入过期时间的文件不会被替换
+	if err := ioutil.WriteFile(filepath.Join(dir, "key"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if claimed, err := f.Claim("key", now, now.Add(time.Minute)); err != nil || claimed {
+		t.Fatalf("expected claim of an unwritten file to fail, got %v %v", claimed, err)
+	}
+}
+
+func TestFileGC(t *testing.T) {
+	dir := t.TempDir()
+	f := newTestFile(t, dir)
+	now := time.Now()
+
+	for key, ttl := range map[string]time.Duration{"expired": -time.Second, "active": time.Minute} {
+		if _, err := f.Claim(key, now.Add(-time.Hour), now.Add(ttl)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 进程退出时残留的锁文件和写入失败的文件在一分钟后删除
+	old := now.Add(-2 * time.Minute)
+	for name, mtime := range map[string]time.Time{
+		"stale" + lockSuffix:  old,
+		"fresh" + lockSuffix:  now,
+		"corrupt":             old,
+		"active" + lockSuffix: now,
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := f.GC(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 removed files, got %d", n)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range files {
+		names = append(names, fi.Name())
+	}
+	expected := []string{"active", "active" + lockSuffix, "fresh" + lockSuffix}
+	if len(names) != len(expected) {
+		t.Fatalf("expected files %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("expected files %v, got %v", expected, names)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package dedup
+
+import (
+	"sync"
+	"time"
+)
+
+// Memory is a Backend keeping its state in memory, it is lost on restart and
+// not shared between replicas.
+type Memory struct {
+	mtx     sync.Mutex
+	entries map[string]time.Time
+}
+
+// NewMemory returns an empty in-memory backend.
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]time.Time{}}
+}
+
+// Claim implements Backend.
+func (m *Memory) Claim(key string, now, expiresAt time.Time) (bool, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if exp, ok := m.entries[key]; ok && exp.After(now) {
+		return false, nil
+	}
+	m.entries[key] = expiresAt
+	return true, nil
+}
+
+// Release implements Backend.
+func (m *Memory) Release(key string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// GC implements Backend.
+func (m *Memory) GC(now time.Time) (int, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	n := 0
+	for key, exp := range m.entries {
+		if !exp.After(now) {
+			delete(m.entries, key)
+			n++
+		}
+	}
+	return n, nil
+}
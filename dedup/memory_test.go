@@ -0,0 +1,31 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	testBackend(t, NewMemory())
+}
+
+func TestMemoryGC(t *testing.T) {
+	m := NewMemory()
+	now := time.Now()
+	for key, ttl := range map[string]time.Duration{"expired": -time.Second, "now": 0, "active": time.Minute} {
+		if _, err := m.Claim(key, now.Add(-time.Hour), now.Add(ttl)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := m.GC(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 removed keys, got %d", n)
+	}
+	if _, ok := m.entries["active"]; !ok || len(m.entries) != 1 {
+		t.Fatalf("expected only the active key to be kept, got %v", m.entries)
+	}
+}
@@ -0,0 +1,216 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/history"
+	"github.com/cnych/promoter/notify"
+	"github.com/cnych/promoter/notify/wechat"
+	"github.com/cnych/promoter/util"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// checkTimeout bounds a single dependency check.
+const checkTimeout = 5 * time.Second
+
+// Check statuses.
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Result is the outcome of a dependency check.
+type Result struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+type check struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// Options configures a Checker.
+type Options struct {
+	// Dependencies enables the reachability checks of the datasources, the
+	// S3 storage and the WeChat token acquisition.
+	Dependencies bool
+	// CacheTTL is how long the results are reused before checking again.
+	CacheTTL time.Duration
+	// History is checked when it is not nil.
+	History *history.Store
+	Logger  log.Logger
+}
+
+// Checker reports whether Promoter is ready to send notifications. It is not
+// ready until a configuration has been loaded.
+type Checker struct {
+	opts   Options
+	logger log.Logger
+
+	// mtx 同时保护检查过程，并发的探测请求只会触发一次检查
+	mtx       sync.Mutex
+	loaded    bool
+	checks    []check
+	results   map[string]Result
+	checkedAt time.Time
+}
+
+// New returns a Checker without configuration.
+func New(opts Options) *Checker {
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Checker{opts: opts, logger: logger}
+}
+
+// Update replaces the checks with the dependencies of the configuration and
+// discards the cached results. The WeChat tokens are checked through the
+// integrations of the receivers, so that their cached tokens are reused.
+func (c *Checker) Update(conf *config.Config, integrations map[string][]notify.Integration) {
+	var checks []check
+	if c.opts.History != nil {
+		checks = append(checks, check{name: "history", fn: func(context.Context) error {
+			return c.opts.History.Check()
+		}})
+	}
+	if c.opts.Dependencies {
+		checks = append(checks, dependencyChecks(conf, integrations)...)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.loaded = true
+	c.checks = checks
+	c.results = nil
+}
+
+// dependencyChecks returns the checks of the upstream services used by the
+// configuration. WeChat apps sharing the same credentials are checked once.
+func dependencyChecks(conf *config.Config, integrations map[string][]notify.Integration) []check {
+	var checks []check
+
+	dss, err := notify.NewDatasources(conf)
+	if err != nil {
+		checks = append(checks, check{name: "datasources", fn: func(context.Context) error {
+			return err
+		}})
+	}
+	for _, ds := range dss.All() {
+		checks = append(checks, check{name: "prometheus/" + ds.Name, fn: ds.Check})
+	}
+
+	if s3 := conf.S3; s3 != nil {
+		checks = append(checks, check{name: "s3", fn: func(ctx context.Context) error {
+			return util.CheckBucket(ctx, string(s3.AccessKey), string(s3.SecretKey), s3.Endpoint, s3.Bucket, s3.Region)
+		}})
+	}
+
+	seen := map[string]struct{}{}
+	for _, rcv := range conf.Receivers {
+		for i, wc := range rcv.WechatConfigs {
+			key := fmt.Sprintf("%s|%s|%s", wc.APIURL, wc.CorpID, wc.APISecret)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+
+			n := wechatNotifier(integrations[rcv.Name], i)
+			checks = append(checks, check{name: fmt.Sprintf("wechat/%s[%d]", rcv.Name, i), fn: func(ctx context.Context) error {
+				if n == nil {
+					return fmt.Errorf("notifier not initialized")
+				}
+				return n.CheckToken(ctx)
+			}})
+		}
+	}
+	return checks
+}
+
+// wechatNotifier returns the notifier of the WeChat config with the index.
+func wechatNotifier(integrations []notify.Integration, idx int) *wechat.Notifier {
+	for _, i := range integrations {
+		if n, ok := i.Notifier.(*wechat.Notifier); ok && i.Index == idx {
+			return n
+		}
+	}
+	return nil
+}
+
+// Check returns whether all checks pass and the result of each check.
+// Results younger than the cache TTL are returned without checking again.
+func (c *Checker) Check() (bool, map[string]Result) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.loaded {
+		return false, nil
+	}
+	if c.results == nil || time.Since(c.checkedAt) >= c.opts.CacheTTL {
+		c.refresh()
+	}
+
+	ready := true
+	results := make(map[string]Result, len(c.results))
+	for name, r := range c.results {
+		if r.Status != StatusUp {
+			ready = false
+		}
+		results[name] = r
+	}
+	return ready, results
+}
+
+// refresh runs all checks concurrently. It must be called with mtx held.
+// The checks do not use the context of the probe request, a probe timing out
+// must not cache failed results.
+func (c *Checker) refresh() {
+	var (
+		wg      sync.WaitGroup
+		mtx     sync.Mutex
+		results = make(map[string]Result, len(c.checks))
+	)
+	for _, chk := range c.checks {
+		wg.Add(1)
+		go func(chk check) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+			defer cancel()
+
+			r := Result{Status: StatusUp, CheckedAt: time.Now()}
+			if err := chk.fn(ctx); err != nil {
+				r.Status = StatusDown
+				r.Error = util.RedactURL(err).Error()
+			}
+
+			mtx.Lock()
+			results[chk.name] = r
+			mtx.Unlock()
+		}(chk)
+	}
+	wg.Wait()
+
+	// 只在状态变化时打印日志，避免探测请求刷屏
+	for name, r := range results {
+		if prev, ok := c.results[name]; ok && prev.Status == r.Status {
+			continue
+		}
+		if r.Status == StatusDown {
+			level.Warn(c.logger).Log("msg", "Dependency check failed", "dependency", name, "err", r.Error)
+		} else if _, ok := c.results[name]; ok {
+			level.Info(c.logger).Log("msg", "Dependency check recovered", "dependency", name)
+		}
+	}
+
+	c.results = results
+	c.checkedAt = time.Now()
+}
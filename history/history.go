@@ -0,0 +1,415 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cnych/promoter/labels"
+	"github.com/cnych/promoter/notify"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	historyFile = "history.db"
+	// maintenanceInterval is how often records beyond the retention limits
+	// are deleted.
+	maintenanceInterval = 15 * time.Minute
+)
+
+var (
+	notificationsBucket = []byte("notifications")
+	// acksBucket holds the acknowledgements of firing alerts keyed by
+	// receiver and label fingerprint.
+	acksBucket = []byte("acks")
+	// escalationsBucket holds the alerts tracked for escalation, see
+	// notify.EscalationStore.
+	escalationsBucket = []byte("escalations")
+)
+
+// ErrNotFound is returned when a notification does not exist.
+var ErrNotFound = errors.New("notification not found")
+
+// Notification is a notification received by a receiver together with the
+// outcome of every notifier.
+type Notification struct {
+	ID         string       `json:"id"`
+	Receiver   string       `json:"receiver"`
+	ReceivedAt time.Time    `json:"receivedAt"`
+	Data       *notify.Data `json:"data"`
+	Deliveries []Delivery   `json:"deliveries"`
+}
+
+// Delivery is the outcome of sending a notification through an integration.
+type Delivery struct {
+	Integration string `json:"integration"`
+	// Fields are the rendered fields of the message, see notify.Renderer.
+	Fields  map[string]string `json:"fields,omitempty"`
+	Skipped bool              `json:"skipped,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// Options configures the retention of a Store.
+type Options struct {
+	// Retention is how long notifications are kept, 0 keeps them forever.
+	Retention time.Duration
+	// MaxNotifications is the maximum number of notifications kept, 0 means
+	// no limit.
+	MaxNotifications int
+}
+
+// Store persists notifications in a bbolt database.
+type Store struct {
+	db     *bolt.DB
+	opts   Options
+	logger log.Logger
+}
+
+// Open opens or creates the store in the directory.
+func Open(dir string, opts Options, logger log.Logger) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filepath.Join(dir, historyFile), 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open history store: %v", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{notificationsBucket, acksBucket, escalationsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db, opts: opts, logger: logger}, nil
+}
+
+// Close closes the store.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Check verifies that the store is open and readable.
+func (s *Store) Check() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(notificationsBucket) == nil {
+			return fmt.Errorf("missing bucket %q", notificationsBucket)
+		}
+		return nil
+	})
+}
+
+// Add stores the notification and sets its ID.
+func (s *Store) Add(n *Notification) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(notificationsBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		n.ID = strconv.FormatUint(id, 10)
+		v, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(id), v)
+	})
+}
+
+// Get returns the notification with the given ID.
+func (s *Store) Get(id string) (*Notification, error) {
+	k, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	var n Notification
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(notificationsBucket).Get(itob(k))
+		if v == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, &n)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// Query selects alerts of the stored notifications. Zero values do not
+// filter.
+type Query struct {
+	Receiver string
+	Status   string
+	Matchers labels.Matchers
+	// Start and End bound the time notifications were received.
+	Start, End time.Time
+	// Limit is the maximum number of alerts returned.
+	Limit int
+}
+
+// Alert is an alert of a stored notification with the outcome of its
+// delivery.
+type Alert struct {
+	notify.Alert
+	NotificationID string     `json:"notificationID"`
+	Receiver       string     `json:"receiver"`
+	ReceivedAt     time.Time  `json:"receivedAt"`
+	Deliveries     []Delivery `json:"deliveries"`
+}
+
+// Alerts returns the alerts matching the query, most recently received first.
+// Deliveries only report the integration, skip and error.
+func (s *Store) Alerts(q Query) ([]Alert, error) {
+	alerts := []Alert{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(notificationsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var n Notification
+			if err := json.Unmarshal(v, &n); err != nil {
+				return err
+			}
+			if !q.End.IsZero() && n.ReceivedAt.After(q.End) {
+				continue
+			}
+			if !q.Start.IsZero() && n.ReceivedAt.Before(q.Start) {
+				// 按接收时间顺序存储，之后的记录都更早
+				return nil
+			}
+			if q.Receiver != "" && n.Receiver != q.Receiver {
+				continue
+			}
+
+			deliveries := make([]Delivery, 0, len(n.Deliveries))
+			for _, d := range n.Deliveries {
+				deliveries = append(deliveries, Delivery{Integration: d.Integration, Skipped: d.Skipped, Error: d.Error})
+			}
+			for _, a := range n.Data.Alerts {
+				if q.Status != "" && a.Status != q.Status {
+					continue
+				}
+				if !q.Matchers.Matches(a.Labels) {
+					continue
+				}
+				alerts = append(alerts, Alert{
+					Alert:          a,
+					NotificationID: n.ID,
+					Receiver:       n.Receiver,
+					ReceivedAt:     n.ReceivedAt,
+					Deliveries:     deliveries,
+				})
+				if q.Limit > 0 && len(alerts) >= q.Limit {
+					return nil
+				}
+			}
+		}
+		return nil
+	})
+	return alerts, err
+}
+
+// Ack records the acknowledgement of the alerts of the receiver with the
+// given label fingerprints.
+func (s *Store) Ack(receiver string, fingerprints []string, ack notify.Ack) error {
+	v, err := json.Marshal(ack)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(acksBucket)
+		for _, fp := range fingerprints {
+			if err := b.Put(ackKey(receiver, fp), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Acks returns the acknowledgements of the alerts of the receiver by label
+// fingerprint.
+func (s *Store) Acks(receiver string, fingerprints []string) (map[string]*notify.Ack, error) {
+	acks := map[string]*notify.Ack{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(acksBucket)
+		for _, fp := range fingerprints {
+			v := b.Get(ackKey(receiver, fp))
+			if v == nil {
+				continue
+			}
+			var ack notify.Ack
+			if err := json.Unmarshal(v, &ack); err != nil {
+				return err
+			}
+			acks[fp] = &ack
+		}
+		return nil
+	})
+	return acks, err
+}
+
+// Unack deletes the acknowledgements of the alerts, e.g. once they resolved.
+func (s *Store) Unack(receiver string, fingerprints []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(acksBucket)
+		for _, fp := range fingerprints {
+			if err := b.Delete(ackKey(receiver, fp)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func ackKey(receiver, fingerprint string) []byte {
+	return []byte(receiver + "\xff" + fingerprint)
+}
+
+// Escalations returns the alerts tracked for escalation by key.
+func (s *Store) Escalations() (map[string]*notify.EscalationState, error) {
+	states := map[string]*notify.EscalationState{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(escalationsBucket).ForEach(func(k, v []byte) error {
+			var state notify.EscalationState
+			if err := json.Unmarshal(v, &state); err != nil {
+				return err
+			}
+			states[string(k)] = &state
+			return nil
+		})
+	})
+	return states, err
+}
+
+// SaveEscalations stores the changed alerts tracked for escalation and
+// deletes the forgotten ones.
+func (s *Store) SaveEscalations(changed map[string]*notify.EscalationState, deleted []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(escalationsBucket)
+		for k, state := range changed {
+			v, err := json.Marshal(state)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		for _, k := range deleted {
+			if err := b.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Run deletes the notifications beyond the retention limits periodically
+// until stop is closed.
+func (s *Store) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.gc(time.Now()); err != nil {
+			level.Error(s.logger).Log("msg", "History maintenance failed", "err", err)
+		} else if n > 0 {
+			level.Debug(s.logger).Log("msg", "Deleted old notifications", "count", n)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// gc deletes the notifications received before the retention period and the
+// oldest ones above the maximum count.
+func (s *Store) gc(now time.Time) (int, error) {
+	var keys [][]byte
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(notificationsBucket)
+		excess := 0
+		if s.opts.MaxNotifications > 0 {
+			excess = b.Stats().KeyN - s.opts.MaxNotifications
+		}
+
+		// 遍历时删除会跳过部分记录，先收集需要删除的 key
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if len(keys) >= excess {
+				if s.opts.Retention <= 0 {
+					break
+				}
+				var n struct {
+					ReceivedAt time.Time `json:"receivedAt"`
+				}
+				if err := json.Unmarshal(v, &n); err != nil {
+					return err
+				}
+				if now.Sub(n.ReceivedAt) < s.opts.Retention {
+					break
+				}
+			}
+			keys = append(keys, append([]byte{}, k...))
+		}
+
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return s.gcAcks(tx, now)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// gcAcks deletes the acknowledgements older than the retention period, the
+// resolved notification of their alert may never be received.
+func (s *Store) gcAcks(tx *bolt.Tx, now time.Time) error {
+	if s.opts.Retention <= 0 {
+		return nil
+	}
+	var keys [][]byte
+	b := tx.Bucket(acksBucket)
+	if err := b.ForEach(func(k, v []byte) error {
+		var ack notify.Ack
+		if err := json.Unmarshal(v, &ack); err != nil {
+			return err
+		}
+		if now.Sub(ack.At) >= s.opts.Retention {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
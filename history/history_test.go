@@ -0,0 +1,242 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cnych/promoter/labels"
+	"github.com/cnych/promoter/notify"
+	"github.com/go-kit/log"
+)
+
+func openTestStore(t *testing.T, dir string, opts Options) *Store {
+	t.Helper()
+
+	s, err := Open(dir, opts, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestEscalations(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir, Options{})
+
+	startsAt := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	states := map[string]*notify.EscalationState{
+		"payments\xffa1": {
+			Receiver: "payments",
+			Alert:    notify.Alert{Status: "firing", Labels: notify.KV{"alertname": "HighLatency"}, StartsAt: startsAt},
+			StartsAt: startsAt,
+			LastSeen: startsAt.Add(time.Hour),
+			Sent:     2,
+		},
+		"payments\xffb2": {
+			Receiver: "payments",
+			Alert:    notify.Alert{Status: "firing", Labels: notify.KV{"alertname": "Down"}, StartsAt: startsAt},
+			StartsAt: startsAt,
+			LastSeen: startsAt,
+			Acked:    true,
+		},
+	}
+	if err := s.SaveEscalations(states, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveEscalations(nil, []string{"payments\xffb2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后仍然可以读取
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = openTestStore(t, dir, Options{})
+	got, err := s.Escalations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 escalation, got %d", len(got))
+	}
+	state := got["payments\xffa1"]
+	if state == nil || state.Sent != 2 || !state.StartsAt.Equal(startsAt) || state.Alert.Labels["alertname"] != "HighLatency" {
+		t.Fatalf("unexpected escalation %+v", state)
+	}
+}
+
+func addTestNotification(t *testing.T, s *Store, receiver string, receivedAt time.Time, alerts ...notify.Alert) *Notification {
+	t.Helper()
+
+	n := &Notification{
+		Receiver:   receiver,
+		ReceivedAt: receivedAt,
+		Data:       &notify.Data{Receiver: receiver, Alerts: alerts},
+		Deliveries: []Delivery{{Integration: "dingtalk[0]", Fields: map[string]string{"text": "message"}}},
+	}
+	if err := s.Add(n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func storedIDs(t *testing.T, s *Store) []string {
+	t.Helper()
+
+	ids := []string{}
+	alerts, err := s.Alerts(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range alerts {
+		ids = append(ids, a.NotificationID)
+	}
+	return ids
+}
+
+func TestGC(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	alert := notify.Alert{Status: "firing", Labels: notify.KV{"alertname": "HighLatency"}}
+
+	for _, tc := range []struct {
+		name    string
+		opts    Options
+		deleted int
+		kept    []string
+	}{
+		{name: "no limits", kept: []string{"5", "4", "3", "2", "1"}},
+		{name: "retention", opts: Options{Retention: 150 * time.Minute}, deleted: 3, kept: []string{"5", "4"}},
+		{name: "retention at the boundary", opts: Options{Retention: 2 * time.Hour}, deleted: 4, kept: []string{"5"}},
+		{name: "max notifications", opts: Options{MaxNotifications: 2}, deleted: 3, kept: []string{"5", "4"}},
+		{name: "max notifications above the count", opts: Options{MaxNotifications: 10}, kept: []string{"5", "4", "3", "2", "1"}},
+		{name: "count limit stricter", opts: Options{Retention: 150 * time.Minute, MaxNotifications: 1}, deleted: 4, kept: []string{"5"}},
+		{name: "retention stricter", opts: Options{Retention: 150 * time.Minute, MaxNotifications: 4}, deleted: 3, kept: []string{"5", "4"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := openTestStore(t, t.TempDir(), tc.opts)
+			// 5 条通知分别在 5h 到 1h 之前收到
+			for i := 5; i > 0; i-- {
+				addTestNotification(t, s, "ops", now.Add(-time.Duration(i)*time.Hour), alert)
+			}
+
+			deleted, err := s.gc(now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted != tc.deleted {
+				t.Fatalf("expected %d deleted notifications, got %d", tc.deleted, deleted)
+			}
+			if ids := storedIDs(t, s); !reflect.DeepEqual(ids, tc.kept) {
+				t.Fatalf("expected notifications %v, got %v", tc.kept, ids)
+			}
+			// 删除之后的 ID 不会被重复使用
+			if n := addTestNotification(t, s, "ops", now, alert); n.ID != "6" {
+				t.Fatalf("expected ID 6, got %s", n.ID)
+			}
+		})
+	}
+}
+
+func TestGCAcks(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	s := openTestStore(t, t.TempDir(), Options{Retention: time.Hour})
+
+	if err := s.Ack("ops", []string{"old"}, notify.Ack{By: "alice", At: now.Add(-2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ack("ops", []string{"new"}, notify.Ack{By: "bob", At: now.Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.gc(now); err != nil {
+		t.Fatal(err)
+	}
+	acks, err := s.Acks("ops", []string{"old", "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acks) != 1 || acks["new"] == nil || acks["new"].By != "bob" {
+		t.Fatalf("expected only the new acknowledgement, got %v", acks)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	t0 := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	web1 := notify.Alert{Status: "firing", Labels: notify.KV{"alertname": "HighLatency", "instance": "web1"}}
+	db1 := notify.Alert{Status: "firing", Labels: notify.KV{"alertname": "DiskFull", "instance": "db1"}}
+	web2 := notify.Alert{Status: "firing", Labels: notify.KV{"alertname": "HighLatency", "instance": "web2"}}
+	resolved := web1
+	resolved.Status = "resolved"
+
+	s := openTestStore(t, t.TempDir(), Options{})
+	addTestNotification(t, s, "ops", t0, web1, db1)
+	addTestNotification(t, s, "dev", t0.Add(time.Hour), web2)
+	addTestNotification(t, s, "ops", t0.Add(2*time.Hour), resolved)
+
+	m, err := labels.ParseMatcher(`instance=~"web.*"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matchers := labels.Matchers{m}
+
+	for _, tc := range []struct {
+		name     string
+		q        Query
+		expected []string // 通知 ID/instance
+	}{
+		{name: "all", q: Query{}, expected: []string{"3/web1", "2/web2", "1/web1", "1/db1"}},
+		{name: "receiver", q: Query{Receiver: "ops"}, expected: []string{"3/web1", "1/web1", "1/db1"}},
+		{name: "status", q: Query{Status: "resolved"}, expected: []string{"3/web1"}},
+		{name: "matchers", q: Query{Matchers: matchers}, expected: []string{"3/web1", "2/web2", "1/web1"}},
+		{name: "start", q: Query{Start: t0.Add(time.Hour)}, expected: []string{"3/web1", "2/web2"}},
+		{name: "end", q: Query{End: t0.Add(time.Hour)}, expected: []string{"2/web2", "1/web1", "1/db1"}},
+		{name: "start and end", q: Query{Start: t0.Add(30 * time.Minute), End: t0.Add(90 * time.Minute)}, expected: []string{"2/web2"}},
+		{name: "limit within a notification", q: Query{Limit: 3}, expected: []string{"3/web1", "2/web2", "1/web1"}},
+		{name: "limit", q: Query{Receiver: "ops", Limit: 1}, expected: []string{"3/web1"}},
+		{name: "no match", q: Query{Receiver: "ops", Status: "resolved", Start: t0.Add(3 * time.Hour)}, expected: []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			alerts, err := s.Alerts(tc.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, a := range alerts {
+				got = append(got, a.NotificationID+"/"+a.Labels["instance"])
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Fatalf("expected alerts %v, got %v", tc.expected, got)
+			}
+		})
+	}
+
+	alerts, err := s.Alerts(Query{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := alerts[0]
+	if a.Receiver != "ops" || !a.ReceivedAt.Equal(t0.Add(2*time.Hour)) || len(a.Deliveries) != 1 || a.Deliveries[0].Fields != nil {
+		t.Fatalf("expected the deliveries without fields, got %+v", a)
+	}
+}
+
+func TestAlertsStopsBeforeStart(t *testing.T) {
+	t0 := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	alert := notify.Alert{Status: "firing", Labels: notify.KV{"alertname": "HighLatency"}}
+
+	// 通知按接收顺序存储，遇到第一条早于 Start 的通知就停止遍历，
+	// 时钟回拨时更早存储的通知即使在时间范围内也不会被返回
+	s := openTestStore(t, t.TempDir(), Options{})
+	addTestNotification(t, s, "ops", t0.Add(3*time.Hour), alert)
+	addTestNotification(t, s, "ops", t0, alert)
+	addTestNotification(t, s, "ops", t0.Add(2*time.Hour), alert)
+
+	alerts, err := s.Alerts(Query{Start: t0.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].NotificationID != "3" {
+		t.Fatalf("expected only notification 3, got %+v", alerts)
+	}
+}
@@ -0,0 +1,123 @@
+package labels
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MatchType is the comparison of a Matcher.
+type MatchType string
+
+// Possible MatchTypes.
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// Matcher matches the value of a label.
+type Matcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+
+	re *regexp.Regexp
+}
+
+var matcherRe = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*(.*?)\s*$`)
+
+// ParseMatcher parses a matcher such as severity="critical" or
+// instance=~"web-.*". The value may be quoted.
+func ParseMatcher(s string) (*Matcher, error) {
+	ms := matcherRe.FindStringSubmatch(s)
+	if ms == nil {
+		return nil, fmt.Errorf("invalid matcher %q", s)
+	}
+	m := &Matcher{Name: ms[1], Type: MatchType(ms[2]), Value: ms[3]}
+	if len(m.Value) >= 2 && strings.HasPrefix(m.Value, `"`) && strings.HasSuffix(m.Value, `"`) {
+		m.Value = m.Value[1 : len(m.Value)-1]
+	}
+	if m.Type == MatchRegexp || m.Type == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid matcher %q: %v", s, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches reports whether the labels match, a missing label matches the
+// empty string.
+func (m *Matcher) Matches(labels map[string]string) bool {
+	v := labels[m.Name]
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+func (m *Matcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface for Matcher.
+func (m *Matcher) MarshalYAML() (interface{}, error) {
+	return m.String(), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for Matcher.
+func (m *Matcher) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := ParseMatcher(s)
+	if err != nil {
+		return err
+	}
+	*m = *parsed
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for Matcher.
+func (m *Matcher) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Matcher.
+func (m *Matcher) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseMatcher(s)
+	if err != nil {
+		return err
+	}
+	*m = *parsed
+	return nil
+}
+
+// Matchers is a list of matchers that all have to match.
+type Matchers []*Matcher
+
+// Matches reports whether the labels match all matchers.
+func (ms Matchers) Matches(labels map[string]string) bool {
+	for _, m := range ms {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/prometheus/common/model"
+)
+
+// Actions that can be taken from the links of a notification.
+const (
+	ActionAck     = "ack"
+	ActionSilence = "silence"
+)
+
+// ErrInvalidActionToken is returned for a forged or malformed action token.
+var ErrInvalidActionToken = errors.New("invalid action token")
+
+// ErrActionTokenExpired is returned for an action token past its expiry.
+var ErrActionTokenExpired = errors.New("action token expired")
+
+// Ack is the acknowledgement of a firing alert.
+type Ack struct {
+	By      string    `json:"by"`
+	At      time.Time `json:"at"`
+	Comment string    `json:"comment,omitempty"`
+}
+
+// ActionLinks are the signed links to act on the alerts of a notification.
+type ActionLinks struct {
+	AckURL string `json:"ackURL,omitempty"`
+	// SilenceURL is empty when the alerts share no label.
+	SilenceURL string `json:"silenceURL,omitempty"`
+}
+
+// ActionClaims are the signed content of an action token.
+type ActionClaims struct {
+	Action   string `json:"a"`
+	Receiver string `json:"r"`
+	// Fingerprints are the fingerprints of the labels of the acknowledged
+	// alerts.
+	Fingerprints []string `json:"f,omitempty"`
+	// Labels are the equality matchers of the silence.
+	Labels  KV    `json:"l,omitempty"`
+	Expires int64 `json:"e"`
+}
+
+// ActionLinker signs the action links of notifications.
+type ActionLinker struct {
+	conf        *config.ActionsConfig
+	externalURL *url.URL
+}
+
+// NewActionLinker returns an ActionLinker for the links under the external
+// URL of Promoter, or nil if actions are not configured.
+func NewActionLinker(conf *config.ActionsConfig, externalURL *url.URL) *ActionLinker {
+	if conf == nil || externalURL == nil {
+		return nil
+	}
+	return &ActionLinker{conf: conf, externalURL: externalURL}
+}
+
+// Links returns the links of a firing notification, or nil if it is
+// resolved. The silence matches the labels shared by the firing alerts.
+func (l *ActionLinker) Links(data *Data, now time.Time) *ActionLinks {
+	if l == nil || data.Status != string(model.AlertFiring) {
+		return nil
+	}
+	expires := now.Add(time.Duration(l.conf.LinkTTL)).Unix()
+
+	var fps []string
+	for _, a := range data.Alerts.Firing() {
+		fps = append(fps, labelsFingerprint(a.Labels))
+	}
+	links := &ActionLinks{
+		AckURL: l.url(ActionAck, ActionClaims{Action: ActionAck, Receiver: data.Receiver, Fingerprints: fps, Expires: expires}),
+	}
+	if common := commonKV(data.Alerts.Firing(), func(a Alert) KV { return a.Labels }); len(common) > 0 {
+		links.SilenceURL = l.url(ActionSilence, ActionClaims{Action: ActionSilence, Receiver: data.Receiver, Labels: common, Expires: expires})
+	}
+	return links
+}
+
+func (l *ActionLinker) url(action string, claims ActionClaims) string {
+	u := *l.externalURL
+	u.Path = path.Join(u.Path, "/api/v1/actions", action)
+	u.RawQuery = url.Values{"token": {SignAction(l.conf.Secret, claims)}}.Encode()
+	return u.String()
+}
+
+// Verify returns the claims of a valid token.
+func (l *ActionLinker) Verify(token string, now time.Time) (*ActionClaims, error) {
+	return VerifyAction(l.conf.Secret, token, now)
+}
+
+// SignAction encodes the claims in a token signed with HMAC-SHA256.
+func SignAction(secret config.Secret, claims ActionClaims) string {
+	b, _ := json.Marshal(claims)
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + actionSignature(secret, payload)
+}
+
+// VerifyAction checks the signature and the expiry of the token and returns
+// its claims.
+func VerifyAction(secret config.Secret, token string, now time.Time) (*ActionClaims, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return nil, ErrInvalidActionToken
+	}
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(actionSignature(secret, payload))) {
+		return nil, ErrInvalidActionToken
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidActionToken
+	}
+	var claims ActionClaims
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return nil, ErrInvalidActionToken
+	}
+	if now.Unix() > claims.Expires {
+		return nil, ErrActionTokenExpired
+	}
+	return &claims, nil
+}
+
+func actionSignature(secret config.Secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
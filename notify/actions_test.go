@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/prometheus/common/model"
+)
+
+func TestVerifyAction(t *testing.T) {
+	now := time.Unix(1760774400, 0)
+	claims := ActionClaims{
+		Action:       ActionAck,
+		Receiver:     "ops",
+		Fingerprints: []string{"a1b2c3"},
+		Expires:      now.Add(time.Hour).Unix(),
+	}
+	token := SignAction("secret", claims)
+
+	got, err := VerifyAction("secret", token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, claims) {
+		t.Fatalf("unexpected claims %+v, want %+v", *got, claims)
+	}
+
+	i := strings.LastIndex(token, ".")
+	payload, sig := token[:i], token[i+1:]
+	forged := SignAction("secret", ActionClaims{Action: ActionAck, Receiver: "other", Expires: claims.Expires})
+	forgedPayload := forged[:strings.LastIndex(forged, ".")]
+
+	for _, tc := range []struct {
+		name   string
+		secret config.Secret
+		token  string
+		now    time.Time
+		err    error
+	}{
+		{name: "wrong secret", secret: "other", token: token, now: now, err: ErrInvalidActionToken},
+		{name: "tampered payload", secret: "secret", token: forgedPayload + "." + sig, now: now, err: ErrInvalidActionToken},
+		{name: "tampered signature", secret: "secret", token: payload + "." + sig[1:] + "A", now: now, err: ErrInvalidActionToken},
+		{name: "no signature", secret: "secret", token: payload, now: now, err: ErrInvalidActionToken},
+		{name: "expired", secret: "secret", token: token, now: now.Add(2 * time.Hour), err: ErrActionTokenExpired},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := VerifyAction(tc.secret, tc.token, tc.now); err != tc.err {
+				t.Fatalf("unexpected error %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestActionLinks(t *testing.T) {
+	externalURL, _ := url.Parse("https://promoter.example.com/prefix")
+	linker := NewActionLinker(&config.ActionsConfig{
+		Secret:  "secret",
+		LinkTTL: model.Duration(time.Hour),
+	}, externalURL)
+	now := time.Unix(1760774400, 0)
+
+	data := &Data{
+		Receiver: "ops",
+		Status:   string(model.AlertFiring),
+		Alerts: Alerts{
+			{Status: string(model.AlertFiring), Labels: KV{"alertname": "InstanceDown", "instance": "a"}},
+			{Status: string(model.AlertFiring), Labels: KV{"alertname": "InstanceDown", "instance": "b"}},
+			{Status: string(model.AlertResolved), Labels: KV{"alertname": "DiskFull", "instance": "a"}},
+		},
+	}
+	links := linker.Links(data, now)
+	if links == nil {
+		t.Fatal("expected links for a firing notification")
+	}
+
+	claims := verifyLink(t, linker, links.AckURL, "/prefix/api/v1/actions/ack", now)
+	if len(claims.Fingerprints) != 2 {
+		t.Fatalf("expected the fingerprints of the 2 firing alerts, got %v", claims.Fingerprints)
+	}
+	claims = verifyLink(t, linker, links.SilenceURL, "/prefix/api/v1/actions/silence", now)
+	if want := (KV{"alertname": "InstanceDown"}); !reflect.DeepEqual(claims.Labels, want) {
+		t.Fatalf("unexpected silence labels %v, want %v", claims.Labels, want)
+	}
+
+	data.Status = string(model.AlertResolved)
+	if links := linker.Links(data, now); links != nil {
+		t.Fatalf("expected no links for a resolved notification, got %+v", links)
+	}
+}
+
+func verifyLink(t *testing.T, linker *ActionLinker, link, path string, now time.Time) *ActionClaims {
+	t.Helper()
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != path {
+		t.Fatalf("unexpected path %q, want %q", u.Path, path)
+	}
+	claims, err := linker.Verify(u.Query().Get("token"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
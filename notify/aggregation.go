@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// batch is the pending notification of a receiver.
+type batch struct {
+	data     *Data
+	alerts   map[string]int // fingerprint -> index in data.Alerts
+	received int
+	timer    *time.Timer
+}
+
+// Aggregator buffers the notifications of receivers during their aggregation
+// window and merges them into a single notification, so that several
+// Alertmanager routes pointing at the same receiver send one message.
+type Aggregator struct {
+	logger log.Logger
+	flush  func(receiver string, data *Data)
+
+	mtx     sync.Mutex
+	batches map[string]*batch
+	// pending counts the batches not sent yet, including those being sent.
+	pending sync.WaitGroup
+}
+
+// NewAggregator returns an Aggregator calling flush with the merged
+// notification of a receiver once its window has elapsed.
+func NewAggregator(logger log.Logger, flush func(receiver string, data *Data)) *Aggregator {
+	return &Aggregator{
+		logger:  logger,
+		flush:   flush,
+		batches: map[string]*batch{},
+	}
+}
+
+// Add merges the notification into the pending one of the receiver. The
+// window starts with the first notification of a batch and is not extended
+// by the following ones, bounding the delay of every alert.
+func (ag *Aggregator) Add(receiver string, window time.Duration, data *Data) {
+	ag.mtx.Lock()
+	defer ag.mtx.Unlock()
+
+	b, ok := ag.batches[receiver]
+	if !ok {
+		b = &batch{data: &Data{Receiver: data.Receiver}, alerts: map[string]int{}}
+		ag.pending.Add(1)
+		b.timer = time.AfterFunc(window, func() { ag.flushReceiver(receiver) })
+		ag.batches[receiver] = b
+	}
+	b.merge(data)
+	level.Debug(ag.logger).Log("msg", "Notification buffered", "receiver", receiver, "alerts", len(b.data.Alerts), "notifications", b.received)
+}
+
+// Flush sends all pending notifications immediately and waits until those
+// already being sent by their window are sent too.
+func (ag *Aggregator) Flush() {
+	ag.mtx.Lock()
+	receivers := make([]string, 0, len(ag.batches))
+	for receiver := range ag.batches {
+		receivers = append(receivers, receiver)
+	}
+	ag.mtx.Unlock()
+
+	for _, receiver := range receivers {
+		ag.flushReceiver(receiver)
+	}
+	ag.pending.Wait()
+}
+
+func (ag *Aggregator) flushReceiver(receiver string) {
+	ag.mtx.Lock()
+	b, ok := ag.batches[receiver]
+	if ok {
+		b.timer.Stop()
+		delete(ag.batches, receiver)
+	}
+	ag.mtx.Unlock()
+
+	if !ok {
+		return
+	}
+	level.Debug(ag.logger).Log("msg", "Flushing aggregated notification", "receiver", receiver, "alerts", len(b.data.Alerts), "notifications", b.received)
+	defer ag.pending.Done()
+	ag.flush(receiver, b.finish())
+}
+
+// merge adds the alerts of the notification to the batch, the alerts of the
+// most recent notification win. Group labels are the intersection of the
+// group labels of all notifications.
+func (b *batch) merge(data *Data) {
+	if b.received == 0 {
+		b.data.GroupLabels = KV{}
+		for k, v := range data.GroupLabels {
+			b.data.GroupLabels[k] = v
+		}
+	} else {
+		for k, v := range b.data.GroupLabels {
+			if data.GroupLabels[k] != v {
+				delete(b.data.GroupLabels, k)
+			}
+		}
+	}
+	if b.data.ExternalURL == "" {
+		b.data.ExternalURL = data.ExternalURL
+	}
+	b.data.Images = append(b.data.Images, data.Images...)
+	b.received++
+
+	for _, a := range data.Alerts {
+		fp := a.Fingerprint
+		if fp == "" {
+			fp = labelsFingerprint(a.Labels)
+		}
+		if i, ok := b.alerts[fp]; ok {
+			b.data.Alerts[i] = a
+			continue
+		}
+		b.alerts[fp] = len(b.data.Alerts)
+		b.data.Alerts = append(b.data.Alerts, a)
+	}
+}
+
+// finish recomputes the status and the common labels and annotations of the
+// merged alerts.
+func (b *batch) finish() *Data {
+	merged := groupAlerts(b.data.Alerts)
+	merged.Receiver = b.data.Receiver
+	merged.GroupLabels = b.data.GroupLabels
+	merged.ExternalURL = b.data.ExternalURL
+	merged.Images = b.data.Images
+	return merged
+}
@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/model"
+)
+
+// flushRecorder records the notifications flushed by an Aggregator.
+type flushRecorder struct {
+	mtx     sync.Mutex
+	flushed map[string][]*Data
+}
+
+func (r *flushRecorder) flush(receiver string, data *Data) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.flushed[receiver] = append(r.flushed[receiver], data)
+}
+
+func (r *flushRecorder) get(receiver string) []*Data {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.flushed[receiver]
+}
+
+func newTestAggregator() (*Aggregator, *flushRecorder) {
+	r := &flushRecorder{flushed: map[string][]*Data{}}
+	return NewAggregator(log.NewNopLogger(), r.flush), r
+}
+
+func TestAggregatorMerge(t *testing.T) {
+	ag, r := newTestAggregator()
+	now := time.Now()
+	web1 := Alert{Status: string(model.AlertFiring), Labels: KV{"alertname": "HighLatency", "instance": "web1", "team": "web"}, StartsAt: now}
+	web2 := Alert{Status: string(model.AlertFiring), Labels: KV{"alertname": "HighLatency", "instance": "web2", "team": "web"}, StartsAt: now}
+
+	ag.Add("ops", time.Hour, &Data{
+		Receiver:    "ops",
+		ExternalURL: "http://alertmanager1",
+		GroupLabels: KV{"alertname": "HighLatency", "team": "web"},
+		Alerts:      Alerts{web1, web2},
+		Images:      []AlertImage{{Url: "http://images.example.com/1.png"}},
+	})
+	// 第二个通知中 web1 已经恢复，第一个通知没有 Fingerprint 时按标签计算后合并
+	resolved := web1
+	resolved.Status = string(model.AlertResolved)
+	resolved.EndsAt = now.Add(time.Minute)
+	resolved.Fingerprint = labelsFingerprint(resolved.Labels)
+	ag.Add("ops", time.Hour, &Data{
+		Receiver:    "ops",
+		ExternalURL: "http://alertmanager2",
+		GroupLabels: KV{"alertname": "HighLatency", "team": "api"},
+		Alerts:      Alerts{resolved},
+		Images:      []AlertImage{{Url: "http://images.example.com/2.png"}},
+	})
+	if flushed := r.get("ops"); len(flushed) != 0 {
+		t.Fatalf("expected no notification before the window elapsed, got %d", len(flushed))
+	}
+
+	ag.Flush()
+	flushed := r.get("ops")
+	if len(flushed) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(flushed))
+	}
+	data := flushed[0]
+	if len(data.Alerts) != 2 || data.Alerts[0].Status != string(model.AlertResolved) || data.Alerts[1].Labels["instance"] != "web2" {
+		t.Fatalf("expected the resolved web1 and the firing web2 in order, got %+v", data.Alerts)
+	}
+	if data.Status != string(model.AlertFiring) {
+		t.Fatalf("expected the notification to be firing, got %s", data.Status)
+	}
+	if len(data.GroupLabels) != 1 || data.GroupLabels["alertname"] != "HighLatency" {
+		t.Fatalf("expected the intersection of the group labels, got %v", data.GroupLabels)
+	}
+	if len(data.CommonLabels) != 2 || data.CommonLabels["team"] != "web" {
+		t.Fatalf("unexpected common labels %v", data.CommonLabels)
+	}
+	if data.Receiver != "ops" || data.ExternalURL != "http://alertmanager1" || len(data.Images) != 2 {
+		t.Fatalf("unexpected notification %+v", data)
+	}
+
+	// 最新的状态覆盖之前的状态
+	ag.Add("ops", time.Hour, &Data{Receiver: "ops", Alerts: Alerts{web2}})
+	resolved2 := web2
+	resolved2.Status = string(model.AlertResolved)
+	ag.Add("ops", time.Hour, &Data{Receiver: "ops", Alerts: Alerts{resolved2}})
+	ag.Flush()
+	if flushed := r.get("ops"); len(flushed) != 2 || flushed[1].Status != string(model.AlertResolved) || len(flushed[1].Alerts) != 1 {
+		t.Fatalf("expected a resolved notification of web2, got %+v", flushed[1:])
+	}
+}
+
+func TestAggregatorWindow(t *testing.T) {
+	ag, r := newTestAggregator()
+	alert := Alert{Status: string(model.AlertFiring), Labels: KV{"alertname": "Down"}}
+
+	ag.Add("ops", 50*time.Millisecond, &Data{Receiver: "ops", Alerts: Alerts{alert}})
+	ag.Add("dev", time.Hour, &Data{Receiver: "dev", Alerts: Alerts{alert}})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(r.get("ops")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the notification to be flushed after the window")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(r.get("dev")); n != 0 {
+		t.Fatalf("expected the window of dev to be pending, got %d notifications", n)
+	}
+
+	// 窗口结束后开始新的批次
+	ag.Add("ops", time.Hour, &Data{Receiver: "ops", Alerts: Alerts{alert}})
+	ag.Flush()
+	if ops, dev := len(r.get("ops")), len(r.get("dev")); ops != 2 || dev != 1 {
+		t.Fatalf("expected 2 notifications of ops and 1 of dev, got %d and %d", ops, dev)
+	}
+}
+
+func TestAggregatorFlushRacesTimer(t *testing.T) {
+	var sent, sending int32
+	ag := NewAggregator(log.NewNopLogger(), func(receiver string, data *Data) {
+		atomic.AddInt32(&sending, 1)
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&sent, 1)
+	})
+	alert := Alert{Status: string(model.AlertFiring), Labels: KV{"alertname": "Down"}}
+
+	for i := 0; i < 200; i++ {
+		// 窗口和 Flush 几乎同时结束
+		window := time.Duration(i%4) * 100 * time.Microsecond
+		ag.Add("ops", window, &Data{Receiver: "ops", Alerts: Alerts{alert}})
+		ag.Add("dev", window, &Data{Receiver: "dev", Alerts: Alerts{alert}})
+		time.Sleep(time.Duration(i%3) * 100 * time.Microsecond)
+		ag.Flush()
+
+		// Flush 返回时，所有批次都已经发送完成，并且每个批次只发送一次
+		if s, n := atomic.LoadInt32(&sent), atomic.LoadInt32(&sending); s != n || s != int32(2*(i+1)) {
+			t.Fatalf("round %d: expected %d notifications sent, got %d sent and %d sending", i, 2*(i+1), s, n)
+		}
+	}
+
+	// 没有批次时 Flush 立即返回
+	done := make(chan struct{})
+	go func() {
+		ag.Flush()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Flush to return without pending batches")
+	}
+}
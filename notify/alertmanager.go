@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/util"
+	commoncfg "github.com/prometheus/common/config"
+)
+
+// Alertmanager is a client of the Alertmanager API v2.
+type Alertmanager struct {
+	conf   *config.AlertmanagerConfig
+	client *http.Client
+}
+
+// NewAlertmanager returns an Alertmanager client for the configuration.
+func NewAlertmanager(conf *config.AlertmanagerConfig) (*Alertmanager, error) {
+	client, err := commoncfg.NewClientFromConfig(httpClientConfig(conf.HTTPConfig), "alertmanager")
+	if err != nil {
+		return nil, err
+	}
+	return &Alertmanager{conf: conf, client: client}, nil
+}
+
+// AlertmanagerMatcher is a matcher of an Alertmanager silence.
+type AlertmanagerMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual bool   `json:"isEqual"`
+}
+
+// AlertmanagerSilence is a silence of the Alertmanager API v2.
+type AlertmanagerSilence struct {
+	ID        string                `json:"id,omitempty"`
+	Matchers  []AlertmanagerMatcher `json:"matchers"`
+	StartsAt  time.Time             `json:"startsAt"`
+	EndsAt    time.Time             `json:"endsAt"`
+	CreatedBy string                `json:"createdBy"`
+	Comment   string                `json:"comment"`
+}
+
+// EqualMatchers returns the matchers of a silence matching the labels.
+func EqualMatchers(labels KV) []AlertmanagerMatcher {
+	matchers := make([]AlertmanagerMatcher, 0, len(labels))
+	for _, p := range labels.SortedPairs() {
+		matchers = append(matchers, AlertmanagerMatcher{Name: p.Name, Value: p.Value, IsEqual: true})
+	}
+	return matchers
+}
+
+// CreateSilence creates the silence and returns its ID.
+func (am *Alertmanager) CreateSilence(ctx context.Context, s AlertmanagerSilence) (string, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(s); err != nil {
+		return "", err
+	}
+
+	resp, err := util.PostJSON(ctx, am.client, am.url("/api/v2/silences"), &buf)
+	if err != nil {
+		return "", err
+	}
+	defer util.Drain(resp)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	var result struct {
+		SilenceID string `json:"silenceID"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	return result.SilenceID, nil
+}
+
+// SuppressedAlerts returns the label fingerprints of the alerts that are
+// silenced or inhibited in Alertmanager. Only the labels shared by the alerts
+// are used as filters, so that few alerts are returned.
+func (am *Alertmanager) SuppressedAlerts(ctx context.Context, alerts Alerts) (map[string]bool, error) {
+	q := url.Values{
+		"active":      {"false"},
+		"silenced":    {"true"},
+		"inhibited":   {"true"},
+		"unprocessed": {"false"},
+	}
+	common := commonKV(alerts, func(a Alert) KV { return a.Labels })
+	for _, p := range common.SortedPairs() {
+		q.Add("filter", p.Name+"="+strconv.Quote(p.Value))
+	}
+
+	resp, err := util.Get(ctx, am.client, am.url("/api/v2/alerts")+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer util.Drain(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	var result []struct {
+		Labels KV `json:"labels"`
+		Status struct {
+			State string `json:"state"`
+		} `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	suppressed := map[string]bool{}
+	for _, a := range result {
+		if a.Status.State == "suppressed" {
+			suppressed[labelsFingerprint(a.Labels)] = true
+		}
+	}
+	return suppressed, nil
+}
+
+func (am *Alertmanager) url(p string) string {
+	u := am.conf.URL.Copy()
+	u.Path = path.Join(u.Path, p)
+	return u.String()
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	commoncfg "github.com/prometheus/common/config"
+)
+
+func newTestAlertmanager(t *testing.T, handler http.HandlerFunc) *Alertmanager {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + "/am")
+	if err != nil {
+		t.Fatal(err)
+	}
+	am, err := NewAlertmanager(&config.AlertmanagerConfig{
+		URL:        &config.URL{URL: u},
+		HTTPConfig: &commoncfg.HTTPClientConfig{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return am
+}
+
+func TestAlertmanagerCreateSilence(t *testing.T) {
+	startsAt := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	want := AlertmanagerSilence{
+		Matchers:  EqualMatchers(KV{"job": "node", "alertname": "InstanceDown"}),
+		StartsAt:  startsAt,
+		EndsAt:    startsAt.Add(2 * time.Hour),
+		CreatedBy: "alice",
+		Comment:   "maintenance",
+	}
+
+	am := newTestAlertmanager(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/am/api/v2/silences" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var got AlertmanagerSilence
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode silence: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected silence %+v, want %+v", got, want)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"silenceID":"am-123"}`))
+	})
+
+	id, err := am.CreateSilence(context.Background(), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "am-123" {
+		t.Fatalf("unexpected silence ID %q", id)
+	}
+}
+
+func TestAlertmanagerCreateSilenceError(t *testing.T) {
+	am := newTestAlertmanager(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid matchers", http.StatusBadRequest)
+	})
+
+	if _, err := am.CreateSilence(context.Background(), AlertmanagerSilence{}); err == nil {
+		t.Fatal("expected an error for status 400")
+	}
+}
+
+func TestEqualMatchers(t *testing.T) {
+	got := EqualMatchers(KV{"job": "node", "alertname": "InstanceDown"})
+	want := []AlertmanagerMatcher{
+		{Name: "alertname", Value: "InstanceDown", IsEqual: true},
+		{Name: "job", Value: "node", IsEqual: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected matchers %+v, want %+v", got, want)
+	}
+}
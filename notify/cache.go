@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultCallTimeout bounds the coalesced calls when no timeout is set.
+const defaultCallTimeout = time.Minute
+
+// ImageCache caches query results and uploaded alert images for a TTL.
+// Concurrent calls for the same key are coalesced into a single call.
+// Its methods are goroutine safe.
+type ImageCache struct {
+	ttl     time.Duration
+	timeout time.Duration
+
+	mtx     sync.Mutex
+	entries map[string]cacheEntry
+	lastGC  time.Time
+
+	group singleflight.Group
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewImageCache returns a cache keeping values for ttl. A zero ttl only
+// coalesces concurrent calls without caching their results. The coalesced
+// calls are bounded by timeout, or a minute if it is zero.
+func NewImageCache(ttl, timeout time.Duration) *ImageCache {
+	if timeout <= 0 {
+		timeout = defaultCallTimeout
+	}
+	return &ImageCache{
+		ttl:     ttl,
+		timeout: timeout,
+		entries: map[string]cacheEntry{},
+		lastGC:  time.Now(),
+	}
+}
+
+// Do returns the cached value for key, or calls fn to compute it. Errors are
+// never cached. fn is shared by the coalesced callers, so it gets a context
+// of its own bounded by the timeout of the cache, while each caller only
+// waits until its ctx is done.
+func (c *ImageCache) Do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	if v, ok := c.get(key); ok {
+		return v, nil
+	}
+
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		if v, ok := c.get(key); ok {
+			return v, nil
+		}
+		// 不能使用第一个调用方的 ctx，否则它被取消时其他等待的调用方也会失败
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+		v, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.set(key, v)
+		return v, nil
+	})
+	select {
+	case r := <-ch:
+		return r.Val, r.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *ImageCache) get(key string) (interface{}, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *ImageCache) set(key string, v interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := time.Now()
+	c.entries[key] = cacheEntry{value: v, expires: now.Add(c.ttl)}
+
+	// 定期清理过期的缓存
+	if now.Sub(c.lastGC) > c.ttl {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastGC = now
+	}
+}
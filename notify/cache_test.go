@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestImageCache(t *testing.T) {
+	c := NewImageCache(50*time.Millisecond, time.Second)
+	var calls int32
+	fn := func(ctx context.Context) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+
+	for i := 0; i < 3; i++ {
+		v, err := c.Do(context.Background(), "a", fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.(int32) != 1 {
+			t.Fatalf("expected the cached value 1, got %v", v)
+		}
+	}
+	if v, _ := c.Do(context.Background(), "b", fn); v.(int32) != 2 {
+		t.Fatalf("expected a new value for another key, got %v", v)
+	}
+
+	// 过期后重新计算
+	time.Sleep(60 * time.Millisecond)
+	if v, _ := c.Do(context.Background(), "a", fn); v.(int32) != 3 {
+		t.Fatalf("expected a new value after the TTL, got %v", v)
+	}
+	// 写入时清理其他过期的缓存
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if _, ok := c.entries["b"]; ok || len(c.entries) != 1 {
+		t.Fatalf("expected the expired entry to be deleted, got %v", c.entries)
+	}
+}
+
+func TestImageCacheErrors(t *testing.T) {
+	c := NewImageCache(time.Minute, time.Second)
+	fail := errors.New("query failed")
+	var calls int
+	fn := func(ctx context.Context) (interface{}, error) {
+		calls++
+		if calls == 1 {
+			return nil, fail
+		}
+		return "image", nil
+	}
+
+	if _, err := c.Do(context.Background(), "a", fn); err != fail {
+		t.Fatalf("expected the error of the call, got %v", err)
+	}
+	// 错误不会被缓存
+	if v, err := c.Do(context.Background(), "a", fn); err != nil || v != "image" {
+		t.Fatalf("expected the call to be retried, got %v, %v", v, err)
+	}
+	c.Do(context.Background(), "a", fn)
+	if calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestImageCacheCoalesce(t *testing.T) {
+	// TTL 为 0 时不缓存，只合并并发的调用
+	c := NewImageCache(0, time.Second)
+	var calls int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "image", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.Do(context.Background(), "a", fn); err != nil || v != "image" {
+				t.Errorf("unexpected result %v, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expected the concurrent calls to be coalesced, got %d calls", n)
+	}
+
+	if _, err := c.Do(context.Background(), "a", fn); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("expected no caching with a zero TTL, got %d calls", n)
+	}
+}
+
+func TestImageCacheCanceledCaller(t *testing.T) {
+	c := NewImageCache(time.Minute, time.Second)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fnErr := make(chan error, 1)
+	fn := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		fnErr <- ctx.Err()
+		return "image", nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.Do(ctx, "a", fn)
+		first <- err
+	}()
+	<-started
+
+	second := make(chan interface{}, 1)
+	go func() {
+		v, _ := c.Do(context.Background(), "a", fn)
+		second <- v
+	}()
+
+	// 第一个调用方取消后立即返回，共享的调用不受影响
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("expected the canceled caller to return context.Canceled, got %v", err)
+	}
+	close(release)
+	if err := <-fnErr; err != nil {
+		t.Fatalf("expected the shared call not to be canceled, got %v", err)
+	}
+	if v := <-second; v != "image" {
+		t.Fatalf("expected the other caller to get the image, got %v", v)
+	}
+	if v, err := c.Do(context.Background(), "a", fn); err != nil || v != "image" {
+		t.Fatalf("expected the image to be cached, got %v, %v", v, err)
+	}
+}
+
+func TestImageCacheTimeout(t *testing.T) {
+	c := NewImageCache(time.Minute, 20*time.Millisecond)
+	_, err := c.Do(context.Background(), "a", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected the call to be bounded by the timeout, got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	prometheus "github.com/prometheus/client_golang/api"
+	prometheusApi "github.com/prometheus/client_golang/api/prometheus/v1"
+	commoncfg "github.com/prometheus/common/config"
+	promModel "github.com/prometheus/common/model"
+)
+
+// Datasource is a Prometheus-compatible query API used to fetch plot data.
+type Datasource struct {
+	Name string
+
+	conf *config.DatasourceConfig
+	api  prometheusApi.API
+}
+
+// NewDatasource returns a datasource querying the configured endpoint.
+func NewDatasource(conf *config.DatasourceConfig) (*Datasource, error) {
+	rt, err := commoncfg.NewRoundTripperFromConfig(httpClientConfig(conf.HTTPConfig), "datasource_"+conf.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(conf.Headers) > 0 {
+		rt = &headersRoundTripper{headers: conf.Headers, rt: rt}
+	}
+
+	client, err := prometheus.NewClient(prometheus.Config{
+		Address:      conf.URL.String(),
+		RoundTripper: rt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Prometheus client: %v", err)
+	}
+	return &Datasource{Name: conf.Name, conf: conf, api: prometheusApi.NewAPI(client)}, nil
+}
+
+// httpClientConfig returns the HTTP client settings, or the defaults for
+// configurations not loaded from YAML.
+func httpClientConfig(hc *commoncfg.HTTPClientConfig) commoncfg.HTTPClientConfig {
+	if hc == nil {
+		return commoncfg.DefaultHTTPClientConfig
+	}
+	return *hc
+}
+
+// Metrics runs a range query ending at queryTime and covering duration,
+// split into step points.
+func (ds *Datasource) Metrics(ctx context.Context, query string, queryTime time.Time, duration, step time.Duration) (promModel.Matrix, error) {
+	value, _, err := ds.api.QueryRange(ctx, query, prometheusApi.Range{
+		Start: queryTime.Add(-duration),
+		End:   queryTime,
+		Step:  duration / step,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Prometheus: %v", err)
+	}
+
+	metrics, ok := value.(promModel.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("unsupported result format: %s", value.Type().String())
+	}
+
+	return metrics, nil
+}
+
+// Check verifies that the query API is reachable by evaluating a constant
+// query, which every Prometheus-compatible backend supports.
+func (ds *Datasource) Check(ctx context.Context) error {
+	if _, _, err := ds.api.Query(ctx, "1", time.Now()); err != nil {
+		return fmt.Errorf("failed to query Prometheus: %v", err)
+	}
+	return nil
+}
+
+// matchLabels reports whether the alert labels satisfy all match_re regexps.
+func (ds *Datasource) matchLabels(labels KV) bool {
+	if len(ds.conf.MatchRE) == 0 {
+		return false
+	}
+	for name, re := range ds.conf.MatchRE {
+		if !re.MatchString(labels[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchHost reports whether host is served by this datasource.
+func (ds *Datasource) matchHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	if host == ds.conf.URL.Host {
+		return true
+	}
+	for _, h := range ds.conf.GeneratorHosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// Datasources selects the datasource used to plot a given alert.
+type Datasources struct {
+	label       string
+	datasources []*Datasource
+}
+
+// NewDatasources builds all configured datasources. If none are configured,
+// the global prometheus_url is used as the only datasource.
+func NewDatasources(conf *config.Config) (*Datasources, error) {
+	dsConfigs := conf.Datasources
+	if len(dsConfigs) == 0 && conf.Global.PrometheusURL != nil {
+		dsConfigs = []*config.DatasourceConfig{{
+			Name:       "default",
+			URL:        conf.Global.PrometheusURL,
+			HTTPConfig: conf.Global.HTTPConfig,
+		}}
+	}
+
+	dss := &Datasources{label: conf.Global.DatasourceLabel}
+	for _, dsc := range dsConfigs {
+		ds, err := NewDatasource(dsc)
+		if err != nil {
+			return nil, fmt.Errorf("datasource %q: %v", dsc.Name, err)
+		}
+		dss.datasources = append(dss.datasources, ds)
+	}
+	return dss, nil
+}
+
+// All returns all datasources in configuration order.
+func (dss *Datasources) All() []*Datasource {
+	if dss == nil {
+		return nil
+	}
+	return dss.datasources
+}
+
+// Select returns the datasource for the alert. The datasource named by the
+// datasource label wins, then one whose match_re matches the alert labels, then
+// one matching the generatorURL host. The first datasource is the fallback.
+// It returns nil if no datasource is configured.
+func (dss *Datasources) Select(alert Alert) *Datasource {
+	if dss == nil || len(dss.datasources) == 0 {
+		return nil
+	}
+
+	if dss.label != "" {
+		if name, ok := alert.Labels[dss.label]; ok {
+			for _, ds := range dss.datasources {
+				if ds.Name == name {
+					return ds
+				}
+			}
+		}
+	}
+
+	for _, ds := range dss.datasources {
+		if ds.matchLabels(alert.Labels) {
+			return ds
+		}
+	}
+
+	if u, err := url.Parse(alert.GeneratorURL); err == nil {
+		for _, ds := range dss.datasources {
+			if ds.matchHost(u.Host) {
+				return ds
+			}
+		}
+	}
+
+	return dss.datasources[0]
+}
+
+// headersRoundTripper sets static headers (e.g. tenant IDs) on every request.
+type headersRoundTripper struct {
+	headers map[string]string
+	rt      http.RoundTripper
+}
+
+func (h *headersRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	return h.rt.RoundTrip(req)
+}
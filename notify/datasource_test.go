@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/cnych/promoter/config"
+)
+
+func TestDatasourceMetrics(t *testing.T) {
+	var path, query, tenant string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		path, query, tenant = r.URL.Path, r.Form.Get("query"), r.Header.Get("X-Scope-OrgID")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"instance":"web-1"},"values":[[1760774400,"1"],[1760774460,"2"]]}]}}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL + "/prometheus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有 http_config 的数据源使用默认的 HTTP 配置
+	ds, err := NewDatasource(&config.DatasourceConfig{
+		Name:    "mimir",
+		URL:     &config.URL{URL: u},
+		Headers: map[string]string{"X-Scope-OrgID": "team-a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := ds.Metrics(context.Background(), "up", time.Unix(1760774460, 0), time.Minute, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/prometheus/api/v1/query_range" {
+		t.Errorf("unexpected path %q", path)
+	}
+	if query != "up" {
+		t.Errorf("unexpected query %q", query)
+	}
+	if tenant != "team-a" {
+		t.Errorf("unexpected X-Scope-OrgID header %q", tenant)
+	}
+	if len(metrics) != 1 || len(metrics[0].Values) != 2 || metrics[0].Metric["instance"] != "web-1" {
+		t.Fatalf("unexpected metrics %v", metrics)
+	}
+}
+
+func TestDatasourcesSelect(t *testing.T) {
+	newDatasource := func(name, rawURL string, conf config.DatasourceConfig) *Datasource {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf.Name, conf.URL = name, &config.URL{URL: u}
+		ds, err := NewDatasource(&conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ds
+	}
+	dss := &Datasources{
+		label: "datasource",
+		datasources: []*Datasource{
+			newDatasource("default", "http://prometheus:9090", config.DatasourceConfig{}),
+			newDatasource("eu", "http://prometheus-eu:9090", config.DatasourceConfig{
+				MatchRE: config.MatchRegexps{"region": config.Regexp{Regexp: regexp.MustCompile("^(?:eu-.*)$")}},
+			}),
+			newDatasource("thanos", "http://thanos:10902", config.DatasourceConfig{
+				GeneratorHosts: []string{"thanos-ruler:10902"},
+			}),
+		},
+	}
+
+	for _, tc := range []struct {
+		name  string
+		alert Alert
+		want  string
+	}{
+		{
+			name:  "fallback",
+			alert: Alert{Labels: KV{"alertname": "Down"}},
+			want:  "default",
+		},
+		{
+			name:  "datasource label",
+			alert: Alert{Labels: KV{"datasource": "thanos", "region": "eu-west"}},
+			want:  "thanos",
+		},
+		{
+			name:  "unknown datasource label",
+			alert: Alert{Labels: KV{"datasource": "missing", "region": "eu-west"}},
+			want:  "eu",
+		},
+		{
+			name:  "match_re",
+			alert: Alert{Labels: KV{"region": "eu-west"}, GeneratorURL: "http://thanos-ruler:10902/graph"},
+			want:  "eu",
+		},
+		{
+			name:  "generator host",
+			alert: Alert{Labels: KV{"region": "us-east"}, GeneratorURL: "http://thanos-ruler:10902/graph"},
+			want:  "thanos",
+		},
+		{
+			name:  "datasource url host",
+			alert: Alert{GeneratorURL: "http://prometheus-eu:9090/graph"},
+			want:  "eu",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := dss.Select(tc.alert).Name; got != tc.want {
+				t.Fatalf("expected datasource %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cnych/promoter/config"
@@ -38,20 +39,28 @@ func New(conf *config.DingtalkConfig, tmpl *template.Template, l log.Logger, htt
 	return &Notifier{conf: conf, tmpl: tmpl, logger: l, client: client}, nil
 }
 
-func (n *Notifier) Notify(ctx context.Context, data *notify.Data) (bool, error) {
-	var err error
-	tmpl := notify.TmplText(n.tmpl, data, &err)
-	if err != nil {
-		return false, err
-	}
-
+// message renders the DingTalk message for the data.
+func (n *Notifier) message(data *notify.Data) (*dingtalkMessage, error) {
 	var at dingtalkMessageAt
 	if n.conf.At != nil {
 		at = dingtalkMessageAt{
-			AtMobiles: n.conf.At.AtMobiles,
+			AtMobiles: append([]string{}, n.conf.At.AtMobiles...),
 			IsAtAll:   n.conf.At.IsAtAll,
 		}
 	}
+	// 根据报警标签解析出的人员也需要 @
+	for _, mobile := range data.Mentions().Mobiles() {
+		if !contains(at.AtMobiles, mobile) {
+			at.AtMobiles = append(at.AtMobiles, mobile)
+		}
+	}
+	// 模板中通过 .AtMobiles 在正文中 @ 所有人员
+	withAt := *data
+	withAt.AtMobiles = at.AtMobiles
+	data = &withAt
+
+	var err error
+	tmpl := notify.TmplText(n.tmpl, data, &err)
 	msg := &dingtalkMessage{
 		Type: n.conf.MessageType,
 		At:   &at,
@@ -61,6 +70,13 @@ func (n *Notifier) Notify(ctx context.Context, data *notify.Data) (bool, error)
 			Title: tmpl(n.conf.Markdown.Title),
 			Text:  tmpl(n.conf.Markdown.Text),
 		}
+	} else if msg.Type == "actionCard" {
+		msg.ActionCard = &dingtalkMessageActionCard{
+			Title:          tmpl(n.conf.ActionCard.Title),
+			Text:           tmpl(n.conf.ActionCard.Text),
+			BtnOrientation: n.conf.ActionCard.BtnOrientation,
+		}
+		n.addButtons(msg.ActionCard, data)
 	} else {
 		if n.conf.Text != nil {
 			msg.Text = &dingtalkMessageText{
@@ -69,6 +85,71 @@ func (n *Notifier) Notify(ctx context.Context, data *notify.Data) (bool, error)
 			}
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Render implements the notify.Renderer interface.
+func (n *Notifier) Render(data *notify.Data) (map[string]string, error) {
+	msg, err := n.message(data)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{
+		"message_type": msg.Type,
+		"at_mobiles":   strings.Join(msg.At.AtMobiles, ","),
+	}
+	if msg.Markdown != nil {
+		fields["title"] = msg.Markdown.Title
+		fields["text"] = msg.Markdown.Text
+	}
+	if msg.Text != nil {
+		fields["title"] = msg.Text.Title
+		fields["content"] = msg.Text.Content
+	}
+	if msg.ActionCard != nil {
+		fields["title"] = msg.ActionCard.Title
+		fields["text"] = msg.ActionCard.Text
+		var buttons []string
+		for _, b := range msg.ActionCard.Buttons {
+			buttons = append(buttons, b.Title+": "+b.ActionURL)
+		}
+		if msg.ActionCard.SingleURL != "" {
+			buttons = append(buttons, msg.ActionCard.SingleTitle+": "+msg.ActionCard.SingleURL)
+		}
+		fields["buttons"] = strings.Join(buttons, "\n")
+	}
+	return fields, nil
+}
+
+// addButtons links the buttons of the card to the actions of the
+// notification and to Alertmanager. DingTalk requires at least one button.
+func (n *Notifier) addButtons(card *dingtalkMessageActionCard, data *notify.Data) {
+	if data.Actions != nil {
+		card.Buttons = append(card.Buttons, dingtalkMessageButton{Title: "确认报警", ActionURL: data.Actions.AckURL})
+		if data.Actions.SilenceURL != "" {
+			card.Buttons = append(card.Buttons, dingtalkMessageButton{Title: "静默报警", ActionURL: data.Actions.SilenceURL})
+		}
+	}
+
+	detailsURL := data.ExternalURL
+	if detailsURL == "" && n.tmpl.ExternalURL != nil {
+		detailsURL = n.tmpl.ExternalURL.String()
+	}
+	if len(card.Buttons) == 0 {
+		card.SingleTitle, card.SingleURL = "查看详情", detailsURL
+	} else if detailsURL != "" {
+		card.Buttons = append(card.Buttons, dingtalkMessageButton{Title: "查看详情", ActionURL: detailsURL})
+	}
+}
+
+func (n *Notifier) Notify(ctx context.Context, data *notify.Data) (bool, error) {
+	msg, err := n.message(data)
+	if err != nil {
+		return false, err
+	}
 
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
@@ -126,10 +207,25 @@ type dingtalkResponse struct {
 }
 
 type dingtalkMessage struct {
-	Type     string                   `json:"msgtype,omitempty"`
-	Text     *dingtalkMessageText     `json:"text,omitempty"`
-	Markdown *dingtalkMessageMarkdown `json:"markdown,omitempty"`
-	At       *dingtalkMessageAt       `json:"at,omitempty"`
+	Type       string                     `json:"msgtype,omitempty"`
+	Text       *dingtalkMessageText       `json:"text,omitempty"`
+	Markdown   *dingtalkMessageMarkdown   `json:"markdown,omitempty"`
+	ActionCard *dingtalkMessageActionCard `json:"actionCard,omitempty"`
+	At         *dingtalkMessageAt         `json:"at,omitempty"`
+}
+
+type dingtalkMessageActionCard struct {
+	Title          string                  `json:"title"`
+	Text           string                  `json:"text"`
+	BtnOrientation string                  `json:"btnOrientation,omitempty"`
+	SingleTitle    string                  `json:"singleTitle,omitempty"`
+	SingleURL      string                  `json:"singleURL,omitempty"`
+	Buttons        []dingtalkMessageButton `json:"btns,omitempty"`
+}
+
+type dingtalkMessageButton struct {
+	Title     string `json:"title"`
+	ActionURL string `json:"actionURL"`
 }
 
 type dingtalkMessageText struct {
@@ -146,3 +242,12 @@ type dingtalkMessageAt struct {
 	AtMobiles []string `json:"atMobiles,omitempty"`
 	IsAtAll   bool     `json:"isAtAll,omitempty"`
 }
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,344 @@
+package notify
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// escalationInterval is how often due escalation steps are checked.
+	escalationInterval = 30 * time.Second
+	// escalationStaleAfter forgets alerts not notified again for this long,
+	// e.g. when their resolved notification is never sent.
+	escalationStaleAfter = 24 * time.Hour
+	// escalationTimeout bounds sending the notifications of a step.
+	escalationTimeout = time.Minute
+)
+
+// Escalation is the escalation step a notification is sent for.
+type Escalation struct {
+	Policy  string         `json:"policy"`
+	Step    int            `json:"step"`
+	After   model.Duration `json:"after"`
+	Targets []string       `json:"targets"`
+}
+
+// PendingEscalation is a firing alert tracked for escalation.
+type PendingEscalation struct {
+	Receiver   string     `json:"receiver"`
+	Policy     string     `json:"policy"`
+	Labels     KV         `json:"labels"`
+	StartsAt   time.Time  `json:"startsAt"`
+	StepsSent  int        `json:"stepsSent"`
+	NextStepAt *time.Time `json:"nextStepAt,omitempty"`
+	Acked      bool       `json:"acked,omitempty"`
+}
+
+// EscalationState is an alert tracked for escalation.
+type EscalationState struct {
+	Receiver    string    `json:"receiver"`
+	Alert       Alert     `json:"alert"`
+	ExternalURL string    `json:"externalURL"`
+	StartsAt    time.Time `json:"startsAt"`
+	LastSeen    time.Time `json:"lastSeen"`
+	// Sent is the number of steps of the policy already sent.
+	Sent  int  `json:"sent"`
+	Acked bool `json:"acked,omitempty"`
+}
+
+// EscalationStore persists the alerts tracked for escalation by key.
+type EscalationStore interface {
+	Escalations() (map[string]*EscalationState, error)
+	// SaveEscalations stores the changed alerts and deletes the forgotten ones.
+	SaveEscalations(changed map[string]*EscalationState, deleted []string) error
+}
+
+// Escalator re-notifies the alerts of receivers with an escalation policy
+// while they keep firing. Alerts are tracked from the notifications of the
+// receivers until they are resolved, or until they have not been notified for
+// escalationStaleAfter. With a store the tracked alerts survive restarts,
+// otherwise a restart forgets them until their next notification. Only the
+// last due step is sent when several steps are due at once, and nothing is
+// sent once the last step of the policy has been sent.
+type Escalator struct {
+	logger log.Logger
+	muter  Muter
+	store  EscalationStore
+
+	mtx          sync.Mutex
+	conf         *config.Config
+	directory    *Directory
+	linker       *ActionLinker
+	integrations map[string][]Integration
+	alerts       map[string]*EscalationState
+}
+
+// NewEscalator returns a new Escalator. Alerts muted by the muter are not
+// escalated until they are unmuted. The tracked alerts are loaded from and
+// saved to the store. The muter and the store may be nil.
+func NewEscalator(logger log.Logger, muter Muter, store EscalationStore) *Escalator {
+	e := &Escalator{
+		logger: logger,
+		muter:  muter,
+		store:  store,
+		alerts: map[string]*EscalationState{},
+	}
+	if store != nil {
+		alerts, err := store.Escalations()
+		if err != nil {
+			level.Error(logger).Log("msg", "Loading escalations failed", "err", err)
+		} else {
+			e.alerts = alerts
+		}
+	}
+	return e
+}
+
+// save persists the changes of the tracked alerts, e.mtx must be held.
+func (e *Escalator) save(changed map[string]*EscalationState, deleted []string) {
+	if e.store == nil || len(changed) == 0 && len(deleted) == 0 {
+		return
+	}
+	if err := e.store.SaveEscalations(changed, deleted); err != nil {
+		level.Error(e.logger).Log("msg", "Saving escalations failed", "err", err)
+	}
+}
+
+// Update sets the configuration, the directory resolving the step targets,
+// the linker of the action links, which may be nil, and the integrations of
+// every receiver.
+func (e *Escalator) Update(conf *config.Config, directory *Directory, linker *ActionLinker, integrations map[string][]Integration) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.conf = conf
+	e.directory = directory
+	e.linker = linker
+	e.integrations = integrations
+}
+
+// Ack stops escalating the alerts of the receiver with the given label
+// fingerprints and returns how many were tracked.
+func (e *Escalator) Ack(receiver string, fingerprints []string) int {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	changed := map[string]*EscalationState{}
+	for _, fp := range fingerprints {
+		key := receiver + "\xff" + fp
+		if ea, ok := e.alerts[key]; ok {
+			ea.Acked = true
+			changed[key] = ea
+		}
+	}
+	e.save(changed, nil)
+	return len(changed)
+}
+
+// Observe tracks the firing alerts of a notification of the receiver and
+// forgets the resolved ones. Alerts with an acknowledgement attached are not
+// escalated.
+func (e *Escalator) Observe(receiver string, data *Data) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.conf == nil {
+		return
+	}
+	rcv := e.conf.GetReceiver(receiver)
+	if rcv == nil || rcv.EscalationPolicy == "" {
+		return
+	}
+
+	now := time.Now()
+	changed := map[string]*EscalationState{}
+	var deleted []string
+	for _, a := range data.Alerts {
+		key := receiver + "\xff" + labelsFingerprint(a.Labels)
+		if !a.firing(now) {
+			if _, ok := e.alerts[key]; ok {
+				delete(e.alerts, key)
+				deleted = append(deleted, key)
+			}
+			continue
+		}
+		if ea, ok := e.alerts[key]; ok {
+			ea.Alert = a
+			ea.LastSeen = now
+			ea.Acked = ea.Acked || a.Ack != nil
+			changed[key] = ea
+			continue
+		}
+		startsAt := a.StartsAt
+		if startsAt.IsZero() {
+			startsAt = now
+		}
+		e.alerts[key] = &EscalationState{
+			Receiver:    receiver,
+			Alert:       a,
+			ExternalURL: data.ExternalURL,
+			StartsAt:    startsAt,
+			LastSeen:    now,
+			Acked:       a.Ack != nil,
+		}
+		changed[key] = e.alerts[key]
+	}
+	e.save(changed, deleted)
+}
+
+// Run sends the due escalation steps until stop is closed.
+func (e *Escalator) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(escalationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.escalate(time.Now())
+		case <-stop:
+			return
+		}
+	}
+}
+
+type escalationJob struct {
+	data         *Data
+	integrations []Integration
+}
+
+func (e *Escalator) escalate(now time.Time) {
+	var jobs []escalationJob
+
+	e.mtx.Lock()
+	if e.conf == nil {
+		e.mtx.Unlock()
+		return
+	}
+	changed := map[string]*EscalationState{}
+	var deleted []string
+	for key, ea := range e.alerts {
+		var policy *config.EscalationPolicyConfig
+		if rcv := e.conf.GetReceiver(ea.Receiver); rcv != nil {
+			policy = e.conf.GetEscalationPolicy(rcv.EscalationPolicy)
+		}
+		// 超过 endsAt 或者长时间没有再收到通知的报警可能永远不会收到恢复通知，不再跟踪
+		ended := !ea.Alert.EndsAt.IsZero() && !ea.Alert.EndsAt.After(now)
+		if policy == nil || ended || now.Sub(ea.LastSeen) > escalationStaleAfter {
+			delete(e.alerts, key)
+			deleted = append(deleted, key)
+			continue
+		}
+		// 已确认的报警不再升级；静默期间不升级，静默结束后只发送最后一个到期的步骤
+		if ea.Acked || e.muter != nil && e.muter.Mutes(ea.Receiver, ea.Alert, now) {
+			continue
+		}
+
+		due := dueSteps(policy, ea.StartsAt, ea.Sent, now)
+		if due <= ea.Sent {
+			continue
+		}
+		step := policy.Steps[due-1]
+		ea.Sent = due
+		changed[key] = ea
+
+		a := ea.Alert
+		a.Mentions = e.directory.ResolveNames(step.Targets, now)
+		data := &Data{
+			Receiver:          ea.Receiver,
+			Status:            string(model.AlertFiring),
+			Alerts:            Alerts{a},
+			GroupLabels:       KV{string(model.AlertNameLabel): a.Labels[string(model.AlertNameLabel)]},
+			CommonLabels:      a.Labels,
+			CommonAnnotations: a.Annotations,
+			ExternalURL:       ea.ExternalURL,
+			Escalation: &Escalation{
+				Policy:  policy.Name,
+				Step:    ea.Sent,
+				After:   step.After,
+				Targets: step.Targets,
+			},
+		}
+		data.Actions = e.linker.Links(data, now)
+		jobs = append(jobs, escalationJob{data: data, integrations: e.integrations[ea.Receiver]})
+	}
+	e.save(changed, deleted)
+	e.mtx.Unlock()
+
+	for _, job := range jobs {
+		logger := log.With(e.logger, "receiver", job.data.Receiver, "policy", job.data.Escalation.Policy, "step", job.data.Escalation.Step)
+		level.Info(logger).Log("msg", "Escalating alert", "alert", job.data.CommonLabels[string(model.AlertNameLabel)])
+
+		ctx, cancel := context.WithTimeout(context.Background(), escalationTimeout)
+		for _, i := range job.integrations {
+			filtered := i.Filter(job.data)
+			if filtered == nil {
+				continue
+			}
+			if _, err := i.Notify(ctx, filtered); err != nil {
+				level.Error(logger).Log("msg", "Send escalation failed", "integration", i, "err", err)
+			}
+		}
+		cancel()
+	}
+}
+
+// dueSteps returns the number of steps of the policy due at now for an alert
+// started at startsAt of which sent steps were sent. Steps never become due
+// again and the result is at most the number of steps, when several steps
+// are due at once only the last one is sent.
+func dueSteps(policy *config.EscalationPolicyConfig, startsAt time.Time, sent int, now time.Time) int {
+	due := sent
+	for due < len(policy.Steps) && !now.Before(startsAt.Add(time.Duration(policy.Steps[due].After))) {
+		due++
+	}
+	return due
+}
+
+// Pending returns the tracked alerts sorted by receiver and start time.
+func (e *Escalator) Pending() []PendingEscalation {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	pending := []PendingEscalation{}
+	for _, ea := range e.alerts {
+		rcv := e.conf.GetReceiver(ea.Receiver)
+		if rcv == nil {
+			continue
+		}
+		p := PendingEscalation{
+			Receiver:  ea.Receiver,
+			Policy:    rcv.EscalationPolicy,
+			Labels:    ea.Alert.Labels,
+			StartsAt:  ea.StartsAt,
+			StepsSent: ea.Sent,
+			Acked:     ea.Acked,
+		}
+		if policy := e.conf.GetEscalationPolicy(rcv.EscalationPolicy); policy != nil && ea.Sent < len(policy.Steps) {
+			next := ea.StartsAt.Add(time.Duration(policy.Steps[ea.Sent].After))
+			p.NextStepAt = &next
+		}
+		pending = append(pending, p)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].Receiver != pending[j].Receiver {
+			return pending[i].Receiver < pending[j].Receiver
+		}
+		return pending[i].StartsAt.Before(pending[j].StartsAt)
+	})
+	return pending
+}
+
+func labelsFingerprint(labels KV) string {
+	ls := make(model.LabelSet, len(labels))
+	for k, v := range labels {
+		ls[model.LabelName(k)] = model.LabelValue(v)
+	}
+	return ls.Fingerprint().String()
+}
@@ -0,0 +1,287 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/model"
+)
+
+const escalationTestConfig = `
+global:
+  dingtalk_api_url: http://dingtalk.example.com/robot/send
+  dingtalk_api_token: token
+  dingtalk_api_secret: secret
+users:
+  - name: alice
+    mobile: "13800000001"
+  - name: bob
+    mobile: "13800000002"
+escalation_policies:
+  - name: payments
+    steps:
+      - after: 10m
+        targets: [alice]
+      - after: 30m
+        targets: [bob]
+      - after: 1h
+        targets: [alice, bob]
+receivers:
+  - name: payments
+    escalation_policy: payments
+    dingtalk_configs:
+      - message_type: markdown
+`
+
+type recordingNotifier struct {
+	mtx  sync.Mutex
+	sent []*Data
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, data *Data) (bool, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.sent = append(n.sent, data)
+	return false, nil
+}
+
+func (n *recordingNotifier) reset() []*Data {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	sent := n.sent
+	n.sent = nil
+	return sent
+}
+
+// memEscalationStore keeps the escalations JSON encoded like history.Store.
+type memEscalationStore map[string][]byte
+
+func (s memEscalationStore) Escalations() (map[string]*EscalationState, error) {
+	states := map[string]*EscalationState{}
+	for k, v := range s {
+		var state EscalationState
+		if err := json.Unmarshal(v, &state); err != nil {
+			return nil, err
+		}
+		states[k] = &state
+	}
+	return states, nil
+}
+
+func (s memEscalationStore) SaveEscalations(changed map[string]*EscalationState, deleted []string) error {
+	for k, state := range changed {
+		v, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		s[k] = v
+	}
+	for _, k := range deleted {
+		delete(s, k)
+	}
+	return nil
+}
+
+func newTestEscalator(t *testing.T, store EscalationStore) (*Escalator, *recordingNotifier) {
+	t.Helper()
+
+	conf, err := config.Load(escalationTestConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcv := conf.GetReceiver("payments")
+	notifier := &recordingNotifier{}
+	e := NewEscalator(log.NewNopLogger(), nil, store)
+	e.Update(conf, NewDirectory(conf), nil, map[string][]Integration{
+		"payments": {NewIntegration(notifier, rcv.DingtalkConfigs[0].NotifierConfig, "dingtalk", 0)},
+	})
+	return e, notifier
+}
+
+func TestDueSteps(t *testing.T) {
+	policy := &config.EscalationPolicyConfig{
+		Name: "payments",
+		Steps: []*config.EscalationStepConfig{
+			{After: model.Duration(10 * time.Minute)},
+			{After: model.Duration(30 * time.Minute)},
+			{After: model.Duration(time.Hour)},
+		},
+	}
+	now := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		firing   time.Duration
+		sent     int
+		expected int
+	}{
+		{name: "not due", firing: 5 * time.Minute, expected: 0},
+		{name: "first step at its after", firing: 10 * time.Minute, expected: 1},
+		{name: "several steps due", firing: 45 * time.Minute, expected: 2},
+		{name: "already sent", firing: 45 * time.Minute, sent: 2, expected: 2},
+		{name: "next step", firing: 2 * time.Hour, sent: 1, expected: 3},
+		{name: "capped at the last step", firing: 48 * time.Hour, sent: 3, expected: 3},
+		{name: "started in the future", firing: -time.Minute, expected: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if due := dueSteps(policy, now.Add(-tc.firing), tc.sent, now); due != tc.expected {
+				t.Fatalf("expected %d due steps, got %d", tc.expected, due)
+			}
+		})
+	}
+}
+
+func TestEscalatorSendsLastDueStep(t *testing.T) {
+	e, notifier := newTestEscalator(t, nil)
+	now := time.Now()
+
+	e.Observe("payments", &Data{Alerts: Alerts{{
+		Status:   string(model.AlertFiring),
+		Labels:   KV{"alertname": "HighLatency"},
+		StartsAt: now.Add(-45 * time.Minute),
+	}}})
+
+	e.escalate(now)
+	sent := notifier.reset()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 escalation, got %d", len(sent))
+	}
+	esc := sent[0].Escalation
+	if esc.Step != 2 || len(esc.Targets) != 1 || esc.Targets[0] != "bob" {
+		t.Fatalf("expected step 2 for bob, got %+v", esc)
+	}
+	if m := sent[0].Alerts[0].Mentions; len(m) != 1 || m[0].Mobile != "13800000002" {
+		t.Fatalf("expected bob to be mentioned, got %+v", m)
+	}
+
+	e.escalate(now.Add(time.Minute))
+	if sent := notifier.reset(); len(sent) != 0 {
+		t.Fatalf("expected no escalation before the next step, got %d", len(sent))
+	}
+
+	e.escalate(now.Add(15 * time.Minute))
+	if sent := notifier.reset(); len(sent) != 1 || sent[0].Escalation.Step != 3 {
+		t.Fatalf("expected step 3, got %d escalations", len(sent))
+	}
+
+	e.escalate(now.Add(10 * time.Hour))
+	if sent := notifier.reset(); len(sent) != 0 {
+		t.Fatalf("expected no escalation after the last step, got %d", len(sent))
+	}
+}
+
+func TestEscalatorStopsEscalating(t *testing.T) {
+	now := time.Now()
+	alert := Alert{
+		Status:   string(model.AlertFiring),
+		Labels:   KV{"alertname": "HighLatency"},
+		StartsAt: now.Add(-45 * time.Minute),
+	}
+
+	for _, tc := range []struct {
+		name string
+		// untracked does not notify the firing alert before update.
+		untracked bool
+		update    func(e *Escalator)
+		at        time.Time
+	}{
+		{
+			name: "resolved",
+			update: func(e *Escalator) {
+				resolved := alert
+				resolved.Status = string(model.AlertResolved)
+				e.Observe("payments", &Data{Alerts: Alerts{resolved}})
+			},
+			at: now,
+		},
+		{
+			name: "acknowledged",
+			update: func(e *Escalator) {
+				e.Ack("payments", []string{labelsFingerprint(alert.Labels)})
+			},
+			at: now,
+		},
+		{
+			name:      "acknowledged before tracked",
+			untracked: true,
+			update: func(e *Escalator) {
+				acked := alert
+				acked.Ack = &Ack{By: "alice", At: now}
+				e.Observe("payments", &Data{Alerts: Alerts{acked}})
+			},
+			at: now,
+		},
+		{
+			name:   "stale",
+			update: func(e *Escalator) {},
+			at:     now.Add(escalationStaleAfter + time.Minute),
+		},
+		{
+			name: "ended",
+			update: func(e *Escalator) {
+				ending := alert
+				ending.EndsAt = now.Add(time.Minute)
+				e.Observe("payments", &Data{Alerts: Alerts{ending}})
+			},
+			at: now.Add(2 * time.Minute),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e, notifier := newTestEscalator(t, nil)
+			if !tc.untracked {
+				e.Observe("payments", &Data{Alerts: Alerts{alert}})
+			}
+			tc.update(e)
+
+			e.escalate(tc.at)
+			if sent := notifier.reset(); len(sent) != 0 {
+				t.Fatalf("expected no escalation, got %d", len(sent))
+			}
+		})
+	}
+}
+
+func TestEscalatorStore(t *testing.T) {
+	store := memEscalationStore{}
+	e, notifier := newTestEscalator(t, store)
+	now := time.Now()
+
+	alert := Alert{
+		Status:   string(model.AlertFiring),
+		Labels:   KV{"alertname": "HighLatency"},
+		StartsAt: now.Add(-45 * time.Minute),
+	}
+	e.Observe("payments", &Data{ExternalURL: "http://alertmanager", Alerts: Alerts{alert}})
+	e.escalate(now)
+	if sent := notifier.reset(); len(sent) != 1 {
+		t.Fatalf("expected 1 escalation, got %d", len(sent))
+	}
+
+	// 重启后从存储中恢复，已经发送的步骤不再重复发送
+	restarted, notifier := newTestEscalator(t, store)
+	pending := restarted.Pending()
+	if len(pending) != 1 || pending[0].StepsSent != 2 || !pending[0].StartsAt.Equal(alert.StartsAt) {
+		t.Fatalf("unexpected pending escalations after restart %+v", pending)
+	}
+	restarted.escalate(now.Add(time.Minute))
+	if sent := notifier.reset(); len(sent) != 0 {
+		t.Fatalf("expected no escalation after restart, got %d", len(sent))
+	}
+	restarted.escalate(now.Add(15 * time.Minute))
+	sent := notifier.reset()
+	if len(sent) != 1 || sent[0].Escalation.Step != 3 || sent[0].ExternalURL != "http://alertmanager" {
+		t.Fatalf("expected step 3 after restart, got %d escalations", len(sent))
+	}
+
+	resolved := alert
+	resolved.Status = string(model.AlertResolved)
+	restarted.Observe("payments", &Data{Alerts: Alerts{resolved}})
+	if len(store) != 0 {
+		t.Fatalf("expected the resolved alert to be deleted from the store, got %d", len(store))
+	}
+}
@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/util"
+	commoncfg "github.com/prometheus/common/config"
+)
+
+// Annotations referencing the Grafana panel of an alert.
+const (
+	GrafanaDashboardUIDAnnotation = "grafana_dashboard_uid"
+	GrafanaPanelIDAnnotation      = "grafana_panel_id"
+)
+
+// GrafanaPanel identifies a dashboard panel and its template variables.
+type GrafanaPanel struct {
+	DashboardUID string
+	PanelID      int
+	Vars         map[string]string
+}
+
+func (p GrafanaPanel) String() string {
+	vars := make([]string, 0, len(p.Vars))
+	for _, kv := range KV(p.Vars).SortedPairs() {
+		vars = append(vars, kv.Name+"="+kv.Value)
+	}
+	return fmt.Sprintf("%s/%d{%s}", p.DashboardUID, p.PanelID, strings.Join(vars, ","))
+}
+
+// Grafana renders dashboard panels with the Grafana image renderer.
+type Grafana struct {
+	conf   *config.GrafanaConfig
+	client *http.Client
+}
+
+// NewGrafana returns a Grafana client for the configuration.
+func NewGrafana(conf *config.GrafanaConfig) (*Grafana, error) {
+	client, err := commoncfg.NewClientFromConfig(httpClientConfig(conf.HTTPConfig), "grafana")
+	if err != nil {
+		return nil, err
+	}
+	return &Grafana{conf: conf, client: client}, nil
+}
+
+// Panel returns the panel referenced by the alert annotations. The alert
+// labels listed in var_labels are passed as dashboard variables.
+func (g *Grafana) Panel(alert Alert) (GrafanaPanel, error) {
+	uid := alert.Annotations[GrafanaDashboardUIDAnnotation]
+	if uid == "" {
+		return GrafanaPanel{}, fmt.Errorf("missing %s annotation", GrafanaDashboardUIDAnnotation)
+	}
+	panelID, err := strconv.Atoi(alert.Annotations[GrafanaPanelIDAnnotation])
+	if err != nil {
+		return GrafanaPanel{}, fmt.Errorf("invalid %s annotation: %v", GrafanaPanelIDAnnotation, err)
+	}
+
+	vars := map[string]string{}
+	for _, name := range g.conf.VarLabels {
+		if v, ok := alert.Labels[name]; ok {
+			vars[name] = v
+		}
+	}
+	return GrafanaPanel{DashboardUID: uid, PanelID: panelID, Vars: vars}, nil
+}
+
+// Render returns the PNG image of the panel between from and to.
+func (g *Grafana) Render(ctx context.Context, panel GrafanaPanel, from, to time.Time) ([]byte, error) {
+	u := g.conf.URL.Copy()
+	u.Path = strings.TrimRight(u.Path, "/") + "/render/d-solo/" + url.PathEscape(panel.DashboardUID) + "/_"
+
+	q := url.Values{}
+	q.Set("orgId", strconv.Itoa(g.conf.OrgID))
+	q.Set("panelId", strconv.Itoa(panel.PanelID))
+	q.Set("from", strconv.FormatInt(from.UnixNano()/int64(time.Millisecond), 10))
+	q.Set("to", strconv.FormatInt(to.UnixNano()/int64(time.Millisecond), 10))
+	q.Set("width", strconv.Itoa(g.conf.Width))
+	q.Set("height", strconv.Itoa(g.conf.Height))
+	q.Set("theme", g.conf.Theme)
+	if g.conf.Timezone != "" {
+		q.Set("tz", g.conf.Timezone)
+	}
+	for k, v := range panel.Vars {
+		q.Set("var-"+k, v)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", util.UserAgentHeader)
+	if g.conf.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+string(g.conf.APIKey))
+	}
+
+	resp, err := g.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, util.RedactURL(err)
+	}
+	defer util.Drain(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %v rendering grafana panel %s", resp.StatusCode, panel)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "image/png") {
+		return nil, fmt.Errorf("unexpected content type %q rendering grafana panel %s", ct, panel)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
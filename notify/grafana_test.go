@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	commoncfg "github.com/prometheus/common/config"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\nstub")
+
+func newTestGrafana(t *testing.T, handler http.HandlerFunc) *Grafana {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + "/grafana/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := config.DefaultGrafanaConfig
+	conf.URL = &config.URL{URL: u}
+	conf.APIKey = "key"
+	conf.HTTPConfig = &commoncfg.HTTPClientConfig{}
+	conf.Timezone = "Asia/Shanghai"
+	conf.VarLabels = []string{"instance"}
+
+	g, err := NewGrafana(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestGrafanaPanel(t *testing.T) {
+	g := newTestGrafana(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	panel, err := g.Panel(Alert{
+		Labels: KV{"alertname": "HighLatency", "instance": "web-1"},
+		Annotations: KV{
+			GrafanaDashboardUIDAnnotation: "abc",
+			GrafanaPanelIDAnnotation:      "4",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := GrafanaPanel{DashboardUID: "abc", PanelID: 4, Vars: map[string]string{"instance": "web-1"}}
+	if !reflect.DeepEqual(panel, want) {
+		t.Fatalf("unexpected panel %+v, want %+v", panel, want)
+	}
+
+	if _, err := g.Panel(Alert{Annotations: KV{GrafanaDashboardUIDAnnotation: "abc"}}); err == nil {
+		t.Fatal("expected an error for a missing panel ID")
+	}
+	if _, err := g.Panel(Alert{Annotations: KV{GrafanaPanelIDAnnotation: "4"}}); err == nil {
+		t.Fatal("expected an error for a missing dashboard UID")
+	}
+}
+
+func TestGrafanaRender(t *testing.T) {
+	from := time.Unix(1760774400, 0)
+	to := from.Add(time.Hour)
+
+	g := newTestGrafana(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/grafana/render/d-solo/abc/_" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer key" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		want := url.Values{
+			"orgId":        {"1"},
+			"panelId":      {"4"},
+			"from":         {"1760774400000"},
+			"to":           {"1760778000000"},
+			"width":        {"1000"},
+			"height":       {"500"},
+			"theme":        {"light"},
+			"tz":           {"Asia/Shanghai"},
+			"var-instance": {"web-1"},
+		}
+		if got := r.URL.Query(); !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected query %v, want %v", got, want)
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testPNG)
+	})
+
+	panel := GrafanaPanel{DashboardUID: "abc", PanelID: 4, Vars: map[string]string{"instance": "web-1"}}
+	b, err := g.Render(context.Background(), panel, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, testPNG) {
+		t.Fatalf("unexpected image %q", b)
+	}
+}
+
+func TestGrafanaRenderErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		status      int
+		contentType string
+	}{
+		{name: "status", status: http.StatusInternalServerError, contentType: "image/png"},
+		// 未安装 image renderer 插件时 Grafana 返回登录页或错误页面
+		{name: "content type", status: http.StatusOK, contentType: "text/html"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newTestGrafana(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				w.WriteHeader(tc.status)
+			})
+			if _, err := g.Render(context.Background(), GrafanaPanel{DashboardUID: "abc", PanelID: 4}, time.Now().Add(-time.Hour), time.Now()); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,403 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/util"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+)
+
+// Image providers.
+const (
+	ImageProviderPrometheus = "prometheus"
+	ImageProviderGrafana    = "grafana"
+	ImageProviderNone       = "none"
+)
+
+// ImageProviderAnnotation overrides the image provider of a single alert.
+const ImageProviderAnnotation = "image_provider"
+
+// Imager makes the images of alert notifications from the configured
+// datasources or Grafana panels.
+type Imager struct {
+	conf        *config.Config
+	datasources *Datasources
+	grafana     *Grafana
+	cache       *ImageCache
+}
+
+// NewImager returns an Imager for the configuration.
+func NewImager(conf *config.Config) (*Imager, error) {
+	datasources, err := NewDatasources(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var grafana *Grafana
+	if conf.Grafana != nil {
+		if grafana, err = NewGrafana(conf.Grafana); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Imager{
+		conf:        conf,
+		datasources: datasources,
+		grafana:     grafana,
+		cache:       NewImageCache(time.Duration(conf.Plot.CacheTTL), time.Duration(conf.Plot.Timeout)),
+	}, nil
+}
+
+// HasSources reports whether any datasource or Grafana is configured to make
+// images from.
+func (imager *Imager) HasSources() bool {
+	return len(imager.datasources.All()) > 0 || imager.grafana != nil
+}
+
+// MakeAlertImages makes the images of all alerts with the given provider,
+// unless an alert overrides it with the image_provider annotation, and
+// attaches the uploaded images to them. Query results and uploaded images are
+// shared through the cache between alerts and notifications.
+//
+// Images are generated concurrently, bounded by the plot concurrency. Once the
+// plot timeout or ctx expires, only the images ready so far are attached. All
+// failures are returned as a util.MultiError.
+func (d *Data) MakeAlertImages(ctx context.Context, logger log.Logger, imager *Imager, provider string) error {
+	type job struct {
+		alerts   []int
+		data     []Alert
+		provider string
+
+		expr PlotExpr
+		ds   *Datasource
+
+		queryTime time.Time
+		duration  time.Duration
+	}
+
+	conf := imager.conf
+	now := time.Now()
+	errs := &util.MultiError{}
+	var (
+		jobs    []*job
+		grouped = map[string]*job{}
+	)
+	for i := range d.Alerts {
+		alertProvider := provider
+		if p, ok := d.Alerts[i].Annotations[ImageProviderAnnotation]; ok {
+			alertProvider = p
+		}
+
+		// Grafana 已经为报警生成了图片时直接使用
+		if d.Alerts[i].ImageURL != "" && alertProvider != ImageProviderNone {
+			d.Alerts[i].Images = append(d.Alerts[i].Images, AlertImage{
+				Url:   d.Alerts[i].ImageURL,
+				Title: d.Alerts[i].Annotations["summary"],
+			})
+			continue
+		}
+
+		queryTime, duration := d.Alerts[i].getPlotTimeRange(conf.Plot, now)
+		if align := time.Duration(conf.Plot.TimeAlignment); align > 0 {
+			queryTime = queryTime.Truncate(align)
+		}
+
+		switch alertProvider {
+		case ImageProviderNone:
+			continue
+		case ImageProviderGrafana:
+			jobs = append(jobs, &job{alerts: []int{i}, data: []Alert{d.Alerts[i]}, provider: alertProvider, queryTime: queryTime, duration: duration})
+			continue
+		case "", ImageProviderPrometheus:
+		default:
+			errs.Add(fmt.Errorf("unknown image provider %q", alertProvider))
+			continue
+		}
+
+		ds := imager.datasources.Select(d.Alerts[i])
+		if ds == nil {
+			level.Debug(logger).Log("msg", "No datasource configured, skip alert image")
+			continue
+		}
+
+		generatorUrl, err := url.Parse(d.Alerts[i].GeneratorURL)
+		if err != nil {
+			errs.Add(err)
+			continue
+		}
+
+		generatorQuery, err := url.ParseQuery(generatorUrl.RawQuery)
+		if err != nil {
+			errs.Add(err)
+			continue
+		}
+
+		var alertFormula string
+		for key, param := range generatorQuery {
+			if key == "g0.expr" {
+				alertFormula = param[0]
+				break
+			}
+		}
+
+		plotExpression := GetPlotExpr(logger, alertFormula)
+		for _, expr := range plotExpression {
+			// 合并图表时，同一数据源和表达式的报警使用覆盖所有报警的时间范围画在一张图上
+			key := ds.Name + "\xff" + expr.String()
+			if j, ok := grouped[key]; ok && conf.Plot.GroupImages {
+				start := j.queryTime.Add(-j.duration)
+				if s := queryTime.Add(-duration); s.Before(start) {
+					start = s
+				}
+				if queryTime.After(j.queryTime) {
+					j.queryTime = queryTime
+				}
+				j.duration = clampDuration(j.queryTime.Sub(start), conf.Plot)
+				j.alerts = append(j.alerts, i)
+				j.data = append(j.data, d.Alerts[i])
+				continue
+			}
+
+			j := &job{alerts: []int{i}, data: []Alert{d.Alerts[i]}, provider: ImageProviderPrometheus, expr: expr, ds: ds, queryTime: queryTime, duration: duration}
+			grouped[key] = j
+			jobs = append(jobs, j)
+		}
+	}
+
+	if timeout := time.Duration(conf.Plot.Timeout); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	concurrency := conf.Plot.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		mtx     sync.Mutex
+		expired bool
+		images  = make([]*AlertImage, len(jobs))
+		sem     = make(chan struct{}, concurrency)
+		wg      sync.WaitGroup
+	)
+	for n, j := range jobs {
+		wg.Add(1)
+		go func(n int, j *job) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+
+			var (
+				image AlertImage
+				err   error
+			)
+			if j.provider == ImageProviderGrafana {
+				image, err = imager.grafanaImage(ctx, logger, j.queryTime, j.duration, j.data[0])
+			} else {
+				image, err = imager.plotImage(ctx, logger, j.ds, j.expr, j.queryTime, j.duration, j.data, now)
+			}
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			if expired {
+				return
+			}
+			if err != nil {
+				errs.Add(err)
+				return
+			}
+			images[n] = &image
+		}(n, j)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		level.Warn(logger).Log("msg", "Making alert images timed out, sending the images ready so far", "err", ctx.Err())
+		errs.Add(ctx.Err())
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	expired = true
+
+	for n, j := range jobs {
+		if images[n] == nil {
+			continue
+		}
+		if len(j.alerts) > 1 {
+			d.Images = append(d.Images, *images[n])
+			continue
+		}
+		d.Alerts[j.alerts[0]].Images = append(d.Alerts[j.alerts[0]].Images, *images[n])
+	}
+
+	if errs.Len() > 0 {
+		return errs
+	}
+	return nil
+}
+
+// plotImage plots the expression for the alerts and uploads the chart.
+func (imager *Imager) plotImage(ctx context.Context, logger log.Logger, ds *Datasource, expr PlotExpr, queryTime time.Time, duration time.Duration, alerts []Alert, now time.Time) (AlertImage, error) {
+	conf := imager.conf
+	queryKey := strings.Join([]string{
+		ds.Name,
+		expr.Formula,
+		strconv.FormatInt(queryTime.Unix(), 10),
+		duration.String(),
+	}, "\xff")
+
+	v, err := imager.cache.Do(ctx, "query\xff"+queryKey, func(ctx context.Context) (interface{}, error) {
+		level.Debug(logger).Log("msg", "Querying Prometheus", "datasource", ds.Name, "expr", expr.Formula)
+		return ds.Metrics(
+			ctx,
+			expr.Formula,
+			queryTime,
+			duration,
+			time.Duration(conf.Global.MetricResolution),
+		)
+	})
+	if err != nil {
+		return AlertImage{}, err
+	}
+
+	selectedMetrics, matched := selectMetrics(logger, v.(model.Matrix), alerts, conf.Plot.IgnoreLabels)
+
+	firing := make([]FiringInterval, 0, len(alerts))
+	intervalKeys := make([]string, 0, len(alerts))
+	for _, a := range alerts {
+		fi := a.firingInterval(now)
+		firing = append(firing, fi)
+		intervalKeys = append(intervalKeys, fi.String())
+	}
+
+	imageKey := strings.Join([]string{queryKey, expr.String(), seriesKey(selectedMetrics, matched), strings.Join(intervalKeys, ",")}, "\xff")
+	v, err = imager.cache.Do(ctx, "image\xff"+imageKey, func(context.Context) (interface{}, error) {
+		level.Debug(logger).Log("msg", "Creating plot", "summary", alerts[0].Annotations["summary"], "alerts", len(alerts))
+		plot, err := PlotMetric(selectedMetrics, expr.Level, expr.Operator, firing, conf.Plot)
+		if err != nil {
+			return nil, fmt.Errorf("Plot error: %v\n", err)
+		}
+
+		publicURL, err := imager.upload(conf.Plot.Format, plot)
+		if err != nil {
+			return nil, err
+		}
+
+		level.Debug(logger).Log("msg", "alert image uploaded", "url", publicURL)
+		return AlertImage{
+			Url:   publicURL,
+			Title: expr.String(),
+		}, nil
+	})
+	if err != nil {
+		return AlertImage{}, err
+	}
+	return v.(AlertImage), nil
+}
+
+// grafanaImage renders the Grafana panel referenced by the alert annotations
+// and uploads it.
+func (imager *Imager) grafanaImage(ctx context.Context, logger log.Logger, queryTime time.Time, duration time.Duration, alert Alert) (AlertImage, error) {
+	if imager.grafana == nil {
+		return AlertImage{}, fmt.Errorf("grafana image provider is not configured")
+	}
+
+	panel, err := imager.grafana.Panel(alert)
+	if err != nil {
+		return AlertImage{}, err
+	}
+	from := queryTime.Add(-duration)
+
+	v, err := imager.cache.Do(ctx, "grafana\xff"+panel.String()+"\xff"+strconv.FormatInt(queryTime.Unix(), 10)+"\xff"+duration.String(), func(ctx context.Context) (interface{}, error) {
+		level.Debug(logger).Log("msg", "Rendering Grafana panel", "panel", panel)
+		b, err := imager.grafana.Render(ctx, panel, from, queryTime)
+		if err != nil {
+			return nil, err
+		}
+
+		publicURL, err := imager.upload("png", bytes.NewBuffer(b))
+		if err != nil {
+			return nil, err
+		}
+
+		level.Debug(logger).Log("msg", "grafana panel image uploaded", "url", publicURL)
+		return AlertImage{
+			Url:   publicURL,
+			Title: alert.Annotations["summary"],
+		}, nil
+	})
+	if err != nil {
+		return AlertImage{}, err
+	}
+	return v.(AlertImage), nil
+}
+
+// DemoImage plots and uploads a chart of synthetic data, used by test
+// notifications.
+func (imager *Imager) DemoImage() (AlertImage, error) {
+	now := time.Now()
+	series := &model.SampleStream{Metric: model.Metric{"instance": "promoter-0:8080"}}
+	for i := 60; i >= 0; i-- {
+		series.Values = append(series.Values, model.SamplePair{
+			Timestamp: model.TimeFromUnixNano(now.Add(-time.Duration(i) * time.Minute).UnixNano()),
+			Value:     model.SampleValue(50 + 40*math.Sin(float64(i)/8)),
+		})
+	}
+
+	plot, err := PlotMetric(model.Matrix{series}, 80, ">", []FiringInterval{{Start: now.Add(-10 * time.Minute)}}, imager.conf.Plot)
+	if err != nil {
+		return AlertImage{}, fmt.Errorf("Plot error: %v\n", err)
+	}
+	publicURL, err := imager.upload(imager.conf.Plot.Format, plot)
+	if err != nil {
+		return AlertImage{}, err
+	}
+	return AlertImage{Url: publicURL, Title: "promoter demo > 80.00"}, nil
+}
+
+// upload stores the image in the configured object storage.
+func (imager *Imager) upload(format string, image io.WriterTo) (string, error) {
+	s3 := imager.conf.S3
+	if s3 == nil {
+		return "", fmt.Errorf("no s3 storage configured for alert images")
+	}
+	publicURL, err := util.UploadFile(
+		string(s3.AccessKey),
+		string(s3.SecretKey),
+		s3.Endpoint,
+		s3.Bucket,
+		s3.Region,
+		format,
+		image)
+	if err != nil {
+		return "", fmt.Errorf("S3 error: %v\n", err)
+	}
+	return publicURL, nil
+}
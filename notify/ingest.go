@@ -0,0 +1,375 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	tmpltext "text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/template"
+	"github.com/prometheus/common/model"
+)
+
+// ingestTimeLayouts are the layouts accepted for starts_at and ends_at,
+// besides Unix timestamps. The layouts without zone use the local time.
+var ingestTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006.01.02 15:04:05", // Zabbix {EVENT.DATE} {EVENT.TIME}
+}
+
+// Ingester converts arbitrary JSON payloads to alerts with the templates of
+// an ingest configuration.
+type Ingester struct {
+	conf *config.IngestConfig
+
+	labels       map[string]*tmpltext.Template
+	annotations  map[string]*tmpltext.Template
+	status       *tmpltext.Template
+	startsAt     *tmpltext.Template
+	endsAt       *tmpltext.Template
+	generatorURL *tmpltext.Template
+}
+
+// NewIngester parses the templates of the configuration.
+func NewIngester(conf *config.IngestConfig) (*Ingester, error) {
+	in := &Ingester{
+		conf:        conf,
+		labels:      map[string]*tmpltext.Template{},
+		annotations: map[string]*tmpltext.Template{},
+	}
+
+	var err error
+	for name, text := range conf.Labels {
+		if in.labels[name], err = parseIngestTemplate("labels."+name, text); err != nil {
+			return nil, err
+		}
+	}
+	for name, text := range conf.Annotations {
+		if in.annotations[name], err = parseIngestTemplate("annotations."+name, text); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range []struct {
+		name string
+		text string
+		tmpl **tmpltext.Template
+	}{
+		{"status", conf.Status, &in.status},
+		{"starts_at", conf.StartsAt, &in.startsAt},
+		{"ends_at", conf.EndsAt, &in.endsAt},
+		{"generator_url", conf.GeneratorURL, &in.generatorURL},
+	} {
+		if t.text == "" {
+			continue
+		}
+		if *t.tmpl, err = parseIngestTemplate(t.name, t.text); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// Functions the actions of ingest templates are rewritten with, so that
+// missing fields of the payload render as empty strings.
+const (
+	ingestLookupFunc      = "ingestLookup"
+	ingestRangeLookupFunc = "ingestRangeLookup"
+	ingestValueFunc       = "ingestValue"
+)
+
+func parseIngestTemplate(name, text string) (*tmpltext.Template, error) {
+	t, err := tmpltext.New(name).
+		Option("missingkey=zero").
+		Funcs(tmpltext.FuncMap(template.DefaultFuncs)).
+		Funcs(tmpltext.FuncMap{
+			ingestLookupFunc:      ingestLookup,
+			ingestRangeLookupFunc: ingestRangeLookup,
+			ingestValueFunc:       ingestValue,
+		}).
+		Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ingest template %s: %v", name, err)
+	}
+	for _, t := range t.Templates() {
+		if t.Tree != nil {
+			rewriteIngestNode(t.Tree, t.Tree.Root)
+		}
+	}
+	return t, nil
+}
+
+// ingestLookup returns the field at the keys of the JSON value, or an empty
+// string if it is missing or null. text/template fails on fields of missing
+// objects, and functions such as eq and toLower fail on nil.
+func ingestLookup(v interface{}, keys ...string) interface{} {
+	if v = ingestRangeLookup(v, keys...); v == nil {
+		return ""
+	}
+	return v
+}
+
+// ingestRangeLookup returns the field at the keys of the JSON value, or nil
+// if it is missing. It is used for range, which skips nil but fails on
+// strings.
+func ingestRangeLookup(v interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// ingestValue renders missing and null fields as empty strings, text/template
+// prints them as <no value>.
+func ingestValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// rewriteIngestNode looks up the fields of the actions of the node with
+// ingestLookup and pipes the printed values to ingestValue. Actions declaring
+// variables print nothing and are not piped.
+func rewriteIngestNode(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			rewriteIngestNode(tree, c)
+		}
+	case *parse.ActionNode:
+		rewriteIngestPipe(tree, n.Pipe, ingestLookupFunc)
+		if len(n.Pipe.Decl) == 0 {
+			n.Pipe.Cmds = append(n.Pipe.Cmds, ingestCommand(tree, n.Pos, ingestValueFunc))
+		}
+	case *parse.IfNode:
+		rewriteIngestBranch(tree, &n.BranchNode, ingestLookupFunc)
+	case *parse.RangeNode:
+		rewriteIngestBranch(tree, &n.BranchNode, ingestRangeLookupFunc)
+	case *parse.WithNode:
+		rewriteIngestBranch(tree, &n.BranchNode, ingestLookupFunc)
+	case *parse.TemplateNode:
+		rewriteIngestPipe(tree, n.Pipe, ingestLookupFunc)
+	}
+}
+
+func rewriteIngestBranch(tree *parse.Tree, n *parse.BranchNode, lookupFunc string) {
+	rewriteIngestPipe(tree, n.Pipe, lookupFunc)
+	rewriteIngestNode(tree, n.List)
+	rewriteIngestNode(tree, n.ElseList)
+}
+
+// rewriteIngestPipe replaces the fields of dot such as .a.b in the pipeline
+// with (lookupFunc . "a" "b").
+func rewriteIngestPipe(tree *parse.Tree, pipe *parse.PipeNode, lookupFunc string) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		for i, arg := range cmd.Args {
+			switch a := arg.(type) {
+			case *parse.FieldNode:
+				lookup := ingestCommand(tree, a.Pos, lookupFunc)
+				lookup.Args = append(lookup.Args, &parse.DotNode{NodeType: parse.NodeDot, Pos: a.Pos})
+				for _, key := range a.Ident {
+					lookup.Args = append(lookup.Args, &parse.StringNode{NodeType: parse.NodeString, Pos: a.Pos, Quoted: strconv.Quote(key), Text: key})
+				}
+				cmd.Args[i] = &parse.PipeNode{NodeType: parse.NodePipe, Pos: a.Pos, Line: pipe.Line, Cmds: []*parse.CommandNode{lookup}}
+			case *parse.PipeNode:
+				rewriteIngestPipe(tree, a, lookupFunc)
+			}
+		}
+	}
+}
+
+func ingestCommand(tree *parse.Tree, pos parse.Pos, fn string) *parse.CommandNode {
+	return &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Pos:      pos,
+		Args:     []parse.Node{parse.NewIdentifier(fn).SetTree(tree).SetPos(pos)},
+	}
+}
+
+// Decode converts the payload to a notification.
+func (in *Ingester) Decode(b []byte, now time.Time) (*Data, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var payload interface{}
+	if err := dec.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %v", err)
+	}
+
+	items := []interface{}{payload}
+	if in.conf.Alerts != "" {
+		v, err := lookupPath(payload, in.conf.Alerts)
+		if err != nil {
+			return nil, err
+		}
+		if list, ok := v.([]interface{}); ok {
+			items = list
+		} else {
+			items = []interface{}{v}
+		}
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no alerts at %q", in.conf.Alerts)
+	}
+
+	alerts := make(Alerts, 0, len(items))
+	for i, item := range items {
+		a, err := in.alert(item, now)
+		if err != nil {
+			return nil, fmt.Errorf("alert %d: %v", i, err)
+		}
+		alerts = append(alerts, a)
+	}
+	return groupAlerts(alerts), nil
+}
+
+// alert renders the templates with the item.
+func (in *Ingester) alert(item interface{}, now time.Time) (Alert, error) {
+	a := Alert{Labels: KV{}, Annotations: KV{}}
+	for name, t := range in.labels {
+		v, err := executeIngestTemplate(t, item)
+		if err != nil {
+			return a, err
+		}
+		// 和 Prometheus 一样，空值的标签等同于没有该标签
+		if v != "" {
+			a.Labels[name] = v
+		}
+	}
+	if len(a.Labels) == 0 {
+		return a, fmt.Errorf("no labels")
+	}
+	for name, t := range in.annotations {
+		v, err := executeIngestTemplate(t, item)
+		if err != nil {
+			return a, err
+		}
+		if v != "" {
+			a.Annotations[name] = v
+		}
+	}
+
+	var (
+		status string
+		err    error
+	)
+	if status, err = executeIngestTemplate(in.status, item); err != nil {
+		return a, err
+	}
+	if a.GeneratorURL, err = executeIngestTemplate(in.generatorURL, item); err != nil {
+		return a, err
+	}
+	if a.StartsAt, err = in.timestamp(in.startsAt, item); err != nil {
+		return a, err
+	}
+	if a.EndsAt, err = in.timestamp(in.endsAt, item); err != nil {
+		return a, err
+	}
+	if a.StartsAt.IsZero() {
+		a.StartsAt = now
+	}
+
+	switch strings.ToLower(status) {
+	case "":
+		// a.Status 还没有赋值，firing 根据 EndsAt 判断
+		if a.firing(now) {
+			a.Status = string(model.AlertFiring)
+		} else {
+			a.Status = string(model.AlertResolved)
+		}
+	case string(model.AlertFiring):
+		a.Status = string(model.AlertFiring)
+	case string(model.AlertResolved):
+		a.Status = string(model.AlertResolved)
+		if a.EndsAt.IsZero() {
+			a.EndsAt = now
+		}
+	default:
+		return a, fmt.Errorf("invalid status %q, must be firing or resolved", status)
+	}
+
+	a.Fingerprint = labelsFingerprint(a.Labels)
+	return a, nil
+}
+
+func (in *Ingester) timestamp(t *tmpltext.Template, item interface{}) (time.Time, error) {
+	s, err := executeIngestTemplate(t, item)
+	if err != nil || s == "" {
+		return time.Time{}, err
+	}
+	// 大于 1e12 的时间戳按毫秒处理
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if i > 1e12 {
+			return time.Unix(0, i*int64(time.Millisecond)), nil
+		}
+		return time.Unix(i, 0), nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if f > 1e12 {
+			f /= 1e3
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+	}
+	for _, layout := range ingestTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+}
+
+// executeIngestTemplate returns the trimmed output of the template.
+func executeIngestTemplate(t *tmpltext.Template, item interface{}) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, item); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// lookupPath returns the value at the dotted path of the JSON value, list
+// elements are selected by their index.
+func lookupPath(v interface{}, path string) (interface{}, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return v, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = x[key]; !ok {
+				return nil, fmt.Errorf("no field %q in %q", key, path)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(x) {
+				return nil, fmt.Errorf("invalid index %q in %q", key, path)
+			}
+			v = x[i]
+		default:
+			return nil, fmt.Errorf("cannot select %q in %q", key, path)
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,325 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+func newTestIngester(t *testing.T, conf string) *Ingester {
+	t.Helper()
+
+	var c config.IngestConfig
+	if err := yaml.UnmarshalStrict([]byte(conf), &c); err != nil {
+		t.Fatal(err)
+	}
+	in, err := NewIngester(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return in
+}
+
+const zabbixIngestConfig = `
+labels:
+  alertname: '{{ .trigger.name }}'
+  instance: '{{ .host }}'
+  severity: '{{ .trigger.severity | toLower }}'
+annotations:
+  summary: '{{ .trigger.name }} on {{ .host }}'
+status: '{{ if eq .status "PROBLEM" }}firing{{ else }}resolved{{ end }}'
+starts_at: '{{ .event_date }} {{ .event_time }}'
+`
+
+func TestIngesterZabbix(t *testing.T) {
+	in := newTestIngester(t, zabbixIngestConfig)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	startsAt := time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local)
+
+	data, err := in.Decode([]byte(`{"host": "db1", "status": "PROBLEM", "event_date": "2026.10.18", "event_time": "10:00:00", "trigger": {"name": "High load", "severity": "HIGH"}}`), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Status != string(model.AlertFiring) || len(data.Alerts) != 1 {
+		t.Fatalf("expected 1 firing alert, got %s with %d alerts", data.Status, len(data.Alerts))
+	}
+	a := data.Alerts[0]
+	if a.Labels["alertname"] != "High load" || a.Labels["instance"] != "db1" || a.Labels["severity"] != "high" {
+		t.Fatalf("unexpected labels %v", a.Labels)
+	}
+	if a.Annotations["summary"] != "High load on db1" {
+		t.Fatalf("unexpected annotations %v", a.Annotations)
+	}
+	if !a.StartsAt.Equal(startsAt) || !a.EndsAt.IsZero() {
+		t.Fatalf("expected the alert to start at %s, got %s - %s", startsAt, a.StartsAt, a.EndsAt)
+	}
+	if a.Fingerprint != labelsFingerprint(a.Labels) {
+		t.Fatalf("unexpected fingerprint %s", a.Fingerprint)
+	}
+	if data.GroupLabels["alertname"] != "High load" || data.CommonLabels["instance"] != "db1" {
+		t.Fatalf("unexpected group labels %v and common labels %v", data.GroupLabels, data.CommonLabels)
+	}
+
+	// 恢复时没有结束时间则为收到请求的时间，缺少的字段不生成标签
+	data, err = in.Decode([]byte(`{"host": "db1", "status": "OK", "event_date": "2026.10.18", "event_time": "10:00:00", "trigger": {"name": "High load"}}`), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = data.Alerts[0]
+	if data.Status != string(model.AlertResolved) || a.Status != string(model.AlertResolved) || !a.EndsAt.Equal(now) {
+		t.Fatalf("expected the alert to be resolved at %s, got %s at %s", now, a.Status, a.EndsAt)
+	}
+	if _, ok := a.Labels["severity"]; ok {
+		t.Fatalf("expected no severity label, got %v", a.Labels)
+	}
+}
+
+func TestIngesterSentry(t *testing.T) {
+	in := newTestIngester(t, `
+alerts: data.events
+labels:
+  alertname: SentryError
+  project: '{{ .project }}'
+annotations:
+  summary: '{{ .title }}'
+  culprit: '{{ .culprit }}'
+generator_url: '{{ .url }}'
+starts_at: '{{ .datetime }}'
+`)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	data, err := in.Decode([]byte(`{
+  "action": "triggered",
+  "data": {
+    "events": [
+      {"project": "web", "title": "TypeError: x is undefined", "culprit": null, "url": "https://sentry.example.com/issues/1/", "datetime": "2026-10-18T11:58:00.123Z"},
+      {"project": "api", "title": "ZeroDivisionError", "url": "https://sentry.example.com/issues/2/"}
+    ]
+  }
+}`), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Alerts) != 2 || data.Status != string(model.AlertFiring) {
+		t.Fatalf("expected 2 firing alerts, got %s with %d alerts", data.Status, len(data.Alerts))
+	}
+
+	web, api := data.Alerts[0], data.Alerts[1]
+	if web.Labels["project"] != "web" || web.GeneratorURL != "https://sentry.example.com/issues/1/" || web.Annotations["summary"] != "TypeError: x is undefined" {
+		t.Fatalf("unexpected alert %+v", web)
+	}
+	// null 字段渲染为空字符串，不生成注解
+	if _, ok := web.Annotations["culprit"]; ok {
+		t.Fatalf("expected no culprit annotation, got %v", web.Annotations)
+	}
+	if expected := time.Date(2026, 10, 18, 11, 58, 0, 123e6, time.UTC); !web.StartsAt.Equal(expected) {
+		t.Fatalf("expected the alert to start at %s, got %s", expected, web.StartsAt)
+	}
+	if api.Labels["project"] != "api" || !api.StartsAt.Equal(now) {
+		t.Fatalf("expected the alert of api to start now, got %+v", api)
+	}
+	if data.GroupLabels["alertname"] != "SentryError" || len(data.CommonLabels) != 1 {
+		t.Fatalf("unexpected group labels %v and common labels %v", data.GroupLabels, data.CommonLabels)
+	}
+}
+
+func TestIngesterMissingFields(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		template string
+		payload  string
+		expected string
+	}{
+		{name: "field", template: "{{ .a.b }}", payload: `{"a": {"b": "x"}}`, expected: "x"},
+		{name: "missing field", template: "x{{ .a.b }}", payload: `{}`, expected: "x"},
+		{name: "null field", template: "x{{ .a }}", payload: `{"a": null}`, expected: "x"},
+		{name: "missing field piped to a function", template: "x{{ .a.b | toUpper }}", payload: `{}`, expected: "x"},
+		{name: "missing field compared", template: `{{ if eq .a "b" }}y{{ else }}n{{ end }}`, payload: `{}`, expected: "n"},
+		{name: "missing field in with", template: "{{ with .a }}y{{ else }}n{{ end }}", payload: `{}`, expected: "n"},
+		{name: "range", template: "{{ range .a }}{{ .b }},{{ end }}", payload: `{"a": [{"b": 1}, {}]}`, expected: "1,,"},
+		{name: "missing field in range", template: "{{ range .a }}y{{ else }}n{{ end }}", payload: `{}`, expected: "n"},
+		{name: "number", template: "{{ .a }}", payload: `{"a": 12345678901234567890}`, expected: "12345678901234567890"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			in := newTestIngester(t, "labels: {alertname: Test}\nannotations:\n  value: '"+tc.template+"'")
+			data, err := in.Decode([]byte(tc.payload), time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v := data.Alerts[0].Annotations["value"]; v != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, v)
+			}
+		})
+	}
+}
+
+func TestIngesterTimestamps(t *testing.T) {
+	in := newTestIngester(t, `
+labels:
+  alertname: Test
+status: '{{ .status }}'
+starts_at: '{{ .starts }}'
+ends_at: '{{ .ends }}'
+`)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		payload  string
+		status   model.AlertStatus
+		startsAt time.Time
+		endsAt   time.Time
+	}{
+		{
+			name:     "unix seconds",
+			payload:  `{"starts": 1760774400}`,
+			status:   model.AlertFiring,
+			startsAt: time.Unix(1760774400, 0),
+		},
+		{
+			name:     "unix milliseconds",
+			payload:  `{"starts": 1760774400123}`,
+			status:   model.AlertFiring,
+			startsAt: time.Unix(1760774400, 123e6),
+		},
+		{
+			name:     "fractional seconds",
+			payload:  `{"starts": 1760774400.5}`,
+			status:   model.AlertFiring,
+			startsAt: time.Unix(1760774400, 5e8),
+		},
+		{
+			name:     "numeric string",
+			payload:  `{"starts": "1760774400"}`,
+			status:   model.AlertFiring,
+			startsAt: time.Unix(1760774400, 0),
+		},
+		{
+			name:     "RFC3339",
+			payload:  `{"starts": "2026-10-18T10:00:00+08:00"}`,
+			status:   model.AlertFiring,
+			startsAt: time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "local time",
+			payload:  `{"starts": "2026-10-18 10:00:00"}`,
+			status:   model.AlertFiring,
+			startsAt: time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local),
+		},
+		{
+			name:     "ended in the past without status",
+			payload:  `{"starts": 1760774400, "ends": 1760778000}`,
+			status:   model.AlertResolved,
+			startsAt: time.Unix(1760774400, 0),
+			endsAt:   time.Unix(1760778000, 0),
+		},
+		{
+			name:     "ends in the future without status",
+			payload:  `{"starts": 1760774400, "ends": "2026-10-18T13:00:00Z"}`,
+			status:   model.AlertFiring,
+			startsAt: time.Unix(1760774400, 0),
+			endsAt:   time.Date(2026, 10, 18, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "status is case insensitive",
+			payload:  `{"status": "Resolved"}`,
+			status:   model.AlertResolved,
+			startsAt: now,
+			endsAt:   now,
+		},
+		{
+			name:     "firing status overrides ends_at",
+			payload:  `{"status": "firing", "ends": 1760778000}`,
+			status:   model.AlertFiring,
+			startsAt: now,
+			endsAt:   time.Unix(1760778000, 0),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := in.Decode([]byte(tc.payload), now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := data.Alerts[0]
+			if a.Status != string(tc.status) {
+				t.Fatalf("expected status %s, got %s", tc.status, a.Status)
+			}
+			if !a.StartsAt.Equal(tc.startsAt) || !a.EndsAt.Equal(tc.endsAt) {
+				t.Fatalf("expected %s - %s, got %s - %s", tc.startsAt, tc.endsAt, a.StartsAt, a.EndsAt)
+			}
+		})
+	}
+}
+
+func TestIngesterErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		conf    string
+		payload string
+		err     string
+	}{
+		{
+			name:    "invalid JSON",
+			conf:    "labels: {alertname: Test}",
+			payload: `{"host":`,
+			err:     "invalid payload",
+		},
+		{
+			name:    "missing alerts field",
+			conf:    "alerts: data.events\nlabels: {alertname: Test}",
+			payload: `{"data": {}}`,
+			err:     `no field "events"`,
+		},
+		{
+			name:    "alerts index out of range",
+			conf:    "alerts: data.1\nlabels: {alertname: Test}",
+			payload: `{"data": [{}]}`,
+			err:     `invalid index "1"`,
+		},
+		{
+			name:    "empty alerts",
+			conf:    "alerts: events\nlabels: {alertname: Test}",
+			payload: `{"events": []}`,
+			err:     "no alerts",
+		},
+		{
+			name:    "all labels missing",
+			conf:    "labels: {alertname: '{{ .trigger.name }}'}",
+			payload: `{"host": "db1"}`,
+			err:     "alert 0: no labels",
+		},
+		{
+			name:    "invalid status",
+			conf:    "labels: {alertname: Test}\nstatus: '{{ .status }}'",
+			payload: `{"status": "PROBLEM"}`,
+			err:     `invalid status "PROBLEM"`,
+		},
+		{
+			name:    "invalid timestamp",
+			conf:    "labels: {alertname: Test}\nstarts_at: '{{ .clock }}'",
+			payload: `{"clock": "yesterday"}`,
+			err:     `cannot parse "yesterday"`,
+		},
+		{
+			name:    "error of the second alert",
+			conf:    "alerts: events\nlabels: {alertname: '{{ .name }}'}",
+			payload: `{"events": [{"name": "a"}, {}]}`,
+			err:     "alert 1: no labels",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			in := newTestIngester(t, tc.conf)
+			_, err := in.Decode([]byte(tc.payload), time.Now())
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
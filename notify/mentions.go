@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/oncall"
+)
+
+// Mention is a user mentioned in a notification.
+type Mention struct {
+	Name         string `json:"name"`
+	Mobile       string `json:"mobile,omitempty"`
+	WechatUserID string `json:"wechatUserID,omitempty"`
+	FeishuOpenID string `json:"feishuOpenID,omitempty"`
+}
+
+// Mentions is a list of mentioned users.
+type Mentions []Mention
+
+// Names returns the names of the users.
+func (ms Mentions) Names() []string {
+	return ms.collect(func(m Mention) string { return m.Name })
+}
+
+// Mobiles returns the phone numbers of the users who have one.
+func (ms Mentions) Mobiles() []string {
+	return ms.collect(func(m Mention) string { return m.Mobile })
+}
+
+// WechatUserIDs returns the WeCom user IDs of the users who have one.
+func (ms Mentions) WechatUserIDs() []string {
+	return ms.collect(func(m Mention) string { return m.WechatUserID })
+}
+
+// FeishuOpenIDs returns the Feishu open IDs of the users who have one.
+func (ms Mentions) FeishuOpenIDs() []string {
+	return ms.collect(func(m Mention) string { return m.FeishuOpenID })
+}
+
+func (ms Mentions) collect(f func(Mention) string) []string {
+	var res []string
+	for _, m := range ms {
+		if v := f(m); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// add appends the mentions not in ms yet.
+func (ms Mentions) add(others ...Mention) Mentions {
+	for _, o := range others {
+		found := false
+		for _, m := range ms {
+			if m.Name == o.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ms = append(ms, o)
+		}
+	}
+	return ms
+}
+
+// Directory resolves the users mentioned by alerts from the users, teams and
+// on-call schedules of the configuration.
+type Directory struct {
+	labels    []string
+	users     map[string]Mention
+	teams     map[string][]string
+	schedules map[string]*config.ScheduleConfig
+}
+
+// NewDirectory returns the Directory of the configuration.
+func NewDirectory(conf *config.Config) *Directory {
+	d := &Directory{
+		labels:    conf.Global.MentionLabels,
+		users:     map[string]Mention{},
+		teams:     map[string][]string{},
+		schedules: map[string]*config.ScheduleConfig{},
+	}
+	for _, u := range conf.Users {
+		d.users[u.Name] = Mention{
+			Name:         u.Name,
+			Mobile:       u.Mobile,
+			WechatUserID: u.WechatUserID,
+			FeishuOpenID: u.FeishuOpenID,
+		}
+	}
+	for _, t := range conf.Teams {
+		d.teams[t.Name] = t.Members
+	}
+	for _, s := range conf.Schedules {
+		d.schedules[s.Name] = s
+	}
+	return d
+}
+
+// Resolve returns the users mentioned by the mention labels or annotations of
+// the alert. Their values are comma separated names, see ResolveNames.
+func (d *Directory) Resolve(alert Alert) Mentions {
+	var names []string
+	for _, name := range d.labels {
+		for _, kv := range []KV{alert.Labels, alert.Annotations} {
+			if v, ok := kv[name]; ok {
+				names = append(names, strings.Split(v, ",")...)
+			}
+		}
+	}
+	return d.ResolveNames(names, time.Now())
+}
+
+// ResolveNames returns the users with the given names, the members of the
+// teams and the users on call at t of the schedules. A schedule name resolves
+// the user on call for its first rotation, schedule/rotation the one of the
+// given rotation. Unknown names are ignored.
+func (d *Directory) ResolveNames(names []string, t time.Time) Mentions {
+	var ms Mentions
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if u, ok := d.users[n]; ok {
+			ms = ms.add(u)
+		}
+		for _, member := range d.teams[n] {
+			ms = ms.add(d.users[member])
+		}
+
+		schedule, rotation := n, ""
+		if i := strings.Index(n, "/"); i >= 0 {
+			schedule, rotation = n[:i], n[i+1:]
+		}
+		s, ok := d.schedules[schedule]
+		if !ok {
+			continue
+		}
+		if rotation == "" {
+			rotation = s.Rotations[0].Name
+		}
+		for _, r := range s.Rotations {
+			if r.Name != rotation {
+				continue
+			}
+			if shift, ok := oncall.Current(s, r, t); ok {
+				ms = ms.add(d.users[shift.User])
+			}
+		}
+	}
+	return ms
+}
+
+// ResolveMentions sets the mentions of every alert. It does nothing if the
+// directory is nil.
+func (d *Data) ResolveMentions(dir *Directory) {
+	if dir == nil {
+		return
+	}
+	for i := range d.Alerts {
+		d.Alerts[i].Mentions = dir.Resolve(d.Alerts[i])
+	}
+}
+
+// Mentions returns the users mentioned by any of the alerts.
+func (d *Data) Mentions() Mentions {
+	var ms Mentions
+	for _, a := range d.Alerts {
+		ms = ms.add(a.Mentions...)
+	}
+	return ms
+}
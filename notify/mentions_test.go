@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cnych/promoter/config"
+)
+
+const mentionsTestConfig = `
+global:
+  dingtalk_api_url: http://dingtalk.example.com/robot/send
+  dingtalk_api_token: token
+  dingtalk_api_secret: secret
+users:
+  - name: alice
+    mobile: "13800000001"
+    wechat_user_id: alice.w
+  - name: bob
+    mobile: "13800000002"
+  - name: carol
+    feishu_open_id: ou_carol
+teams:
+  - name: payments
+    members: [alice, bob]
+schedules:
+  - name: payments-oncall
+    timezone: UTC
+    rotations:
+      - name: primary
+        type: daily
+        start: "2026-10-01"
+        members: [alice, bob]
+      - name: secondary
+        type: daily
+        start: "2026-10-01"
+        members: [carol, alice]
+receivers:
+  - name: ops
+    dingtalk_configs:
+      - message_type: markdown
+`
+
+func newTestDirectory(t *testing.T) *Directory {
+	t.Helper()
+
+	conf, err := config.Load(mentionsTestConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDirectory(conf)
+}
+
+func TestResolveNames(t *testing.T) {
+	d := newTestDirectory(t)
+	// 2026-10-18 09:00 UTC 之后 primary 是 bob，secondary 是 alice
+	at := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		names    []string
+		at       time.Time
+		expected []string
+	}{
+		{name: "user", names: []string{"alice"}, expected: []string{"alice"}},
+		{name: "team", names: []string{"payments"}, expected: []string{"alice", "bob"}},
+		{name: "deduplicated", names: []string{"bob", "payments", "bob"}, expected: []string{"bob", "alice"}},
+		{name: "spaces are trimmed", names: []string{" carol ", "alice"}, expected: []string{"carol", "alice"}},
+		{name: "unknown names are ignored", names: []string{"dave", "", "carol"}, expected: []string{"carol"}},
+		{name: "schedule", names: []string{"payments-oncall"}, expected: []string{"bob"}},
+		{name: "schedule before the handover", names: []string{"payments-oncall"}, at: time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC), expected: []string{"alice"}},
+		{name: "rotation", names: []string{"payments-oncall/secondary"}, expected: []string{"alice"}},
+		{name: "unknown rotation", names: []string{"payments-oncall/tertiary"}, expected: nil},
+		{name: "schedule not started", names: []string{"payments-oncall"}, at: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), expected: nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.at.IsZero() {
+				tc.at = at
+			}
+			got := d.ResolveNames(tc.names, tc.at).Names()
+			if strings.Join(got, ",") != strings.Join(tc.expected, ",") {
+				t.Fatalf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestResolveMentions(t *testing.T) {
+	d := newTestDirectory(t)
+	data := &Data{Alerts: Alerts{
+		// owner 和 team 默认用于 @ 人员，标签和注解都可以，多个名称用逗号分隔
+		{Labels: KV{"alertname": "HighLatency", "team": "payments"}},
+		{Labels: KV{"alertname": "DiskFull"}, Annotations: KV{"owner": "carol,alice"}},
+		{Labels: KV{"alertname": "Down", "severity": "alice"}},
+	}}
+	data.ResolveMentions(d)
+
+	for i, expected := range []string{"alice,bob", "carol,alice", ""} {
+		if got := strings.Join(data.Alerts[i].Mentions.Names(), ","); got != expected {
+			t.Errorf("alert %d: expected mentions %q, got %q", i, expected, got)
+		}
+	}
+
+	ms := data.Mentions()
+	if names := strings.Join(ms.Names(), ","); names != "alice,bob,carol" {
+		t.Fatalf("expected the mentions of all alerts, got %s", names)
+	}
+	if mobiles := strings.Join(ms.Mobiles(), ","); mobiles != "13800000001,13800000002" {
+		t.Fatalf("expected the mobiles of alice and bob, got %s", mobiles)
+	}
+	if ids := strings.Join(ms.WechatUserIDs(), ","); ids != "alice.w" {
+		t.Fatalf("expected the WeCom user ID of alice, got %s", ids)
+	}
+	if ids := strings.Join(ms.FeishuOpenIDs(), ","); ids != "ou_carol" {
+		t.Fatalf("expected the Feishu open ID of carol, got %s", ids)
+	}
+
+	// 没有通讯录时不修改报警
+	data = &Data{Alerts: Alerts{{Labels: KV{"team": "payments"}, Mentions: Mentions{{Name: "bob"}}}}}
+	data.ResolveMentions(nil)
+	if len(data.Alerts[0].Mentions) != 1 {
+		t.Fatalf("expected the mentions to be kept without a directory, got %+v", data.Alerts[0].Mentions)
+	}
+}
+
+func TestDirectoryMentionLabels(t *testing.T) {
+	conf, err := config.Load(strings.Replace(mentionsTestConfig, "global:\n", "global:\n  mention_labels: [oncall]\n", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDirectory(conf)
+
+	a := Alert{Labels: KV{"team": "payments", "oncall": "carol"}}
+	if names := d.Resolve(a).Names(); len(names) != 1 || names[0] != "carol" {
+		t.Fatalf("expected only the configured mention labels to be used, got %v", names)
+	}
+}
@@ -3,15 +3,11 @@ package notify
 import (
 	"context"
 	"fmt"
-	"net/url"
 	"sort"
 	"time"
 
 	"github.com/cnych/promoter/config"
 	"github.com/cnych/promoter/template"
-	"github.com/cnych/promoter/util"
-	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
 	"github.com/prometheus/common/model"
 )
 
@@ -19,6 +15,65 @@ type Notifier interface {
 	Notify(ctx context.Context, alerts *Data) (bool, error)
 }
 
+// Muter decides whether the alerts of a receiver must not be notified, e.g.
+// because they are silenced.
+type Muter interface {
+	Mutes(receiver string, a Alert, now time.Time) bool
+}
+
+// Renderer is implemented by notifiers that can render the fields of their
+// message without sending it.
+type Renderer interface {
+	Render(data *Data) (map[string]string, error)
+}
+
+// Integration wraps a notifier of a receiver with its type and its index in
+// the receiver configuration.
+type Integration struct {
+	Notifier
+
+	Name  string
+	Index int
+
+	conf config.NotifierConfig
+}
+
+// NewIntegration returns an Integration of the notifier, filtering the alerts
+// it is sent according to conf.
+func NewIntegration(notifier Notifier, conf config.NotifierConfig, name string, idx int) Integration {
+	return Integration{
+		Notifier: notifier,
+		Name:     name,
+		Index:    idx,
+		conf:     conf,
+	}
+}
+
+func (i Integration) String() string {
+	return fmt.Sprintf("%s[%d]", i.Name, i.Index)
+}
+
+// Filter returns a copy of the data holding only the alerts the integration
+// sends, or nil if there is none left: resolved alerts are dropped unless
+// send_resolved is set, and alerts must match all the matchers.
+func (i Integration) Filter(data *Data) *Data {
+	return data.Filter(func(a Alert) bool {
+		if a.Status == string(model.AlertResolved) && !i.conf.SendResolved() {
+			return false
+		}
+		return i.matches(a)
+	})
+}
+
+func (i Integration) matches(a Alert) bool {
+	for name, re := range i.conf.Matchers {
+		if !re.MatchString(a.Labels[name]) {
+			return false
+		}
+	}
+	return true
+}
+
 // Pair is a key/value string pair.
 type Pair struct {
 	Name, Value string
@@ -111,67 +166,43 @@ type Data struct {
 	CommonAnnotations KV `json:"commonAnnotations"`
 
 	ExternalURL string `json:"externalURL"`
-}
-
-func (d *Data) MakeAlertImages(logger log.Logger, config *config.Config) error {
-	for i := range d.Alerts {
-		generatorUrl, err := url.Parse(d.Alerts[i].GeneratorURL)
-		if err != nil {
-			return err
-		}
 
-		generatorQuery, err := url.ParseQuery(generatorUrl.RawQuery)
-		if err != nil {
-			return err
-		}
-
-		var alertFormula string
-		for key, param := range generatorQuery {
-			if key == "g0.expr" {
-				alertFormula = param[0]
-				break
-			}
-		}
-
-		plotExpression := GetPlotExpr(logger, alertFormula)
-		queryTime, duration := d.Alerts[i].getPlotTimeRange()
-
-		for _, expr := range plotExpression {
-			plot, err := Plot(
-				logger,
-				expr,
-				queryTime,
-				duration,
-				time.Duration(config.Global.MetricResolution),
-				config.Global.PrometheusURL.String(),
-				d.Alerts[i],
-			)
-			if err != nil {
-				return fmt.Errorf("Plot error: %v\n", err)
-			}
-
-			publicURL, err := util.UploadFile(
-				string(config.S3.AccessKey),
-				string(config.S3.SecretKey),
-				config.S3.Endpoint,
-				config.S3.Bucket,
-				config.S3.Region,
-				plot)
-			if err != nil {
-				return fmt.Errorf("S3 error: %v\n", err)
-			}
-
-			level.Debug(logger).Log("msg", "alert image uploaded", "url", publicURL)
-			d.Alerts[i].Images = append(d.Alerts[i].Images, AlertImage{
-				Url:   publicURL,
-				Title: expr.String(),
-			})
+	// Images are the charts combined for several alerts of the group.
+	Images []AlertImage `json:"images,omitempty"`
+	// Escalation is set when the notification escalates a firing alert.
+	Escalation *Escalation `json:"escalation,omitempty"`
+	// Actions are the links to acknowledge or silence the alerts, see
+	// ActionLinker.
+	Actions *ActionLinks `json:"actions,omitempty"`
+	// AtMobiles are the mobiles a DingTalk notification @-mentions: those of
+	// the at config and those resolved from the alerts. DingTalk only
+	// highlights the mentions written in the text of markdown messages.
+	AtMobiles []string `json:"atMobiles,omitempty"`
+}
 
+// Filter returns the notification with the alerts kept by the function, or
+// nil if none is kept. The status is recomputed from the kept alerts.
+func (d *Data) Filter(keep func(Alert) bool) *Data {
+	var alerts Alerts
+	for _, a := range d.Alerts {
+		if keep(a) {
+			alerts = append(alerts, a)
 		}
-
+	}
+	if len(alerts) == 0 {
+		return nil
+	}
+	if len(alerts) == len(d.Alerts) {
+		return d
 	}
 
-	return nil
+	filtered := *d
+	filtered.Alerts = alerts
+	filtered.Status = string(model.AlertResolved)
+	if len(alerts.Firing()) > 0 {
+		filtered.Status = string(model.AlertFiring)
+	}
+	return &filtered
 }
 
 // Alert holds one alert for notification templates.
@@ -184,22 +215,69 @@ type Alert struct {
 	GeneratorURL string    `json:"generatorURL"`
 	Fingerprint  string    `json:"fingerprint"`
 	Images       []AlertImage
+	// Mentions are the users mentioned by the alert, see Data.ResolveMentions.
+	Mentions Mentions `json:"mentions,omitempty"`
+	// Ack is set once the firing alert has been acknowledged.
+	Ack *Ack `json:"ack,omitempty"`
+
+	// Fields sent by Grafana unified alerting, see PayloadFormatGrafana.
+	Values       map[string]float64 `json:"values,omitempty"`
+	ValueString  string             `json:"valueString,omitempty"`
+	DashboardURL string             `json:"dashboardURL,omitempty"`
+	PanelURL     string             `json:"panelURL,omitempty"`
+	SilenceURL   string             `json:"silenceURL,omitempty"`
+	// ImageURL is the image Grafana made for the alert, it is used instead of
+	// making one.
+	ImageURL string `json:"imageURL,omitempty"`
+}
+
+// LabelsFingerprint returns the fingerprint of the labels of the alert, it is
+// the same as the fingerprint computed by Alertmanager.
+func (a Alert) LabelsFingerprint() string {
+	return labelsFingerprint(a.Labels)
 }
 
-func (a Alert) getPlotTimeRange() (time.Time, time.Duration) {
-	var queryTime time.Time
-	var duration time.Duration
-	if a.StartsAt.Second() > a.EndsAt.Second() {
-		queryTime = a.StartsAt
-		duration = time.Minute * 20
-	} else {
-		queryTime = a.EndsAt
-		duration = queryTime.Sub(a.StartsAt)
-		if duration < time.Minute*20 {
-			duration = time.Minute * 20
+// firing reports whether the alert is still firing at the given time.
+func (a Alert) firing(now time.Time) bool {
+	if a.Status != "" {
+		return a.Status == string(model.AlertFiring)
+	}
+	return a.EndsAt.IsZero() || a.EndsAt.After(now)
+}
+
+// getPlotTimeRange returns the end and the duration of the plotted window.
+// The window starts lookback before the alert started and ends now for
+// firing alerts, or resolved_padding after the alert ended for resolved ones.
+// Its duration is bounded by min_range and max_range.
+func (a Alert) getPlotTimeRange(conf *config.PlotConfig, now time.Time) (time.Time, time.Duration) {
+	queryTime := now
+	if !a.firing(now) {
+		queryTime = a.EndsAt.Add(time.Duration(conf.ResolvedPadding))
+		if queryTime.After(now) {
+			queryTime = now
 		}
 	}
-	return queryTime, duration
+
+	duration := queryTime.Sub(a.StartsAt.Add(-time.Duration(conf.Lookback)))
+	return queryTime, clampDuration(duration, conf)
+}
+
+// firingInterval returns the time span the alert was firing.
+func (a Alert) firingInterval(now time.Time) FiringInterval {
+	if a.firing(now) {
+		return FiringInterval{Start: a.StartsAt}
+	}
+	return FiringInterval{Start: a.StartsAt, End: a.EndsAt}
+}
+
+func clampDuration(d time.Duration, conf *config.PlotConfig) time.Duration {
+	if min := time.Duration(conf.MinRange); d < min {
+		d = min
+	}
+	if max := time.Duration(conf.MaxRange); max > 0 && d > max {
+		d = max
+	}
+	return d
 }
 
 // Alerts is a list of Alert objects.
@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+func TestGetPlotTimeRange(t *testing.T) {
+	conf := config.DefaultPlotConfig
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		conf     func(c *config.PlotConfig)
+		alert    Alert
+		end      time.Time
+		duration time.Duration
+	}{
+		{
+			name:     "firing",
+			alert:    Alert{Status: string(model.AlertFiring), StartsAt: now.Add(-time.Hour)},
+			end:      now,
+			duration: time.Hour + 15*time.Minute,
+		},
+		{
+			// Alertmanager 发送的 firing 报警的 EndsAt 是将来的时间
+			name:     "firing with endsAt in the future",
+			alert:    Alert{StartsAt: now.Add(-time.Hour), EndsAt: now.Add(4 * time.Minute)},
+			end:      now,
+			duration: time.Hour + 15*time.Minute,
+		},
+		{
+			name:     "resolved",
+			alert:    Alert{Status: string(model.AlertResolved), StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)},
+			end:      now.Add(-55 * time.Minute),
+			duration: time.Hour + 20*time.Minute,
+		},
+		{
+			name:     "resolved padding capped at now",
+			alert:    Alert{Status: string(model.AlertResolved), StartsAt: now.Add(-time.Hour), EndsAt: now.Add(-2 * time.Minute)},
+			end:      now,
+			duration: time.Hour + 15*time.Minute,
+		},
+		{
+			name:     "resolved without status",
+			alert:    Alert{StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)},
+			end:      now.Add(-55 * time.Minute),
+			duration: time.Hour + 20*time.Minute,
+		},
+		{
+			name:     "short alert extended to min_range",
+			alert:    Alert{Status: string(model.AlertFiring), StartsAt: now.Add(-time.Minute)},
+			end:      now,
+			duration: 20 * time.Minute,
+		},
+		{
+			name:     "long alert bounded by max_range",
+			alert:    Alert{Status: string(model.AlertFiring), StartsAt: now.Add(-48 * time.Hour)},
+			end:      now,
+			duration: 6 * time.Hour,
+		},
+		{
+			name:     "no max_range",
+			conf:     func(c *config.PlotConfig) { c.MaxRange = 0 },
+			alert:    Alert{Status: string(model.AlertFiring), StartsAt: now.Add(-48 * time.Hour)},
+			end:      now,
+			duration: 48*time.Hour + 15*time.Minute,
+		},
+		{
+			name: "no lookback and padding",
+			conf: func(c *config.PlotConfig) {
+				c.Lookback, c.ResolvedPadding, c.MinRange = 0, 0, 0
+			},
+			alert:    Alert{Status: string(model.AlertResolved), StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)},
+			end:      now.Add(-time.Hour),
+			duration: time.Hour,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := conf
+			if tc.conf != nil {
+				tc.conf(&c)
+			}
+			end, duration := tc.alert.getPlotTimeRange(&c, now)
+			if !end.Equal(tc.end) || duration != tc.duration {
+				t.Fatalf("expected the window to end at %s after %s, got %s after %s", tc.end, tc.duration, end, duration)
+			}
+		})
+	}
+}
+
+func TestFiringInterval(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	startsAt, endsAt := now.Add(-time.Hour), now.Add(-time.Minute)
+
+	firing := Alert{Status: string(model.AlertFiring), StartsAt: startsAt, EndsAt: now.Add(time.Minute)}
+	if fi := firing.firingInterval(now); !fi.Start.Equal(startsAt) || !fi.End.IsZero() || fi.String() != "1792321200-" {
+		t.Fatalf("expected an open interval, got %+v (%s)", fi, fi)
+	}
+	resolved := Alert{Status: string(model.AlertResolved), StartsAt: startsAt, EndsAt: endsAt}
+	if fi := resolved.firingInterval(now); !fi.Start.Equal(startsAt) || !fi.End.Equal(endsAt) || fi.String() != "1792321200-1792324740" {
+		t.Fatalf("expected a closed interval, got %+v (%s)", fi, fi)
+	}
+}
+
+func TestIntegrationFilter(t *testing.T) {
+	web1 := Alert{Status: string(model.AlertFiring), Labels: KV{"alertname": "HighLatency", "instance": "web1", "team": "web", "severity": "critical"}}
+	web2 := Alert{Status: string(model.AlertResolved), Labels: KV{"alertname": "HighLatency", "instance": "web2", "team": "web", "severity": "warning"}}
+	db1 := Alert{Status: string(model.AlertFiring), Labels: KV{"alertname": "DiskFull", "instance": "db1", "severity": "critical"}}
+	data := &Data{Status: string(model.AlertFiring), Alerts: Alerts{web1, web2, db1}}
+
+	for _, tc := range []struct {
+		name      string
+		conf      string
+		instances []string
+		status    model.AlertStatus
+	}{
+		{
+			name:      "all alerts",
+			conf:      "send_resolved: true",
+			instances: []string{"web1", "web2", "db1"},
+			status:    model.AlertFiring,
+		},
+		{
+			name:      "resolved alerts dropped",
+			conf:      "send_resolved: false",
+			instances: []string{"web1", "db1"},
+			status:    model.AlertFiring,
+		},
+		{
+			name:      "matchers",
+			conf:      "send_resolved: true\nmatchers: {team: web}",
+			instances: []string{"web1", "web2"},
+			status:    model.AlertFiring,
+		},
+		{
+			name:      "all matchers must match",
+			conf:      "send_resolved: true\nmatchers: {team: web, severity: warning}",
+			instances: []string{"web2"},
+			status:    model.AlertResolved,
+		},
+		{
+			// 标签不存在时按空字符串匹配
+			name:      "missing label",
+			conf:      "send_resolved: true\nmatchers: {team: ''}",
+			instances: []string{"db1"},
+			status:    model.AlertFiring,
+		},
+		{
+			// 正则表达式需要匹配整个值
+			name:      "anchored regexp",
+			conf:      "send_resolved: true\nmatchers: {severity: crit, instance: 'web.*|db1'}",
+			instances: nil,
+		},
+		{
+			name:      "resolved alerts dropped before matching",
+			conf:      "send_resolved: false\nmatchers: {severity: warning}",
+			instances: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var conf config.NotifierConfig
+			if err := yaml.UnmarshalStrict([]byte(tc.conf), &conf); err != nil {
+				t.Fatal(err)
+			}
+			i := NewIntegration(nil, conf, "dingtalk", 0)
+
+			filtered := i.Filter(data)
+			if tc.instances == nil {
+				if filtered != nil {
+					t.Fatalf("expected no alerts, got %+v", filtered.Alerts)
+				}
+				return
+			}
+			var instances []string
+			for _, a := range filtered.Alerts {
+				instances = append(instances, a.Labels["instance"])
+			}
+			if strings.Join(instances, ",") != strings.Join(tc.instances, ",") {
+				t.Fatalf("expected alerts %v, got %v", tc.instances, instances)
+			}
+			if filtered.Status != string(tc.status) {
+				t.Fatalf("expected status %s, got %s", tc.status, filtered.Status)
+			}
+		})
+	}
+
+	// 过滤不修改原来的通知
+	if len(data.Alerts) != 3 || data.Status != string(model.AlertFiring) {
+		t.Fatalf("expected the notification to be unchanged, got %+v", data)
+	}
+	var conf config.NotifierConfig
+	conf.VSendResolved = true
+	if filtered := NewIntegration(nil, conf, "dingtalk", 0).Filter(data); filtered != data {
+		t.Fatal("expected the notification itself when no alert is dropped")
+	}
+}
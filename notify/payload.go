@@ -0,0 +1,219 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// Payload formats accepted by the receivers.
+const (
+	// PayloadFormatAuto detects the format from the payload.
+	PayloadFormatAuto = "auto"
+	// PayloadFormatAlertmanager is the Alertmanager webhook (version 4).
+	PayloadFormatAlertmanager = "alertmanager"
+	// PayloadFormatAlertmanagerV2 is a list of alerts as posted to the
+	// Alertmanager API v2 (/api/v2/alerts).
+	PayloadFormatAlertmanagerV2 = "alertmanager_v2"
+	// PayloadFormatGrafana is the webhook of Grafana unified alerting.
+	PayloadFormatGrafana = "grafana"
+)
+
+// Annotations Grafana sets on alerts of rules linked to a dashboard panel.
+const (
+	grafanaDashboardUIDAnnotation = "__dashboardUid__"
+	grafanaPanelIDAnnotation      = "__panelId__"
+)
+
+// grafanaAlertFields are only sent by Grafana.
+var grafanaAlertFields = []string{"values", "valueString", "dashboardURL", "panelURL", "silenceURL", "imageURL"}
+
+// DecodePayload decodes the payload of a notification in the given format.
+// The format is detected from the payload when it is empty or auto. It
+// returns the decoded data and the format that was used.
+func DecodePayload(b []byte, format string) (*Data, string, error) {
+	if format == "" || format == PayloadFormatAuto {
+		var err error
+		if format, err = detectPayloadFormat(b); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var (
+		data *Data
+		err  error
+	)
+	switch format {
+	case PayloadFormatAlertmanager:
+		data, err = decodeAlertmanager(b)
+	case PayloadFormatAlertmanagerV2:
+		data, err = decodeAlertmanagerV2(b, time.Now())
+	case PayloadFormatGrafana:
+		data, err = decodeGrafana(b)
+	default:
+		return nil, "", fmt.Errorf("unknown payload format %q", format)
+	}
+	if err != nil {
+		return nil, format, fmt.Errorf("invalid %s payload: %v", format, err)
+	}
+	return data, format, nil
+}
+
+// detectPayloadFormat returns alertmanager_v2 for a list of alerts, grafana
+// for a webhook with an orgId or Grafana specific alert fields, and
+// alertmanager otherwise.
+func detectPayloadFormat(b []byte) (string, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		return PayloadFormatAlertmanagerV2, nil
+	}
+
+	var probe struct {
+		OrgID  *json.RawMessage             `json:"orgId"`
+		Alerts []map[string]json.RawMessage `json:"alerts"`
+	}
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return "", fmt.Errorf("invalid payload: %v", err)
+	}
+	if probe.OrgID != nil {
+		return PayloadFormatGrafana, nil
+	}
+	for _, a := range probe.Alerts {
+		for _, f := range grafanaAlertFields {
+			if _, ok := a[f]; ok {
+				return PayloadFormatGrafana, nil
+			}
+		}
+	}
+	return PayloadFormatAlertmanager, nil
+}
+
+func decodeAlertmanager(b []byte) (*Data, error) {
+	var data Data
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// decodeGrafana decodes the Grafana webhook, which extends the Alertmanager
+// one. The dashboard and panel of the rule are copied to the annotations used
+// by the grafana image provider unless they are already set.
+func decodeGrafana(b []byte) (*Data, error) {
+	data, err := decodeAlertmanager(b)
+	if err != nil {
+		return nil, err
+	}
+	for i := range data.Alerts {
+		a := &data.Alerts[i]
+		uid, ok := a.Annotations[grafanaDashboardUIDAnnotation]
+		if !ok || a.Annotations[GrafanaDashboardUIDAnnotation] != "" {
+			continue
+		}
+		a.Annotations[GrafanaDashboardUIDAnnotation] = uid
+		if id, ok := a.Annotations[grafanaPanelIDAnnotation]; ok {
+			a.Annotations[GrafanaPanelIDAnnotation] = id
+		}
+	}
+	return data, nil
+}
+
+// postableAlert is an alert of the Alertmanager API v2. Alerts listed by
+// GET /api/v2/alerts also carry their fingerprint.
+type postableAlert struct {
+	Labels       KV        `json:"labels"`
+	Annotations  KV        `json:"annotations"`
+	StartsAt     time.Time `json:"startsAt"`
+	EndsAt       time.Time `json:"endsAt"`
+	GeneratorURL string    `json:"generatorURL"`
+	Fingerprint  string    `json:"fingerprint"`
+}
+
+// decodeAlertmanagerV2 groups a list of API v2 alerts into a single
+// notification. An alert is resolved once its endsAt has passed, the group
+// is firing while any alert fires.
+func decodeAlertmanagerV2(b []byte, now time.Time) (*Data, error) {
+	var pas []postableAlert
+	if err := json.Unmarshal(b, &pas); err != nil {
+		return nil, err
+	}
+	if len(pas) == 0 {
+		return nil, fmt.Errorf("no alerts")
+	}
+
+	alerts := make(Alerts, 0, len(pas))
+	for i, pa := range pas {
+		if len(pa.Labels) == 0 {
+			return nil, fmt.Errorf("alert %d has no labels", i)
+		}
+		a := Alert{
+			Labels:       pa.Labels,
+			Annotations:  pa.Annotations,
+			StartsAt:     pa.StartsAt,
+			EndsAt:       pa.EndsAt,
+			GeneratorURL: pa.GeneratorURL,
+			Fingerprint:  pa.Fingerprint,
+		}
+		if a.Annotations == nil {
+			a.Annotations = KV{}
+		}
+		if a.StartsAt.IsZero() {
+			a.StartsAt = now
+		}
+		if a.Fingerprint == "" {
+			a.Fingerprint = labelsFingerprint(a.Labels)
+		}
+
+		// firing 只在 Status 为空时根据 endsAt 判断
+		if a.firing(now) {
+			a.Status = string(model.AlertFiring)
+		} else {
+			a.Status = string(model.AlertResolved)
+		}
+		alerts = append(alerts, a)
+	}
+	return groupAlerts(alerts), nil
+}
+
+// groupAlerts returns a notification of the alerts, it is firing while any
+// alert fires. The alert name is the only group label if it is shared.
+func groupAlerts(alerts Alerts) *Data {
+	data := &Data{
+		Status:      string(model.AlertResolved),
+		Alerts:      alerts,
+		GroupLabels: KV{},
+	}
+	if len(data.Alerts.Firing()) > 0 {
+		data.Status = string(model.AlertFiring)
+	}
+
+	data.CommonLabels = commonKV(data.Alerts, func(a Alert) KV { return a.Labels })
+	data.CommonAnnotations = commonKV(data.Alerts, func(a Alert) KV { return a.Annotations })
+	if name, ok := data.CommonLabels[model.AlertNameLabel]; ok {
+		data.GroupLabels[model.AlertNameLabel] = name
+	}
+	return data
+}
+
+// commonKV returns the pairs shared by all alerts.
+func commonKV(alerts Alerts, kv func(Alert) KV) KV {
+	common := KV{}
+	if len(alerts) == 0 {
+		return common
+	}
+	for k, v := range kv(alerts[0]) {
+		common[k] = v
+	}
+	for _, a := range alerts[1:] {
+		m := kv(a)
+		for k, v := range common {
+			if m[k] != v {
+				delete(common, k)
+			}
+		}
+	}
+	return common
+}
@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const alertmanagerPayload = `{
+  "version": "4",
+  "groupKey": "{}:{alertname=\"HighLatency\"}",
+  "status": "firing",
+  "receiver": "ops",
+  "groupLabels": {"alertname": "HighLatency"},
+  "commonLabels": {"alertname": "HighLatency"},
+  "externalURL": "http://alertmanager:9093",
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {"alertname": "HighLatency", "instance": "web1"},
+      "annotations": {"summary": "latency is high"},
+      "startsAt": "2026-10-18T08:00:00Z",
+      "generatorURL": "http://prometheus:9090/graph",
+      "fingerprint": "a1"
+    }
+  ]
+}`
+
+const grafanaPayload = `{
+  "receiver": "ops",
+  "status": "firing",
+  "orgId": 1,
+  "groupLabels": {"alertname": "HighLatency"},
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {"alertname": "HighLatency"},
+      "annotations": {"__dashboardUid__": "abc", "__panelId__": "2"},
+      "startsAt": "2026-10-18T08:00:00Z",
+      "valueString": "[ var='A' value=1.5 ]"
+    }
+  ]
+}`
+
+func TestDecodePayloadDetect(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		payload string
+		format  string
+	}{
+		{name: "alertmanager", payload: alertmanagerPayload, format: PayloadFormatAlertmanager},
+		{name: "grafana", payload: grafanaPayload, format: PayloadFormatGrafana},
+		{
+			// 旧版本的 Grafana 没有 orgId，通过告警中特有的字段识别
+			name:    "grafana without orgId",
+			payload: `{"status":"firing","alerts":[{"status":"firing","labels":{"alertname":"Down"},"dashboardURL":"http://grafana/d/abc"}]}`,
+			format:  PayloadFormatGrafana,
+		},
+		{
+			name:    "alertmanager v2",
+			payload: "\n  " + `[{"labels":{"alertname":"Down"}}]`,
+			format:  PayloadFormatAlertmanagerV2,
+		},
+		{name: "empty object", payload: `{}`, format: PayloadFormatAlertmanager},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, format := range []string{"", PayloadFormatAuto} {
+				data, detected, err := DecodePayload([]byte(tc.payload), format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if detected != tc.format {
+					t.Fatalf("expected format %s, got %s", tc.format, detected)
+				}
+				if data == nil {
+					t.Fatal("expected the decoded data")
+				}
+			}
+		})
+	}
+}
+
+func TestDecodePayloadFormats(t *testing.T) {
+	data, _, err := DecodePayload([]byte(alertmanagerPayload), PayloadFormatAlertmanager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Receiver != "ops" || data.Status != string(model.AlertFiring) || len(data.Alerts) != 1 || data.Alerts[0].Fingerprint != "a1" {
+		t.Fatalf("unexpected data %+v", data)
+	}
+
+	// Grafana 的面板注解被复制到 grafana 图片使用的注解
+	data, _, err = DecodePayload([]byte(grafanaPayload), PayloadFormatGrafana)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := data.Alerts[0].Annotations; a[GrafanaDashboardUIDAnnotation] != "abc" || a[GrafanaPanelIDAnnotation] != "2" {
+		t.Fatalf("expected the dashboard and panel annotations, got %v", a)
+	}
+
+	// 已经设置的注解不会被覆盖
+	data, _, err = DecodePayload([]byte(`{"orgId":1,"alerts":[{"labels":{"alertname":"Down"},"annotations":{"__dashboardUid__":"abc","__panelId__":"2","grafana_dashboard_uid":"own","grafana_panel_id":"5"}}]}`), PayloadFormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := data.Alerts[0].Annotations; a[GrafanaDashboardUIDAnnotation] != "own" || a[GrafanaPanelIDAnnotation] != "5" {
+		t.Fatalf("expected the annotations to be kept, got %v", a)
+	}
+
+	// 显式指定格式时不再检测
+	if _, _, err := DecodePayload([]byte(alertmanagerPayload), PayloadFormatAlertmanagerV2); err == nil {
+		t.Fatal("expected an error decoding an object as a list of alerts")
+	}
+}
+
+func TestDecodeAlertmanagerV2(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	data, err := decodeAlertmanagerV2([]byte(`[
+  {"labels": {"alertname": "Down", "instance": "web1", "team": "web"}, "annotations": {"summary": "down"}, "startsAt": "2026-10-18T08:00:00Z"},
+  {"labels": {"alertname": "Down", "instance": "web2", "team": "web"}, "startsAt": "2026-10-18T08:00:00Z", "endsAt": "2026-10-18T08:30:00Z", "fingerprint": "f2"},
+  {"labels": {"alertname": "Down", "instance": "web3", "team": "web"}, "endsAt": "2026-10-18T10:00:00Z"}
+]`), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data.Alerts) != 3 {
+		t.Fatalf("expected 3 alerts, got %d", len(data.Alerts))
+	}
+	web1, web2, web3 := data.Alerts[0], data.Alerts[1], data.Alerts[2]
+	if web1.Status != string(model.AlertFiring) || web1.Fingerprint != labelsFingerprint(web1.Labels) {
+		t.Fatalf("unexpected alert %+v", web1)
+	}
+	// endsAt 已经过去的告警已恢复
+	if web2.Status != string(model.AlertResolved) || web2.Fingerprint != "f2" || web2.Annotations == nil {
+		t.Fatalf("unexpected alert %+v", web2)
+	}
+	// endsAt 在未来的告警仍在触发，没有 startsAt 时使用当前时间
+	if web3.Status != string(model.AlertFiring) || !web3.StartsAt.Equal(now) {
+		t.Fatalf("unexpected alert %+v", web3)
+	}
+
+	if data.Status != string(model.AlertFiring) {
+		t.Fatalf("expected the group to be firing, got %s", data.Status)
+	}
+	if len(data.GroupLabels) != 1 || data.GroupLabels["alertname"] != "Down" {
+		t.Fatalf("expected the alert name as the only group label, got %v", data.GroupLabels)
+	}
+	if len(data.CommonLabels) != 2 || data.CommonLabels["team"] != "web" {
+		t.Fatalf("unexpected common labels %v", data.CommonLabels)
+	}
+	if len(data.CommonAnnotations) != 0 {
+		t.Fatalf("expected no common annotations, got %v", data.CommonAnnotations)
+	}
+
+	// 所有告警都恢复时通知也是恢复状态
+	data, err = decodeAlertmanagerV2([]byte(`[{"labels":{"alertname":"Down"},"endsAt":"2026-10-18T08:30:00Z"},{"labels":{"alertname":"Up"},"endsAt":"2026-10-18T08:30:00Z"}]`), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Status != string(model.AlertResolved) || len(data.GroupLabels) != 0 {
+		t.Fatalf("expected a resolved notification without group labels, got %+v", data)
+	}
+}
+
+func TestDecodePayloadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		payload string
+		format  string
+		err     string
+	}{
+		{name: "invalid json", payload: `{"alerts":`, err: "invalid payload"},
+		{name: "not an object", payload: `"firing"`, err: "invalid payload"},
+		{name: "empty", payload: ``, err: "invalid payload"},
+		{name: "unknown format", payload: alertmanagerPayload, format: "zabbix", err: `unknown payload format "zabbix"`},
+		{name: "no alerts", payload: `[]`, err: "invalid alertmanager_v2 payload: no alerts"},
+		{name: "alert without labels", payload: `[{"labels":{"alertname":"Down"}},{"annotations":{"summary":"down"}}]`, err: "alert 1 has no labels"},
+		{name: "invalid alert", payload: `[{"labels":{"alertname":"Down"},"startsAt":"yesterday"}]`, err: "invalid alertmanager_v2 payload"},
+		{name: "invalid grafana alerts", payload: `{"orgId":1,"alerts":[{"labels":"Down"}]}`, format: PayloadFormatGrafana, err: "invalid grafana payload"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := DecodePayload([]byte(tc.payload), tc.format)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected an error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -1,18 +1,19 @@
 package notify
 
 import (
-	"context"
 	"fmt"
 	"image/color"
 	"io"
-	"regexp"
+	"io/ioutil"
+	"math"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/cnych/promoter/config"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	prometheus "github.com/prometheus/client_golang/api"
-	prometheusApi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/golang/freetype/truetype"
 	promModel "github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/promql"
 	"gonum.org/v1/plot"
@@ -20,6 +21,8 @@ import (
 	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/vg"
 	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+	"gonum.org/v1/plot/vg/vgsvg"
 )
 
 type AlertImage struct {
@@ -37,8 +40,18 @@ func (expr PlotExpr) String() string {
 	return fmt.Sprintf("%s %s %.2f", expr.Formula, expr.Operator, expr.Level)
 }
 
-// Only show important part of metric name
-var labelText = regexp.MustCompile("{(.*)}")
+// FiringInterval is the time span an alert was firing. A zero End means the
+// alert is still firing.
+type FiringInterval struct {
+	Start, End time.Time
+}
+
+func (fi FiringInterval) String() string {
+	if fi.End.IsZero() {
+		return fmt.Sprintf("%d-", fi.Start.Unix())
+	}
+	return fmt.Sprintf("%d-%d", fi.Start.Unix(), fi.End.Unix())
+}
 
 func GetPlotExpr(logger log.Logger, alertFormula string) []PlotExpr {
 	expr, _ := promql.ParseExpr(alertFormula)
@@ -75,108 +88,197 @@ func GetPlotExpr(logger log.Logger, alertFormula string) []PlotExpr {
 	}
 }
 
-func Plot(logger log.Logger, expr PlotExpr, queryTime time.Time, duration, resolution time.Duration, prometheusUrl string, alert Alert) (io.WriterTo, error) {
-	level.Debug(logger).Log("msg", "Querying Prometheus", "expr", expr.Formula)
-	metrics, err := Metrics(
-		prometheusUrl,
-		expr.Formula,
-		queryTime,
-		duration,
-		resolution,
-	)
-	if err != nil {
-		return nil, err
+// plotTheme holds the colors of a plot theme.
+type plotTheme struct {
+	background     color.Color
+	foreground     color.Color
+	grid           color.Color
+	threshold      color.Color
+	evalText       color.Color
+	evalBackground color.Color
+	firing         color.Color
+	marker         color.Color
+}
+
+var plotThemes = map[string]plotTheme{
+	"light": {
+		background:     color.White,
+		foreground:     color.Black,
+		grid:           color.Gray{Y: 128},
+		threshold:      color.NRGBA{R: 255, A: 40},
+		evalText:       color.NRGBA{A: 150},
+		evalBackground: color.NRGBA{R: 255, G: 255, B: 255, A: 90},
+		firing:         color.NRGBA{R: 255, G: 140, A: 30},
+		marker:         color.NRGBA{R: 200, A: 200},
+	},
+	"dark": {
+		background:     color.NRGBA{R: 0x18, G: 0x1b, B: 0x1f, A: 255},
+		foreground:     color.NRGBA{R: 0xd8, G: 0xd9, B: 0xda, A: 255},
+		grid:           color.NRGBA{R: 0x46, G: 0x4a, B: 0x50, A: 255},
+		threshold:      color.NRGBA{R: 255, G: 80, B: 80, A: 50},
+		evalText:       color.NRGBA{R: 255, G: 255, B: 255, A: 180},
+		evalBackground: color.NRGBA{A: 90},
+		firing:         color.NRGBA{R: 255, G: 160, A: 35},
+		marker:         color.NRGBA{R: 255, G: 90, B: 90, A: 220},
+	},
+}
+
+var (
+	fontMtx sync.Mutex
+	// fontFiles records the TTF files already registered with vg.AddFont.
+	fontFiles = map[string]struct{}{}
+)
+
+// plotFont returns the font name to use for the texts of the plot. Custom
+// font files are only supported for png images since svg relies on the
+// fonts of the viewer.
+func plotFont(conf *config.PlotConfig) (string, error) {
+	if conf.FontFile == "" || conf.Format == "svg" {
+		return "Helvetica", nil
 	}
 
-	var selectedMetrics promModel.Matrix
-	var founded bool
-	for _, metric := range metrics {
-		founded = false
-		for label, value := range metric.Metric {
-			if originValue, ok := alert.Labels[string(label)]; ok {
-				if originValue == string(value) {
-					founded = true
-				} else {
-					founded = false
-					break
-				}
-			}
-		}
+	fontMtx.Lock()
+	defer fontMtx.Unlock()
 
-		if founded {
-			level.Debug(logger).Log("msg", "Best match founded", "metric", metric.Metric)
-			selectedMetrics = promModel.Matrix{metric}
-			break
+	if _, ok := fontFiles[conf.FontFile]; !ok {
+		b, err := ioutil.ReadFile(conf.FontFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read font file: %v", err)
 		}
+		f, err := truetype.Parse(b)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse font file: %v", err)
+		}
+		vg.AddFont(conf.FontFile, f)
+		fontFiles[conf.FontFile] = struct{}{}
 	}
+	return conf.FontFile, nil
+}
 
-	if !founded {
-		level.Debug(logger).Log("msg", "Best match not founded, use entire dataset. Labels to search", "labels", alert.Labels.Values())
-		selectedMetrics = metrics
+// parseHexColor parses a #RRGGBB or #RRGGBBAA color.
+func parseHexColor(s string) (color.Color, error) {
+	var c color.NRGBA
+	c.A = 255
+	var err error
+	switch len(s) {
+	case 7:
+		_, err = fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	case 9:
+		_, err = fmt.Sscanf(s, "#%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A)
+	default:
+		err = fmt.Errorf("invalid color %q", s)
 	}
+	return c, err
+}
 
-	level.Debug(logger).Log("msg", "Creating plot", "summary", alert.Annotations["summary"])
-
-	plottedMetric, err := PlotMetric(selectedMetrics, expr.Level, expr.Operator)
-	if err != nil {
-		return nil, err
+// newPlotCanvas returns the canvas for the configured image format.
+func newPlotCanvas(conf *config.PlotConfig, background color.Color) vg.CanvasWriterTo {
+	width := vg.Length(conf.Width) * vg.Centimeter
+	height := vg.Length(conf.Height) * vg.Centimeter
+	if conf.Format == "svg" {
+		return vgsvg.New(width, height)
 	}
-
-	return plottedMetric, nil
+	return vgimg.PngCanvas{Canvas: vgimg.NewWith(
+		vgimg.UseWH(width, height),
+		vgimg.UseDPI(conf.DPI),
+		vgimg.UseBackgroundColor(background),
+	)}
 }
 
-func PlotMetric(metrics promModel.Matrix, level float64, direction string) (io.WriterTo, error) {
+// PlotMetric draws the series with the threshold area, the firing intervals
+// and a marker at the start of each alert.
+func PlotMetric(metrics promModel.Matrix, level float64, direction string, firing []FiringInterval, conf *config.PlotConfig) (io.WriterTo, error) {
+	theme := plotThemes[conf.Theme]
+	if conf.ThresholdColor != "" {
+		c, err := parseHexColor(conf.ThresholdColor)
+		if err != nil {
+			return nil, err
+		}
+		theme.threshold = c
+	}
+
 	p, err := plot.New()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new plot: %v", err)
 	}
 
-	textFont, err := vg.MakeFont("Helvetica", 3*vg.Millimeter)
+	fontName, err := plotFont(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	textFont, err := vg.MakeFont(fontName, 3*vg.Millimeter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load font: %v", err)
 	}
 
-	evalTextFont, err := vg.MakeFont("Helvetica", 5*vg.Millimeter)
+	evalTextFont, err := vg.MakeFont(fontName, 5*vg.Millimeter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load font: %v", err)
 	}
 
 	evalTextStyle := draw.TextStyle{
-		Color:  color.NRGBA{A: 150},
+		Color:  theme.evalText,
 		Font:   evalTextFont,
 		XAlign: draw.XRight,
 		YAlign: draw.YBottom,
 	}
 
+	p.BackgroundColor = theme.background
 	p.X.Tick.Marker = plot.TimeTicks{
-		Time:   plot.UnixTimeIn(time.Local), // use local time
-		Format: "15:04:05",
+		Time:   plot.UnixTimeIn(conf.Location()),
+		Format: conf.TimeFormat,
+	}
+	for _, axis := range []*plot.Axis{&p.X, &p.Y} {
+		axis.Color = theme.foreground
+		axis.Tick.Color = theme.foreground
+		axis.Tick.Label.Color = theme.foreground
+		axis.Tick.Label.Font = textFont
 	}
-	p.X.Tick.Label.Font = textFont
-	p.Y.Tick.Label.Font = textFont
 	p.Legend.Font = textFont
-	p.Legend.Top = true
-	p.Legend.YOffs = 15 * vg.Millimeter
+	p.Legend.Color = theme.foreground
+	switch conf.LegendPosition {
+	case "top-right", "top-left":
+		p.Legend.Top = true
+		p.Legend.YOffs = 15 * vg.Millimeter
+	}
+	p.Legend.Left = conf.LegendPosition == "top-left" || conf.LegendPosition == "bottom-left"
 
 	// Color palette for drawing lines
-	paletteSize := 8
-	palette, err := brewer.GetPalette(brewer.TypeAny, "Dark2", paletteSize)
+	paletteSize := config.PlotPaletteSize
+	palette, err := brewer.GetPalette(brewer.TypeAny, conf.Palette, paletteSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get color palette: %v", err)
 	}
 	colors := palette.Colors()
 
+	metrics, others := limitSeries(metrics, conf, direction)
+	names := legendNames(metrics)
+	if others != nil {
+		metrics = append(metrics, others)
+		names = append(names, "others")
+	}
+
 	var lastEvalValue float64
 
 	for s, sample := range metrics {
+		lineColor := colors[s%paletteSize]
+		if sample == others {
+			lineColor = theme.grid
+		}
+
+		var legendLine *plotter.Line
 		data := make(plotter.XYs, 0)
 		for _, v := range sample.Values {
 			fs := v.Value.String()
 			if fs == "NaN" {
-				_, err := drawLine(data, colors, s, paletteSize, p, metrics, sample)
+				l, err := drawLine(data, lineColor, p)
 				if err != nil {
 					return nil, err
 				}
+				if legendLine == nil {
+					legendLine = l
+				}
 
 				data = make(plotter.XYs, 0)
 				continue
@@ -187,13 +289,21 @@ func PlotMetric(metrics promModel.Matrix, level float64, direction string) (io.W
 				return nil, fmt.Errorf("sample value not float: %s", v.Value.String())
 			}
 			data = append(data, plotter.XY{X: float64(v.Timestamp.Unix()), Y: f})
-			lastEvalValue = f
+			if sample != others {
+				lastEvalValue = f
+			}
 		}
 
-		_, err := drawLine(data, colors, s, paletteSize, p, metrics, sample)
+		l, err := drawLine(data, lineColor, p)
 		if err != nil {
 			return nil, err
 		}
+		if legendLine == nil {
+			legendLine = l
+		}
+		if legendLine != nil && conf.LegendPosition != "none" && len(metrics) > 1 {
+			p.Legend.Add(names[s], legendLine)
+		}
 	}
 
 	var polygonPoints plotter.XYs
@@ -208,19 +318,21 @@ func PlotMetric(metrics promModel.Matrix, level float64, direction string) (io.W
 	if err != nil {
 		return nil, err
 	}
-	poly.Color = color.NRGBA{R: 255, A: 40}
+	poly.Color = theme.threshold
 	poly.LineStyle.Color = color.NRGBA{R: 0, A: 0}
 	p.Add(poly)
-	p.Add(plotter.NewGrid())
+
+	if err := drawFiring(p, firing, theme); err != nil {
+		return nil, err
+	}
+	grid := plotter.NewGrid()
+	grid.Vertical.Color = theme.grid
+	grid.Horizontal.Color = theme.grid
+	p.Add(grid)
 
 	// Draw plot in canvas with margin
 	margin := 6 * vg.Millimeter
-	width := 20 * vg.Centimeter
-	height := 10 * vg.Centimeter
-	c, err := draw.NewFormattedCanvas(width, height, "png")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create canvas: %v", err)
-	}
+	c := newPlotCanvas(conf, theme.background)
 
 	cropedCanvas := draw.Crop(draw.New(c), margin, -margin, margin, -margin)
 	p.Draw(cropedCanvas)
@@ -239,56 +351,64 @@ func PlotMetric(metrics promModel.Matrix, level float64, direction string) (io.W
 		{X: trX(p.X.Max) + evalRectangle.Max.X - 6*vg.Millimeter, Y: trY(lastEvalValue) + evalRectangle.Max.Y + vg.Millimeter},
 		{X: trX(p.X.Max) + evalRectangle.Max.X - 6*vg.Millimeter, Y: trY(lastEvalValue) + evalRectangle.Min.Y - vg.Millimeter},
 	}
-	plotterCanvas.FillPolygon(color.NRGBA{R: 255, G: 255, B: 255, A: 90}, points)
+	plotterCanvas.FillPolygon(theme.evalBackground, points)
 	plotterCanvas.FillText(evalTextStyle, vg.Point{X: trX(p.X.Max) - 6*vg.Millimeter, Y: trY(lastEvalValue)}, evalText)
 
 	return c, nil
 }
 
-func drawLine(data plotter.XYs, colors []color.Color, s int, paletteSize int, p *plot.Plot, metrics promModel.Matrix, sample *promModel.SampleStream) (*plotter.Line, error) {
-	var l *plotter.Line
-	var err error
-	if len(data) > 0 {
-		l, err = plotter.NewLine(data)
-		if err != nil {
-			return &plotter.Line{}, fmt.Errorf("failed to create line: %v", err)
+// drawFiring shades the firing intervals and marks the alert start times,
+// clipped to the plotted time range.
+func drawFiring(p *plot.Plot, firing []FiringInterval, theme plotTheme) error {
+	xMin, xMax, yMin, yMax := p.X.Min, p.X.Max, p.Y.Min, p.Y.Max
+	for _, fi := range firing {
+		start := math.Max(float64(fi.Start.Unix()), xMin)
+		end := xMax
+		if !fi.End.IsZero() {
+			end = math.Min(float64(fi.End.Unix()), xMax)
+		}
+		if start >= end {
+			continue
 		}
 
-		l.LineStyle.Width = vg.Points(1)
-		l.LineStyle.Color = colors[s%paletteSize]
+		area, err := plotter.NewPolygon(plotter.XYs{{X: start, Y: yMin}, {X: end, Y: yMin}, {X: end, Y: yMax}, {X: start, Y: yMax}})
+		if err != nil {
+			return err
+		}
+		area.Color = theme.firing
+		area.LineStyle.Color = color.NRGBA{}
+		p.Add(area)
 
-		p.Add(l)
-		if len(metrics) > 1 {
-			m := labelText.FindStringSubmatch(sample.Metric.String())
-			if m != nil {
-				p.Legend.Add(m[1], l)
-			}
+		if float64(fi.Start.Unix()) < xMin {
+			continue
 		}
+		marker, err := plotter.NewLine(plotter.XYs{{X: start, Y: yMin}, {X: start, Y: yMax}})
+		if err != nil {
+			return err
+		}
+		marker.LineStyle.Width = vg.Points(1)
+		marker.LineStyle.Color = theme.marker
+		marker.LineStyle.Dashes = []vg.Length{vg.Points(4), vg.Points(2)}
+		p.Add(marker)
 	}
-
-	return l, nil
+	return nil
 }
 
-func Metrics(server, query string, queryTime time.Time, duration, step time.Duration) (promModel.Matrix, error) {
-	client, err := prometheus.NewClient(prometheus.Config{Address: server})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Prometheus client: %v", err)
+// drawLine adds a line for the data to the plot. It returns nil if there
+// is no data.
+func drawLine(data plotter.XYs, lineColor color.Color, p *plot.Plot) (*plotter.Line, error) {
+	if len(data) == 0 {
+		return nil, nil
 	}
 
-	api := prometheusApi.NewAPI(client)
-	value, _, err := api.QueryRange(context.Background(), query, prometheusApi.Range{
-		Start: queryTime.Add(-duration),
-		End:   queryTime,
-		Step:  duration / step,
-	})
+	l, err := plotter.NewLine(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query Prometheus: %v", err)
+		return nil, fmt.Errorf("failed to create line: %v", err)
 	}
 
-	metrics, ok := value.(promModel.Matrix)
-	if !ok {
-		return nil, fmt.Errorf("unsupported result format: %s", value.Type().String())
-	}
+	l.LineStyle.Width = vg.Points(1)
+	l.LineStyle.Color = lineColor
 
-	return metrics, nil
+	p.Add(l)
+	return l, nil
 }
@@ -0,0 +1,54 @@
+package receivers
+
+import (
+	"fmt"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/notify"
+	"github.com/cnych/promoter/notify/dingtalk"
+	"github.com/cnych/promoter/notify/wechat"
+	"github.com/cnych/promoter/template"
+	"github.com/cnych/promoter/util"
+	"github.com/go-kit/log"
+)
+
+// IntegrationError is the error of a notifier which cannot be built.
+type IntegrationError struct {
+	// Integration is the name of the integration, e.g. dingtalk[0].
+	Integration string
+	Err         error
+}
+
+func (e *IntegrationError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Integration, e.Err)
+}
+
+// BuildIntegrations builds the notifiers of the receiver. Notifiers which
+// cannot be built are skipped and their errors returned as a util.MultiError
+// of IntegrationError together with the other integrations.
+func BuildIntegrations(rcv *config.Receiver, tmpl *template.Template, logger log.Logger) ([]notify.Integration, error) {
+	var (
+		integrations []notify.Integration
+		errs         = &util.MultiError{}
+		add          = func(name string, i int, conf config.NotifierConfig, f func(l log.Logger) (notify.Notifier, error)) {
+			n, err := f(log.With(logger, "integration", name, "index", i))
+			if err != nil {
+				errs.Add(&IntegrationError{Integration: fmt.Sprintf("%s[%d]", name, i), Err: err})
+				return
+			}
+			integrations = append(integrations, notify.NewIntegration(n, conf, name, i))
+		}
+	)
+
+	for i, c := range rcv.DingtalkConfigs {
+		add("dingtalk", i, c.NotifierConfig, func(l log.Logger) (notify.Notifier, error) { return dingtalk.New(c, tmpl, l) })
+	}
+	for i, c := range rcv.WechatConfigs {
+		add("wechat", i, c.NotifierConfig, func(l log.Logger) (notify.Notifier, error) { return wechat.New(c, tmpl, l) })
+	}
+
+	if errs.Len() > 0 {
+		return integrations, errs
+	}
+	return integrations, nil
+}
@@ -0,0 +1,104 @@
+package receivers
+
+import (
+	"fmt"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/notify"
+	"github.com/cnych/promoter/template"
+	"github.com/cnych/promoter/util"
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/model"
+)
+
+// RenderRequest selects what is rendered: either a template string, or the
+// notifiers of a receiver. Integration restricts the notifiers to a single
+// one, e.g. dingtalk[0]. Sample data is used when Data is nil.
+type RenderRequest struct {
+	Template    string       `json:"template,omitempty"`
+	Receiver    string       `json:"receiver,omitempty"`
+	Integration string       `json:"integration,omitempty"`
+	Data        *notify.Data `json:"data,omitempty"`
+}
+
+// RenderResult is the rendered template string, or the fields of the message
+// an integration would send. Template errors are reported in Error.
+type RenderResult struct {
+	Integration string            `json:"integration,omitempty"`
+	Output      string            `json:"output,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// Render renders the request without sending any notification. An error is
+// only returned for invalid requests, template errors and notifiers which
+// cannot be built are part of the results.
+// Mentions of the data are resolved with the directory of the configuration.
+func Render(conf *config.Config, tmpl *template.Template, logger log.Logger, req RenderRequest) ([]RenderResult, error) {
+	if (req.Template == "") == (req.Receiver == "") {
+		return nil, fmt.Errorf("exactly one of template and receiver must be set")
+	}
+
+	data := req.Data
+	if data == nil {
+		data = notify.SampleData(req.Receiver, string(model.AlertFiring), nil)
+	}
+	data.ResolveMentions(notify.NewDirectory(conf))
+
+	if req.Template != "" {
+		out, err := tmpl.ExecuteTextString(req.Template, data)
+		if err != nil {
+			return []RenderResult{{Error: err.Error()}}, nil
+		}
+		return []RenderResult{{Output: out}}, nil
+	}
+
+	var rcv *config.Receiver
+	for _, r := range conf.Receivers {
+		if r.Name == req.Receiver {
+			rcv = r
+			break
+		}
+	}
+	if rcv == nil {
+		return nil, fmt.Errorf("receiver %q not found", req.Receiver)
+	}
+
+	// 无法创建的通知配置作为单独的结果返回，不影响其他通知配置
+	integrations, buildErr := BuildIntegrations(rcv, tmpl, logger)
+
+	var results []RenderResult
+	for _, i := range integrations {
+		if req.Integration != "" && i.String() != req.Integration {
+			continue
+		}
+		res := RenderResult{Integration: i.String()}
+		r, ok := i.Notifier.(notify.Renderer)
+		if !ok {
+			res.Error = "notifier does not support rendering"
+			results = append(results, res)
+			continue
+		}
+		var err error
+		if res.Fields, err = r.Render(data); err != nil {
+			res.Error = err.Error()
+		}
+		results = append(results, res)
+	}
+	if errs, ok := buildErr.(*util.MultiError); ok {
+		for _, err := range errs.Errors() {
+			res := RenderResult{Error: err.Error()}
+			if ierr, ok := err.(*IntegrationError); ok {
+				res.Integration, res.Error = ierr.Integration, ierr.Err.Error()
+			}
+			if req.Integration != "" && res.Integration != req.Integration {
+				continue
+			}
+			results = append(results, res)
+		}
+	}
+	if req.Integration != "" && len(results) == 0 {
+		return nil, fmt.Errorf("integration %q not found in receiver %q", req.Integration, req.Receiver)
+	}
+	return results, nil
+}
@@ -0,0 +1,79 @@
+package receivers
+
+import (
+	"context"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/notify"
+	"github.com/cnych/promoter/template"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+)
+
+// TestOptions configures a test notification.
+type TestOptions struct {
+	// Status of the test notification: firing, resolved or empty for both.
+	Status string `json:"status,omitempty"`
+	// Labels are added to every test alert.
+	Labels notify.KV `json:"labels,omitempty"`
+	// Plot attaches a demo chart to the first test alert.
+	Plot bool `json:"plot,omitempty"`
+}
+
+// TestResult is the outcome of a test notification sent by an integration.
+type TestResult struct {
+	Status      string `json:"status"`
+	Integration string `json:"integration"`
+	// Skipped reports that the filters of the notifier dropped all alerts.
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Test sends synthetic notifications through every notifier of the receiver
+// and reports the result of each of them. Mentions are resolved with the
+// directory. The imager is only used for the demo plot and may be nil
+// otherwise. Notifiers which cannot be built are
+// skipped and their errors returned together with the results of the others.
+func Test(ctx context.Context, logger log.Logger, rcv *config.Receiver, tmpl *template.Template, directory *notify.Directory, imager *notify.Imager, opts TestOptions) ([]TestResult, error) {
+	integrations, buildErr := BuildIntegrations(rcv, tmpl, logger)
+
+	statuses := []string{string(model.AlertFiring), string(model.AlertResolved)}
+	if opts.Status != "" {
+		statuses = []string{opts.Status}
+	}
+
+	var image *notify.AlertImage
+	if opts.Plot && imager != nil {
+		img, err := imager.DemoImage()
+		if err != nil {
+			level.Warn(logger).Log("msg", "Cannot make demo image", "err", err)
+		} else {
+			image = &img
+		}
+	}
+
+	var results []TestResult
+	for _, status := range statuses {
+		data := notify.SampleData(rcv.Name, status, opts.Labels)
+		data.ResolveMentions(directory)
+		if image != nil {
+			data.Alerts[0].Images = append(data.Alerts[0].Images, *image)
+		}
+
+		for _, i := range integrations {
+			res := TestResult{Status: status, Integration: i.String()}
+			filtered := i.Filter(data)
+			if filtered == nil {
+				res.Skipped = true
+				results = append(results, res)
+				continue
+			}
+			if _, err := i.Notify(ctx, filtered); err != nil {
+				res.Error = err.Error()
+			}
+			results = append(results, res)
+		}
+	}
+	return results, buildErr
+}
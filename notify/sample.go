@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// SampleData returns a synthetic notification for the receiver, used to check
+// templates and to test notifiers. Status is either firing or resolved, the
+// given labels are added to every alert.
+func SampleData(receiver, status string, labels KV) *Data {
+	now := time.Now()
+	generatorURL := "http://prometheus.example.com/graph?g0.expr=" + url.QueryEscape(`up{job="promoter"} < 1`)
+
+	var alerts Alerts
+	for _, instance := range []string{"promoter-0:8080", "promoter-1:8080"} {
+		alert := Alert{
+			Status: status,
+			Labels: KV{
+				"alertname": "PromoterTestAlert",
+				"severity":  "warning",
+				"job":       "promoter",
+				"instance":  instance,
+			},
+			Annotations: KV{
+				"summary":     "Promoter test alert for " + instance,
+				"description": "This is a test notification sent by Promoter.",
+			},
+			StartsAt:     now.Add(-10 * time.Minute),
+			GeneratorURL: generatorURL,
+			Fingerprint:  model.LabelSet{"instance": model.LabelValue(instance)}.Fingerprint().String(),
+		}
+		if status == string(model.AlertResolved) {
+			alert.EndsAt = now
+		}
+		for k, v := range labels {
+			alert.Labels[k] = v
+		}
+		alerts = append(alerts, alert)
+	}
+
+	commonLabels := alerts[0].Labels.Remove([]string{"instance"})
+	return &Data{
+		Receiver:          receiver,
+		Status:            status,
+		Alerts:            alerts,
+		GroupLabels:       KV{"alertname": "PromoterTestAlert"},
+		CommonLabels:      commonLabels,
+		CommonAnnotations: KV{"description": "This is a test notification sent by Promoter."},
+		ExternalURL:       "http://alertmanager.example.com",
+	}
+}
@@ -0,0 +1,208 @@
+package notify
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/cnych/promoter/config"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	promModel "github.com/prometheus/common/model"
+)
+
+// seriesSelector returns the alert labels used to find the alert's series.
+func seriesSelector(alert Alert, ignore []string) KV {
+	return alert.Labels.Remove(ignore)
+}
+
+// matchSeries reports whether the series agrees with every selector label it
+// carries, and shares at least one of them.
+func matchSeries(metric promModel.Metric, selector KV) bool {
+	shared := 0
+	for name, value := range metric {
+		if v, ok := selector[string(name)]; ok {
+			if v != string(value) {
+				return false
+			}
+			shared++
+		}
+	}
+	return shared > 0
+}
+
+// selectMetrics returns the series matching the labels of any of the alerts,
+// or the entire dataset if no series matches. The second value reports
+// whether a match was found.
+func selectMetrics(logger log.Logger, metrics promModel.Matrix, alerts []Alert, ignore []string) (promModel.Matrix, bool) {
+	var selected promModel.Matrix
+	for _, metric := range metrics {
+		for _, alert := range alerts {
+			if matchSeries(metric.Metric, seriesSelector(alert, ignore)) {
+				level.Debug(logger).Log("msg", "Best match founded", "metric", metric.Metric)
+				selected = append(selected, metric)
+				break
+			}
+		}
+	}
+
+	if len(selected) == 0 {
+		level.Debug(logger).Log("msg", "Best match not founded, use entire dataset", "alerts", len(alerts))
+		return metrics, false
+	}
+	return selected, true
+}
+
+// seriesKey identifies a set of selected series in the image cache.
+func seriesKey(metrics promModel.Matrix, matched bool) string {
+	if !matched {
+		return "*"
+	}
+	fps := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		fps = append(fps, m.Metric.Fingerprint().String())
+	}
+	sort.Strings(fps)
+	return strings.Join(fps, ",")
+}
+
+// limitSeries keeps the top-k (or bottom-k) series by their peak value and
+// aggregates the remaining ones into a single "others" series. Others is nil
+// if no series was dropped or aggregation is disabled.
+func limitSeries(metrics promModel.Matrix, conf *config.PlotConfig, direction string) (promModel.Matrix, *promModel.SampleStream) {
+	if conf.MaxSeries <= 0 || len(metrics) <= conf.MaxSeries {
+		return metrics, nil
+	}
+
+	bottom := conf.SeriesOrder == "bottom" || (conf.SeriesOrder == "auto" && direction == "<")
+	peak := func(ss *promModel.SampleStream) float64 {
+		p := math.Inf(-1)
+		if bottom {
+			p = math.Inf(1)
+		}
+		for _, v := range ss.Values {
+			f := float64(v.Value)
+			if math.IsNaN(f) {
+				continue
+			}
+			if (bottom && f < p) || (!bottom && f > p) {
+				p = f
+			}
+		}
+		return p
+	}
+
+	// 排序前计算好每个序列的峰值，避免每次比较都遍历序列
+	type peakSeries struct {
+		ss   *promModel.SampleStream
+		peak float64
+	}
+	peaks := make([]peakSeries, len(metrics))
+	for i, ss := range metrics {
+		peaks[i] = peakSeries{ss: ss, peak: peak(ss)}
+	}
+	sort.SliceStable(peaks, func(i, j int) bool {
+		if bottom {
+			return peaks[i].peak < peaks[j].peak
+		}
+		return peaks[i].peak > peaks[j].peak
+	})
+	sorted := make(promModel.Matrix, len(peaks))
+	for i, p := range peaks {
+		sorted[i] = p.ss
+	}
+
+	kept, rest := sorted[:conf.MaxSeries], sorted[conf.MaxSeries:]
+	if conf.Others == "none" {
+		return kept, nil
+	}
+	return kept, aggregateSeries(rest, conf.Others)
+}
+
+// aggregateSeries merges the series by timestamp using sum, avg or max.
+func aggregateSeries(metrics promModel.Matrix, op string) *promModel.SampleStream {
+	type agg struct {
+		value float64
+		count int
+	}
+	byTime := map[promModel.Time]*agg{}
+	for _, ss := range metrics {
+		for _, v := range ss.Values {
+			f := float64(v.Value)
+			if math.IsNaN(f) {
+				continue
+			}
+			a, ok := byTime[v.Timestamp]
+			if !ok {
+				byTime[v.Timestamp] = &agg{value: f, count: 1}
+				continue
+			}
+			switch op {
+			case "max":
+				a.value = math.Max(a.value, f)
+			default:
+				a.value += f
+			}
+			a.count++
+		}
+	}
+
+	others := &promModel.SampleStream{Metric: promModel.Metric{}}
+	for ts, a := range byTime {
+		v := a.value
+		if op == "avg" {
+			v /= float64(a.count)
+		}
+		others.Values = append(others.Values, promModel.SamplePair{Timestamp: ts, Value: promModel.SampleValue(v)})
+	}
+	sort.Slice(others.Values, func(i, j int) bool {
+		return others.Values[i].Timestamp < others.Values[j].Timestamp
+	})
+	return others
+}
+
+// legendNames returns a legend entry per series showing only the labels whose
+// values differ between the series.
+func legendNames(metrics promModel.Matrix) []string {
+	values := map[promModel.LabelName]map[promModel.LabelValue]struct{}{}
+	for _, ss := range metrics {
+		for name, value := range ss.Metric {
+			if values[name] == nil {
+				values[name] = map[promModel.LabelValue]struct{}{}
+			}
+			values[name][value] = struct{}{}
+		}
+	}
+
+	var differ []string
+	for name, vs := range values {
+		// 某个序列没有该标签时也算作不同
+		if len(vs) > 1 || len(vs) == 1 && countWithLabel(metrics, name) < len(metrics) {
+			differ = append(differ, string(name))
+		}
+	}
+	sort.Strings(differ)
+
+	names := make([]string, 0, len(metrics))
+	for _, ss := range metrics {
+		pairs := make([]string, 0, len(differ))
+		for _, name := range differ {
+			if v, ok := ss.Metric[promModel.LabelName(name)]; ok {
+				pairs = append(pairs, fmt.Sprintf("%s=%s", name, v))
+			}
+		}
+		names = append(names, strings.Join(pairs, ", "))
+	}
+	return names
+}
+
+func countWithLabel(metrics promModel.Matrix, name promModel.LabelName) int {
+	n := 0
+	for _, ss := range metrics {
+		if _, ok := ss.Metric[name]; ok {
+			n++
+		}
+	}
+	return n
+}
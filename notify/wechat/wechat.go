@@ -8,6 +8,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cnych/promoter/config"
@@ -21,10 +23,13 @@ import (
 )
 
 type Notifier struct {
-	tmpl          *template.Template
-	conf          *config.WechatConfig
-	client        *http.Client
-	logger        log.Logger
+	tmpl   *template.Template
+	conf   *config.WechatConfig
+	client *http.Client
+	logger log.Logger
+
+	// mtx 保护缓存的 AccessToken，通知和就绪检查会并发使用
+	mtx           sync.Mutex
 	accessToken   string
 	accessTokenAt time.Time
 }
@@ -42,45 +47,13 @@ func New(c *config.WechatConfig, t *template.Template, l log.Logger, httpOpts ..
 	return &Notifier{conf: c, tmpl: t, logger: l, client: client}, nil
 }
 
-func (n *Notifier) Notify(ctx context.Context, data *notify.Data) (bool, error) {
+// message renders the WeChat message for the data.
+func (n *Notifier) message(data *notify.Data) (*weChatMessage, error) {
 	var err error
 	tmpl := notify.TmplText(n.tmpl, data, &err)
-	if err != nil {
-		return false, err
-	}
-
-	// 超过2小时刷新 AccessToken
-	if n.accessToken == "" || time.Since(n.accessTokenAt) > 2*time.Hour {
-		parameters := url.Values{}
-		parameters.Add("corpsecret", string(n.conf.APISecret))
-		parameters.Add("corpid", string(n.conf.CorpID))
-
-		u := n.conf.APIURL.Copy()
-		u.Path += "gettoken"
-		u.RawQuery = parameters.Encode()
-
-		resp, err := util.Get(ctx, n.client, u.String())
-		if err != nil {
-			return true, util.RedactURL(err)
-		}
-		defer util.Drain(resp)
-
-		var wechatToken token
-		if err := json.NewDecoder(resp.Body).Decode(&wechatToken); err != nil {
-			return false, err
-		}
-
-		if wechatToken.AccessToken == "" {
-			return false, fmt.Errorf("invalid APISecret for CorpID: %s", n.conf.CorpID)
-		}
-
-		// 缓存 token
-		n.accessToken = wechatToken.AccessToken
-		n.accessTokenAt = time.Now()
-	}
 
 	msg := &weChatMessage{
-		ToUser:  tmpl(n.conf.ToUser),
+		ToUser:  toUser(tmpl(n.conf.ToUser), data.Mentions().WechatUserIDs()),
 		ToParty: tmpl(n.conf.ToParty),
 		Totag:   tmpl(n.conf.ToTag),
 		AgentID: tmpl(n.conf.AgentID),
@@ -105,12 +78,58 @@ func (n *Notifier) Notify(ctx context.Context, data *notify.Data) (bool, error)
 				Desc:     tmpl(n.conf.TemplateCard.Description),
 				ImageURL: tmpl(n.conf.TemplateCard.ImageURL),
 			},
+			JumpList: jumpList(data.Actions),
 		}
 	} else {
 		msg.Text = weChatMessageContent{
 			Content: tmpl(n.conf.Message),
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Render implements the notify.Renderer interface.
+func (n *Notifier) Render(data *notify.Data) (map[string]string, error) {
+	msg, err := n.message(data)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{
+		"message_type": msg.Type,
+		"to_user":      msg.ToUser,
+		"to_party":     msg.ToParty,
+		"to_tag":       msg.Totag,
+		"agent_id":     msg.AgentID,
+	}
+	switch msg.Type {
+	case "markdown":
+		fields["message"] = msg.Markdown.Content
+	case "template_card":
+		fields["title"] = msg.TemplateCard.MainTitle.Title
+		fields["desc"] = msg.TemplateCard.MainTitle.Desc
+		fields["image_url"] = msg.TemplateCard.ImageTextArea.ImageURL
+		for _, j := range msg.TemplateCard.JumpList {
+			fields["jump_list"] += j.Title + ": " + j.URL + "\n"
+		}
+	default:
+		fields["message"] = msg.Text.Content
+	}
+	return fields, nil
+}
+
+func (n *Notifier) Notify(ctx context.Context, data *notify.Data) (bool, error) {
+	msg, err := n.message(data)
+	if err != nil {
+		return false, err
+	}
+
+	accessToken, retry, err := n.refreshToken(ctx)
+	if err != nil {
+		return retry, err
+	}
 
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
@@ -120,7 +139,7 @@ func (n *Notifier) Notify(ctx context.Context, data *notify.Data) (bool, error)
 	postMessageURL := n.conf.APIURL.Copy()
 	postMessageURL.Path += "message/send"
 	q := postMessageURL.Query()
-	q.Set("access_token", n.accessToken)
+	q.Set("access_token", accessToken)
 	postMessageURL.RawQuery = q.Encode()
 
 	resp, err := util.PostJSON(ctx, n.client, postMessageURL.String(), &buf)
@@ -151,13 +170,62 @@ func (n *Notifier) Notify(ctx context.Context, data *notify.Data) (bool, error)
 
 	// AccessToken is expired
 	if weResp.Code == 42001 {
-		n.accessToken = ""
+		n.mtx.Lock()
+		if n.accessToken == accessToken {
+			n.accessToken = ""
+		}
+		n.mtx.Unlock()
 		return true, errors.New(weResp.Error)
 	}
 
 	return false, errors.New(weResp.Error)
 }
 
+// refreshToken 获取 AccessToken，超过2小时重新获取
+func (n *Notifier) refreshToken(ctx context.Context) (string, bool, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if n.accessToken != "" && time.Since(n.accessTokenAt) <= 2*time.Hour {
+		return n.accessToken, false, nil
+	}
+
+	parameters := url.Values{}
+	parameters.Add("corpsecret", string(n.conf.APISecret))
+	parameters.Add("corpid", string(n.conf.CorpID))
+
+	u := n.conf.APIURL.Copy()
+	u.Path += "gettoken"
+	u.RawQuery = parameters.Encode()
+
+	resp, err := util.Get(ctx, n.client, u.String())
+	if err != nil {
+		return "", true, util.RedactURL(err)
+	}
+	defer util.Drain(resp)
+
+	var wechatToken token
+	if err := json.NewDecoder(resp.Body).Decode(&wechatToken); err != nil {
+		return "", false, err
+	}
+
+	if wechatToken.AccessToken == "" {
+		return "", false, fmt.Errorf("invalid APISecret for CorpID: %s", n.conf.CorpID)
+	}
+
+	// 缓存 token
+	n.accessToken = wechatToken.AccessToken
+	n.accessTokenAt = time.Now()
+	return n.accessToken, false, nil
+}
+
+// CheckToken verifies that an AccessToken can be acquired, the cached token
+// of the notifier is reused until it expires.
+func (n *Notifier) CheckToken(ctx context.Context) error {
+	_, _, err := n.refreshToken(ctx)
+	return err
+}
+
 type weChatMessage struct {
 	Text         weChatMessageContent      `json:"text,omitempty"`
 	ToUser       string                    `json:"touser,omitempty"`
@@ -182,6 +250,13 @@ type weChatMessageTemplateCard struct {
 	CardType      string                         `json:"card_type"`
 	MainTitle     weChatMessageTemplateMainTitle `json:"main_title"`
 	ImageTextArea wechatMessageTemplateImage     `json:"image_text_area"`
+	JumpList      []weChatMessageTemplateJump    `json:"jump_list,omitempty"`
+}
+
+type weChatMessageTemplateJump struct {
+	Type  int    `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
 }
 
 type weChatMessageTemplateMainTitle struct {
@@ -201,3 +276,42 @@ type weChatResponse struct {
 	Code  int    `json:"code"`
 	Error string `json:"error"`
 }
+
+// jumpList returns the links of the card to acknowledge and silence the
+// alerts. Button interactions would require a callback URL registered in the
+// WeCom application, the links work without it.
+func jumpList(actions *notify.ActionLinks) []weChatMessageTemplateJump {
+	if actions == nil {
+		return nil
+	}
+	list := []weChatMessageTemplateJump{{Type: 1, Title: "确认报警", URL: actions.AckURL}}
+	if actions.SilenceURL != "" {
+		list = append(list, weChatMessageTemplateJump{Type: 1, Title: "静默报警", URL: actions.SilenceURL})
+	}
+	return list
+}
+
+// toUser adds the mentioned users to the rendered to_user, unless the message
+// is already sent to everyone.
+func toUser(rendered string, mentioned []string) string {
+	if rendered == "@all" || len(mentioned) == 0 {
+		return rendered
+	}
+	var users []string
+	if rendered != "" {
+		users = strings.Split(rendered, "|")
+	}
+	for _, m := range mentioned {
+		found := false
+		for _, u := range users {
+			if u == m {
+				found = true
+				break
+			}
+		}
+		if !found {
+			users = append(users, m)
+		}
+	}
+	return strings.Join(users, "|")
+}
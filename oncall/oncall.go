@@ -0,0 +1,84 @@
+package oncall
+
+import (
+	"time"
+
+	"github.com/cnych/promoter/config"
+)
+
+// Shift is a period during which a user is on call for a rotation.
+type Shift struct {
+	Rotation string    `json:"rotation"`
+	User     string    `json:"user"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	// Override reports that the shift comes from an override.
+	Override bool `json:"override,omitempty"`
+}
+
+// Current returns the shift of the rotation covering t, taking overrides of
+// the schedule into account. It returns false before the rotation starts.
+func Current(s *config.ScheduleConfig, r *config.RotationConfig, t time.Time) (Shift, bool) {
+	for _, o := range s.Overrides {
+		if o.Rotation == r.Name && !t.Before(o.StartTime()) && t.Before(o.EndTime()) {
+			return Shift{Rotation: r.Name, User: o.User, Start: o.StartTime(), End: o.EndTime(), Override: true}, true
+		}
+	}
+
+	k, ok := shiftIndex(r, t)
+	if !ok {
+		return Shift{}, false
+	}
+	return regularShift(r, k), true
+}
+
+// Next returns the regular shift following the one covering t, ignoring
+// overrides.
+func Next(r *config.RotationConfig, t time.Time) Shift {
+	k, ok := shiftIndex(r, t)
+	if !ok {
+		return regularShift(r, 0)
+	}
+	return regularShift(r, k+1)
+}
+
+// OnCall returns the current shift of every rotation of the schedule.
+func OnCall(s *config.ScheduleConfig, t time.Time) []Shift {
+	var shifts []Shift
+	for _, r := range s.Rotations {
+		if shift, ok := Current(s, r, t); ok {
+			shifts = append(shifts, shift)
+		}
+	}
+	return shifts
+}
+
+// shiftIndex returns the number of shifts of the rotation begun before the
+// one covering t.
+func shiftIndex(r *config.RotationConfig, t time.Time) (int, bool) {
+	start := r.StartTime()
+	if t.Before(start) {
+		return 0, false
+	}
+	days := r.ShiftDays()
+	// 先按固定时长估算，再按日历修正，使夏令时切换时交接仍发生在本地时间的交接时刻
+	k := int(t.Sub(start) / (time.Duration(days) * 24 * time.Hour))
+	for k > 0 && start.AddDate(0, 0, k*days).After(t) {
+		k--
+	}
+	for !start.AddDate(0, 0, (k+1)*days).After(t) {
+		k++
+	}
+	return k, true
+}
+
+func regularShift(r *config.RotationConfig, k int) Shift {
+	days := r.ShiftDays()
+	start := r.StartTime()
+	return Shift{
+		Rotation: r.Name,
+		User:     r.Members[k%len(r.Members)],
+		Start:    start.AddDate(0, 0, k*days),
+		End:      start.AddDate(0, 0, (k+1)*days),
+	}
+}
@@ -0,0 +1,177 @@
+package oncall
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"gopkg.in/yaml.v2"
+)
+
+// testSchedule switches to daylight saving time on 2026-03-08 and back on
+// 2026-11-01.
+const testSchedule = `
+name: payments-oncall
+timezone: America/New_York
+rotations:
+  - name: primary
+    type: daily
+    start: "2026-03-06"
+    handover: "09:00"
+    members: [alice, bob, carol]
+  - name: secondary
+    type: weekly
+    length: 2
+    start: "2026-10-26"
+    handover: "10:00"
+    members: [dave, erin]
+overrides:
+  - user: dave
+    start: "2026-03-10 12:00"
+    end: "2026-03-10 18:00"
+`
+
+func loadTestSchedule(t *testing.T) *config.ScheduleConfig {
+	t.Helper()
+
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skipf("timezone database not available: %v", err)
+	}
+	var s config.ScheduleConfig
+	if err := yaml.UnmarshalStrict([]byte(testSchedule), &s); err != nil {
+		t.Fatal(err)
+	}
+	return &s
+}
+
+func TestCurrent(t *testing.T) {
+	s := loadTestSchedule(t)
+	loc := s.Location()
+	at := func(value string) time.Time {
+		ts, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	for _, tc := range []struct {
+		name     string
+		rotation int
+		t        time.Time
+		ok       bool
+		expected Shift
+	}{
+		{
+			name:     "before the rotation starts",
+			rotation: 0,
+			t:        at("2026-03-06 08:59"),
+		},
+		{
+			name:     "first shift",
+			rotation: 0,
+			t:        at("2026-03-06 09:00"),
+			ok:       true,
+			expected: Shift{Rotation: "primary", User: "alice", Start: at("2026-03-06 09:00"), End: at("2026-03-07 09:00")},
+		},
+		{
+			// 切换到夏令时的这一班只有 23 小时，交接仍然在本地时间 09:00
+			name:     "shift shortened by the daylight saving time switch",
+			rotation: 0,
+			t:        at("2026-03-08 08:30"),
+			ok:       true,
+			expected: Shift{Rotation: "primary", User: "bob", Start: at("2026-03-07 09:00"), End: at("2026-03-08 09:00")},
+		},
+		{
+			name:     "handover after the daylight saving time switch",
+			rotation: 0,
+			t:        at("2026-03-08 09:00"),
+			ok:       true,
+			expected: Shift{Rotation: "primary", User: "carol", Start: at("2026-03-08 09:00"), End: at("2026-03-09 09:00")},
+		},
+		{
+			name:     "members repeat",
+			rotation: 0,
+			t:        at("2026-03-09 23:00"),
+			ok:       true,
+			expected: Shift{Rotation: "primary", User: "alice", Start: at("2026-03-09 09:00"), End: at("2026-03-10 09:00")},
+		},
+		{
+			name:     "override",
+			rotation: 0,
+			t:        at("2026-03-10 12:00"),
+			ok:       true,
+			expected: Shift{Rotation: "primary", User: "dave", Start: at("2026-03-10 12:00"), End: at("2026-03-10 18:00"), Override: true},
+		},
+		{
+			name:     "after the override",
+			rotation: 0,
+			t:        at("2026-03-10 18:00"),
+			ok:       true,
+			expected: Shift{Rotation: "primary", User: "bob", Start: at("2026-03-10 09:00"), End: at("2026-03-11 09:00")},
+		},
+		{
+			// 切换回标准时间的这一班多出 1 小时
+			name:     "shift lengthened by the standard time switch",
+			rotation: 1,
+			t:        at("2026-11-09 09:30"),
+			ok:       true,
+			expected: Shift{Rotation: "secondary", User: "dave", Start: at("2026-10-26 10:00"), End: at("2026-11-09 10:00")},
+		},
+		{
+			name:     "handover after the standard time switch",
+			rotation: 1,
+			t:        at("2026-11-09 10:00"),
+			ok:       true,
+			expected: Shift{Rotation: "secondary", User: "erin", Start: at("2026-11-09 10:00"), End: at("2026-11-23 10:00")},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			shift, ok := Current(s, s.Rotations[tc.rotation], tc.t)
+			if ok != tc.ok {
+				t.Fatalf("expected ok %v, got %v", tc.ok, ok)
+			}
+			if !shift.Start.Equal(tc.expected.Start) || !shift.End.Equal(tc.expected.End) {
+				t.Fatalf("expected shift %s - %s, got %s - %s", tc.expected.Start, tc.expected.End, shift.Start, shift.End)
+			}
+			shift.Start, shift.End = tc.expected.Start, tc.expected.End
+			if shift != tc.expected {
+				t.Fatalf("expected shift %+v, got %+v", tc.expected, shift)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	s := loadTestSchedule(t)
+	r := s.Rotations[0]
+
+	// 覆盖不影响下一班
+	next := Next(r, time.Date(2026, 3, 10, 14, 0, 0, 0, s.Location()))
+	if next.User != "carol" || next.Override {
+		t.Fatalf("expected the next regular shift of carol, got %+v", next)
+	}
+	if expected := time.Date(2026, 3, 11, 9, 0, 0, 0, s.Location()); !next.Start.Equal(expected) {
+		t.Fatalf("expected the next shift to start at %s, got %s", expected, next.Start)
+	}
+
+	// 开始之前下一班是第一班
+	next = Next(r, time.Date(2026, 3, 1, 0, 0, 0, 0, s.Location()))
+	if next.User != "alice" || !next.Start.Equal(r.StartTime()) {
+		t.Fatalf("expected the first shift of alice, got %+v", next)
+	}
+}
+
+func TestOnCall(t *testing.T) {
+	s := loadTestSchedule(t)
+
+	shifts := OnCall(s, time.Date(2026, 3, 10, 14, 0, 0, 0, s.Location()))
+	if len(shifts) != 1 || shifts[0].User != "dave" || !shifts[0].Override {
+		t.Fatalf("expected the override of dave only, got %+v", shifts)
+	}
+
+	shifts = OnCall(s, time.Date(2026, 11, 2, 12, 0, 0, 0, s.Location()))
+	if len(shifts) != 2 || shifts[0].User != "bob" || shifts[1].User != "dave" {
+		t.Fatalf("expected bob and dave on call, got %+v", shifts)
+	}
+}
@@ -0,0 +1,346 @@
+package silence
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/labels"
+	"github.com/cnych/promoter/notify"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+const (
+	silencesFile = "silences.json"
+	// gcInterval is how often expired silences beyond the retention are
+	// deleted.
+	gcInterval = 15 * time.Minute
+	// expiredRetention is how long expired silences are kept.
+	expiredRetention = 120 * time.Hour
+)
+
+// Statuses of a silence.
+const (
+	StatusPending = "pending"
+	StatusActive  = "active"
+	StatusExpired = "expired"
+)
+
+var (
+	// ErrNotFound is returned when a silence does not exist.
+	ErrNotFound = errors.New("silence not found")
+	// ErrExpired is returned when updating or expiring an expired silence.
+	ErrExpired = errors.New("silence already expired")
+)
+
+// Silence mutes the alerts matching all its matchers between its start and
+// end, whatever their receiver.
+type Silence struct {
+	ID        string          `json:"id"`
+	Matchers  labels.Matchers `json:"matchers"`
+	StartsAt  time.Time       `json:"startsAt"`
+	EndsAt    time.Time       `json:"endsAt"`
+	CreatedBy string          `json:"createdBy"`
+	Comment   string          `json:"comment"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	// Status is computed when the silence is returned, it is not stored.
+	Status string `json:"status,omitempty"`
+}
+
+func (s *Silence) status(now time.Time) string {
+	switch {
+	case !now.Before(s.EndsAt):
+		return StatusExpired
+	case now.Before(s.StartsAt):
+		return StatusPending
+	}
+	return StatusActive
+}
+
+// Validate checks the silence can be stored.
+func (s *Silence) Validate() error {
+	if len(s.Matchers) == 0 {
+		return fmt.Errorf("at least one matcher is required")
+	}
+	// 和 Alertmanager 一样，静默对所有接收器生效，所有匹配器都匹配空字符串时会
+	// 静默所有报警
+	allEmpty := true
+	for _, m := range s.Matchers {
+		if !m.Matches(map[string]string{}) {
+			allEmpty = false
+			break
+		}
+	}
+	if allEmpty {
+		return fmt.Errorf("at least one matcher must not match the empty string")
+	}
+	if s.CreatedBy == "" {
+		return fmt.Errorf("missing createdBy")
+	}
+	if s.EndsAt.IsZero() {
+		return fmt.Errorf("missing endsAt")
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return fmt.Errorf("endsAt must be after startsAt")
+	}
+	return nil
+}
+
+// Silences stores the silences in a JSON file and mutes the alerts matching
+// them or the maintenance windows of their receiver.
+type Silences struct {
+	path   string
+	logger log.Logger
+
+	mtx      sync.RWMutex
+	conf     *config.Config
+	silences map[string]*Silence
+}
+
+// Open loads the silences stored in the directory.
+func Open(dir string, logger log.Logger) (*Silences, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Silences{
+		path:     filepath.Join(dir, silencesFile),
+		logger:   logger,
+		silences: map[string]*Silence{},
+	}
+
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var silences []*Silence
+	if err := json.Unmarshal(b, &silences); err != nil {
+		return nil, fmt.Errorf("load silences: %v", err)
+	}
+	for _, sil := range silences {
+		s.silences[sil.ID] = sil
+	}
+	return s, nil
+}
+
+// Update sets the configuration holding the maintenance windows.
+func (s *Silences) Update(conf *config.Config) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.conf = conf
+}
+
+// Set creates the silence, or updates it if it has an ID, and returns its
+// ID. A silence starts now if it has no start time.
+func (s *Silences) Set(sil *Silence) (string, error) {
+	now := time.Now()
+	if sil.StartsAt.IsZero() {
+		sil.StartsAt = now
+	}
+	if err := sil.Validate(); err != nil {
+		return "", err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	stored := *sil
+	stored.Status = ""
+	stored.UpdatedAt = now
+	if stored.ID != "" {
+		prev, ok := s.silences[stored.ID]
+		if !ok {
+			return "", ErrNotFound
+		}
+		if prev.status(now) == StatusExpired {
+			return "", ErrExpired
+		}
+	} else {
+		id, err := newID()
+		if err != nil {
+			return "", err
+		}
+		stored.ID = id
+	}
+
+	prev := s.silences[stored.ID]
+	s.silences[stored.ID] = &stored
+	if err := s.persist(); err != nil {
+		if prev != nil {
+			s.silences[stored.ID] = prev
+		} else {
+			delete(s.silences, stored.ID)
+		}
+		return "", err
+	}
+	return stored.ID, nil
+}
+
+// Get returns the silence with the given ID.
+func (s *Silences) Get(id string) (*Silence, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	sil, ok := s.silences[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return withStatus(sil, time.Now()), nil
+}
+
+// List returns the silences, active ones first and then by end time.
+func (s *Silences) List() []*Silence {
+	s.mtx.RLock()
+	now := time.Now()
+	silences := make([]*Silence, 0, len(s.silences))
+	for _, sil := range s.silences {
+		silences = append(silences, withStatus(sil, now))
+	}
+	s.mtx.RUnlock()
+
+	order := map[string]int{StatusActive: 0, StatusPending: 1, StatusExpired: 2}
+	sort.Slice(silences, func(i, j int) bool {
+		if silences[i].Status != silences[j].Status {
+			return order[silences[i].Status] < order[silences[j].Status]
+		}
+		return silences[i].EndsAt.Before(silences[j].EndsAt)
+	})
+	return silences
+}
+
+// Expire ends the silence now, it is kept until the retention elapses.
+func (s *Silences) Expire(id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	prev, ok := s.silences[id]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	if prev.status(now) == StatusExpired {
+		return ErrExpired
+	}
+
+	expired := *prev
+	expired.EndsAt = now
+	if expired.StartsAt.After(now) {
+		expired.StartsAt = now
+	}
+	expired.UpdatedAt = now
+	s.silences[id] = &expired
+	if err := s.persist(); err != nil {
+		s.silences[id] = prev
+		return err
+	}
+	return nil
+}
+
+// Mutes reports whether the alert of the receiver matches an active silence
+// or a maintenance window of the receiver.
+func (s *Silences) Mutes(receiver string, a notify.Alert, now time.Time) bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	for _, sil := range s.silences {
+		if sil.status(now) == StatusActive && sil.Matchers.Matches(a.Labels) {
+			return true
+		}
+	}
+	if s.conf == nil {
+		return false
+	}
+	if rcv := s.conf.GetReceiver(receiver); rcv != nil {
+		for _, w := range rcv.MaintenanceWindows {
+			if w.Mutes(a.Labels, now) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Run deletes the silences expired for longer than the retention
+// periodically until stop is closed.
+func (s *Silences) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.gc(time.Now()); err != nil {
+			level.Error(s.logger).Log("msg", "Silence maintenance failed", "err", err)
+		} else if n > 0 {
+			level.Debug(s.logger).Log("msg", "Deleted expired silences", "count", n)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *Silences) gc(now time.Time) (int, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	n := 0
+	for id, sil := range s.silences {
+		if now.Sub(sil.EndsAt) > expiredRetention {
+			delete(s.silences, id)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.persist()
+}
+
+// persist writes all silences to a temporary file and renames it, so that
+// the file is never partially written. It must be called with the lock held.
+func (s *Silences) persist() error {
+	silences := make([]*Silence, 0, len(s.silences))
+	for _, sil := range s.silences {
+		silences = append(silences, sil)
+	}
+	sort.Slice(silences, func(i, j int) bool { return silences[i].ID < silences[j].ID })
+
+	b, err := json.MarshalIndent(silences, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func withStatus(sil *Silence, now time.Time) *Silence {
+	out := *sil
+	out.Status = sil.status(now)
+	return &out
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,265 @@
+package silence
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/labels"
+	"github.com/cnych/promoter/notify"
+	"github.com/go-kit/log"
+)
+
+func mustMatchers(t *testing.T, ss ...string) labels.Matchers {
+	t.Helper()
+
+	var ms labels.Matchers
+	for _, s := range ss {
+		m, err := labels.ParseMatcher(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+func openTestSilences(t *testing.T, dir string) *Silences {
+	t.Helper()
+
+	s, err := Open(dir, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name     string
+		matchers []string
+		modify   func(s *Silence)
+		err      bool
+	}{
+		{
+			name:     "valid",
+			matchers: []string{`alertname="HighLatency"`},
+		},
+		{
+			name:     "empty matcher with a non-empty one",
+			matchers: []string{`alertname="HighLatency"`, `team=~".*"`},
+		},
+		{
+			name: "no matchers",
+			err:  true,
+		},
+		{
+			name:     "all matchers match the empty string",
+			matchers: []string{`team=~".*"`, `instance=""`, `job!="node"`},
+			err:      true,
+		},
+		{
+			name:     "missing createdBy",
+			matchers: []string{`alertname="HighLatency"`},
+			modify:   func(s *Silence) { s.CreatedBy = "" },
+			err:      true,
+		},
+		{
+			name:     "missing endsAt",
+			matchers: []string{`alertname="HighLatency"`},
+			modify:   func(s *Silence) { s.EndsAt = time.Time{} },
+			err:      true,
+		},
+		{
+			name:     "endsAt before startsAt",
+			matchers: []string{`alertname="HighLatency"`},
+			modify:   func(s *Silence) { s.EndsAt = s.StartsAt.Add(-time.Hour) },
+			err:      true,
+		},
+		{
+			name:     "endsAt equal to startsAt",
+			matchers: []string{`alertname="HighLatency"`},
+			modify:   func(s *Silence) { s.EndsAt = s.StartsAt },
+			err:      true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sil := Silence{
+				Matchers:  mustMatchers(t, tc.matchers...),
+				StartsAt:  now,
+				EndsAt:    now.Add(time.Hour),
+				CreatedBy: "alice",
+			}
+			if tc.modify != nil {
+				tc.modify(&sil)
+			}
+
+			err := sil.Validate()
+			if tc.err && err == nil {
+				t.Fatal("expected an error")
+			}
+			if !tc.err && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSilencesPersistence(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSilences(t, dir)
+	now := time.Now()
+
+	active, err := s.Set(&Silence{
+		Matchers:  mustMatchers(t, `alertname="HighLatency"`),
+		EndsAt:    now.Add(time.Hour),
+		CreatedBy: "alice",
+		Comment:   "deploying",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := s.Set(&Silence{
+		Matchers:  mustMatchers(t, `instance=~"web-.*"`),
+		EndsAt:    now.Add(time.Hour),
+		CreatedBy: "bob",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Expire(expired); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后读取到相同的静默规则
+	reopened := openTestSilences(t, dir)
+	want, err := json.Marshal(s.List())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(reopened.List())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("expected %s after reopening, got %s", want, got)
+	}
+
+	list := reopened.List()
+	if len(list) != 2 || list[0].ID != active || list[0].Status != StatusActive || list[1].ID != expired || list[1].Status != StatusExpired {
+		t.Fatalf("unexpected silences %+v", list)
+	}
+
+	if err := reopened.Expire(expired); err != ErrExpired {
+		t.Fatalf("expected ErrExpired expiring an expired silence, got %v", err)
+	}
+	if _, err := reopened.Set(&Silence{
+		ID:        expired,
+		Matchers:  mustMatchers(t, `instance=~"web-.*"`),
+		EndsAt:    now.Add(time.Hour),
+		CreatedBy: "bob",
+	}); err != ErrExpired {
+		t.Fatalf("expected ErrExpired updating an expired silence, got %v", err)
+	}
+	if _, err := reopened.Set(&Silence{
+		ID:        "missing",
+		Matchers:  mustMatchers(t, `instance=~"web-.*"`),
+		EndsAt:    now.Add(time.Hour),
+		CreatedBy: "bob",
+	}); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound updating a missing silence, got %v", err)
+	}
+	if _, err := reopened.Get("missing"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSilencesGC(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestSilences(t, dir)
+	now := time.Now()
+
+	for _, endsAt := range []time.Time{
+		now.Add(-expiredRetention - time.Minute),
+		now.Add(-expiredRetention + time.Minute),
+		now.Add(time.Hour),
+	} {
+		if _, err := s.Set(&Silence{
+			Matchers:  mustMatchers(t, `alertname="HighLatency"`),
+			StartsAt:  endsAt.Add(-time.Hour),
+			EndsAt:    endsAt,
+			CreatedBy: "alice",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := s.gc(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 deleted silence, got %d", n)
+	}
+	if reopened := openTestSilences(t, dir); len(reopened.List()) != 2 {
+		t.Fatalf("expected 2 silences after reopening, got %d", len(reopened.List()))
+	}
+}
+
+func TestSilencesMutes(t *testing.T) {
+	s := openTestSilences(t, t.TempDir())
+	now := time.Now()
+
+	for _, sil := range []*Silence{
+		{Matchers: mustMatchers(t, `alertname="Active"`), StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)},
+		{Matchers: mustMatchers(t, `alertname="Pending"`), StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour)},
+		{Matchers: mustMatchers(t, `alertname="Expired"`), StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)},
+	} {
+		sil.CreatedBy = "alice"
+		if _, err := s.Set(sil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conf, err := config.Load(`
+global:
+  dingtalk_api_url: http://dingtalk.example.com/robot/send
+  dingtalk_api_token: token
+  dingtalk_api_secret: secret
+receivers:
+  - name: ops
+    maintenance_windows:
+      - schedule: "0 0 * * *"
+        duration: 24h
+        matchers: ['alertname="Maintenance"']
+    dingtalk_configs:
+      - message_type: markdown
+  - name: dev
+    dingtalk_configs:
+      - message_type: markdown
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Update(conf)
+
+	for _, tc := range []struct {
+		receiver, alertname string
+		muted               bool
+	}{
+		{receiver: "ops", alertname: "Active", muted: true},
+		{receiver: "dev", alertname: "Active", muted: true},
+		{receiver: "ops", alertname: "Pending"},
+		{receiver: "ops", alertname: "Expired"},
+		{receiver: "ops", alertname: "Maintenance", muted: true},
+		{receiver: "dev", alertname: "Maintenance"},
+		{receiver: "unknown", alertname: "Maintenance"},
+	} {
+		a := notify.Alert{Labels: notify.KV{"alertname": tc.alertname}}
+		if muted := s.Mutes(tc.receiver, a, now); muted != tc.muted {
+			t.Errorf("%s of %s: expected muted %v, got %v", tc.alertname, tc.receiver, tc.muted, muted)
+		}
+	}
+}
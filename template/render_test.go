@@ -0,0 +1,118 @@
+package template_test
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cnych/promoter/config"
+	"github.com/cnych/promoter/notify"
+	"github.com/cnych/promoter/notify/receivers"
+	"github.com/cnych/promoter/template"
+	"github.com/go-kit/log"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the rendered notifications")
+
+// TestRenderGolden renders the default templates of every notifier with the
+// notifications in testdata and compares the fields with the golden files.
+// Run go test -update after changing default.tmpl and review the diff.
+func TestRenderGolden(t *testing.T) {
+	conf, err := config.LoadFile("testdata/config.yml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := template.FromGlobs(conf.Templates...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"firing", "resolved", "images"} {
+		t.Run(name, func(t *testing.T) {
+			b, err := ioutil.ReadFile(filepath.Join("testdata", name+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := &notify.Data{}
+			if err := json.Unmarshal(b, data); err != nil {
+				t.Fatal(err)
+			}
+
+			results, err := receivers.Render(conf, tmpl, log.NewNopLogger(), receivers.RenderRequest{Receiver: "ops", Data: data})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("rendered %s differs from %s:\n%s", name, golden, got)
+			}
+		})
+	}
+}
+
+// TestRenderBuildError checks that a notifier which cannot be built is
+// reported in its own result without failing the others.
+func TestRenderBuildError(t *testing.T) {
+	conf, err := config.Load(`
+global:
+  dingtalk_api_url: http://dingtalk.example.com/robot/send
+  dingtalk_api_token: token
+  dingtalk_api_secret: secret
+receivers:
+  - name: ops
+    dingtalk_configs:
+      - message_type: markdown
+      - message_type: markdown
+        http_config:
+          tls_config:
+            ca_file: testdata/missing-ca.pem
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := template.FromGlobs(conf.Templates...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := receivers.Render(conf, tmpl, log.NewNopLogger(), receivers.RenderRequest{Receiver: "ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+	if ok := results[0]; ok.Integration != "dingtalk[0]" || ok.Error != "" || ok.Fields["text"] == "" {
+		t.Fatalf("expected dingtalk[0] to be rendered, got %+v", ok)
+	}
+	if failed := results[1]; failed.Integration != "dingtalk[1]" || !strings.Contains(failed.Error, "missing-ca.pem") || failed.Fields != nil {
+		t.Fatalf("expected the error of dingtalk[1], got %+v", failed)
+	}
+
+	// 只渲染无法创建的通知配置
+	results, err = receivers.Render(conf, tmpl, log.NewNopLogger(), receivers.RenderRequest{Receiver: "ops", Integration: "dingtalk[1]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Integration != "dingtalk[1]" || results[0].Error == "" {
+		t.Fatalf("expected only the error of dingtalk[1], got %+v", results)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	tmpltext "text/template"
 )
@@ -43,6 +45,9 @@ type Template struct {
 	html *tmplhtml.Template
 
 	ExternalURL *url.URL
+	// AlertmanagerURL is the URL of the Alertmanager web UI used by the
+	// alertmanagerURL and silenceURL functions, it may be nil.
+	AlertmanagerURL *url.URL
 }
 
 func FromGlobs(paths ...string) (*Template, error) {
@@ -51,8 +56,8 @@ func FromGlobs(paths ...string) (*Template, error) {
 		html: tmplhtml.New("").Option("missingkey=zero"),
 	}
 
-	t.text = t.text.Funcs(tmpltext.FuncMap(DefaultFuncs))
-	t.html = t.html.Funcs(tmplhtml.FuncMap(DefaultFuncs))
+	t.text = t.text.Funcs(tmpltext.FuncMap(DefaultFuncs)).Funcs(tmpltext.FuncMap(t.alertmanagerFuncs()))
+	t.html = t.html.Funcs(tmplhtml.FuncMap(DefaultFuncs)).Funcs(tmplhtml.FuncMap(t.alertmanagerFuncs()))
 
 	defaultTemplates := []string{"default.tmpl"}
 
@@ -94,6 +99,43 @@ func FromGlobs(paths ...string) (*Template, error) {
 	return t, nil
 }
 
+// alertmanagerFuncs link to the Alertmanager web UI, they render empty
+// strings if no Alertmanager is configured.
+func (t *Template) alertmanagerFuncs() FuncMap {
+	return FuncMap{
+		"alertmanagerURL": func() string {
+			if t.AlertmanagerURL == nil {
+				return ""
+			}
+			return strings.TrimRight(t.AlertmanagerURL.String(), "/")
+		},
+		// silenceURL links to the new silence form filled with equality
+		// matchers of the labels, e.g. {{ silenceURL .CommonLabels }}.
+		"silenceURL": func(labels map[string]string) string {
+			if t.AlertmanagerURL == nil {
+				return ""
+			}
+			return strings.TrimRight(t.AlertmanagerURL.String(), "/") + "/#/silences/new?filter=" + strings.ReplaceAll(url.QueryEscape(labelsFilter(labels)), "+", "%20")
+		},
+	}
+}
+
+// labelsFilter formats the labels as an Alertmanager filter such as
+// {alertname="Foo",instance="bar"}.
+func labelsFilter(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	matchers := make([]string, 0, len(names))
+	for _, name := range names {
+		matchers = append(matchers, name+"="+strconv.Quote(labels[name]))
+	}
+	return "{" + strings.Join(matchers, ",") + "}"
+}
+
 // ExecuteTextString needs a meaningful doc comment (TODO(fabxc)).
 func (t *Template) ExecuteTextString(text string, data interface{}) (string, error) {
 	if text == "" {
@@ -0,0 +1,15 @@
+//go:build !builtinassets
+// +build !builtinassets
+
+package ui
+
+import (
+	"net/http"
+
+	"github.com/shurcooL/httpfs/union"
+)
+
+// Assets contains the static files of the web UI.
+var Assets = union.New(map[string]http.FileSystem{
+	"/static": http.Dir("../ui/static"),
+})
@@ -0,0 +1,26 @@
+//go:build builtinassets
+// +build builtinassets
+
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/shurcooL/httpfs/union"
+)
+
+//go:embed static
+var assets embed.FS
+
+// Assets contains the static files of the web UI.
+var Assets = func() http.FileSystem {
+	static, err := fs.Sub(assets, "static")
+	if err != nil {
+		panic(err)
+	}
+	return union.New(map[string]http.FileSystem{
+		"/static": http.FS(static),
+	})
+}()
@@ -0,0 +1,262 @@
+(function () {
+  'use strict';
+
+  var API = 'api/v1';
+
+  function $(sel, root) {
+    return (root || document).querySelector(sel);
+  }
+
+  function escapeHTML(s) {
+    return String(s === undefined || s === null ? '' : s).replace(/[&<>"']/g, function (c) {
+      return {'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'}[c];
+    });
+  }
+
+  function showError(err) {
+    var el = $('#error');
+    el.textContent = err ? String(err.message || err) : '';
+    el.hidden = !err;
+  }
+
+  // request calls the API and returns the data of a successful response.
+  function request(method, path, body) {
+    var opts = {method: method, headers: {}};
+    if (body !== undefined) {
+      opts.headers['Content-Type'] = 'application/json';
+      opts.body = JSON.stringify(body);
+    }
+    return fetch(API + path, opts).then(function (resp) {
+      return resp.json().then(function (json) {
+        if (json.status !== 'success') {
+          throw new Error(json.error || resp.statusText);
+        }
+        return json.data;
+      });
+    });
+  }
+
+  function formatTime(s) {
+    var t = new Date(s);
+    return isNaN(t) ? s : t.toLocaleString();
+  }
+
+  function labels(kv) {
+    return Object.keys(kv || {}).sort().map(function (k) {
+      return '<span class="label">' + escapeHTML(k) + '="' + escapeHTML(kv[k]) + '"</span>';
+    }).join('');
+  }
+
+  function thumbnails(images) {
+    return (images || []).map(function (img) {
+      return '<a href="' + escapeHTML(img.url) + '" target="_blank"><img src="' + escapeHTML(img.url) +
+        '" title="' + escapeHTML(img.title) + '" alt="' + escapeHTML(img.title) + '"></a>';
+    }).join('');
+  }
+
+  function deliveryBadge(d) {
+    if (d.skipped) {
+      return '<span class="badge skipped">' + escapeHTML(d.integration) + ' skipped</span>';
+    }
+    if (d.error) {
+      return '<span class="badge failed" title="' + escapeHTML(d.error) + '">' + escapeHTML(d.integration) + ' failed</span>';
+    }
+    return '<span class="badge success">' + escapeHTML(d.integration) + '</span>';
+  }
+
+  var config = null;
+
+  function loadConfig() {
+    return request('GET', '/status').then(function (status) {
+      config = status;
+      var names = (status.configJSON.receivers || []).map(function (r) { return r.name; });
+      [$('#history-form [name=receiver]'), $('#playground-form [name=receiver]')].forEach(function (sel) {
+        var first = sel.options.length && sel.options[0].value === '' ? sel.options[0].outerHTML : '';
+        sel.innerHTML = first + names.map(function (n) {
+          return '<option>' + escapeHTML(n) + '</option>';
+        }).join('');
+      });
+      return status;
+    });
+  }
+
+  // 接收器
+  function notifiers(rcv) {
+    var out = [];
+    [['wechat', rcv.wechat_configs], ['dingtalk', rcv.dingtalk_configs]].forEach(function (p) {
+      (p[1] || []).forEach(function (c, i) {
+        out.push({name: p[0] + '[' + i + ']', conf: c});
+      });
+    });
+    return out;
+  }
+
+  function renderReceivers() {
+    var list = $('#receivers-list');
+    var receivers = config.configJSON.receivers || [];
+    if (!receivers.length) {
+      list.innerHTML = '<p>没有配置接收器</p>';
+      return;
+    }
+    list.innerHTML = receivers.map(function (rcv) {
+      var rows = notifiers(rcv).map(function (n) {
+        var c = n.conf;
+        return '<tr><td>' + escapeHTML(n.name) + '</td><td>' + escapeHTML(c.message_type || '') + '</td><td>' +
+          (c.send_resolved ? '是' : '否') + '</td><td>' + labels(c.matchers) + '</td></tr>';
+      }).join('');
+      return '<div class="card"><h3>' + escapeHTML(rcv.name) + '</h3>' +
+        '<p class="meta">图片：' + escapeHTML(rcv.image_provider || 'prometheus') +
+        (rcv.escalation_policy ? '，升级策略：' + escapeHTML(rcv.escalation_policy) : '') + '</p>' +
+        '<table><thead><tr><th>通知配置</th><th>消息类型</th><th>发送恢复通知</th><th>匹配</th></tr></thead><tbody>' +
+        rows + '</tbody></table>' +
+        '<p><button data-test="' + escapeHTML(rcv.name) + '">发送测试通知</button> <span class="test-result"></span></p></div>';
+    }).join('');
+  }
+
+  $('#receivers-list').addEventListener('click', function (e) {
+    var name = e.target.getAttribute('data-test');
+    if (!name) {
+      return;
+    }
+    var out = $('.test-result', e.target.parentNode);
+    out.textContent = '发送中...';
+    request('POST', '/receivers/' + encodeURIComponent(name) + '/test', {}).then(function (results) {
+      out.innerHTML = results.map(function (r) {
+        return deliveryBadge(r) + ' ';
+      }).join('');
+    }).catch(function (err) {
+      out.textContent = err.message;
+    });
+  });
+
+  // 报警历史
+  function loadHistory() {
+    var form = $('#history-form');
+    var params = new URLSearchParams();
+    ['receiver', 'status', 'limit'].forEach(function (k) {
+      if (form[k].value) {
+        params.append(k, form[k].value);
+      }
+    });
+    // 多个匹配器以逗号分隔，引号中的逗号不分隔
+    (form.filter.value.match(/([^,"]|"(\\.|[^"\\])*")+/g) || []).forEach(function (f) {
+      if (f.trim()) {
+        params.append('filter', f.trim());
+      }
+    });
+
+    return request('GET', '/alerts?' + params.toString()).then(function (alerts) {
+      $('#history-list').innerHTML = alerts.length ? alerts.map(function (a) {
+        return '<tr><td><a class="link" data-notification="' + escapeHTML(a.notificationID) + '">' +
+          escapeHTML(formatTime(a.receivedAt)) + '</a></td><td>' + escapeHTML(a.receiver) + '</td>' +
+          '<td><span class="badge ' + escapeHTML(a.status) + '">' + escapeHTML(a.status) + '</span></td>' +
+          '<td>' + labels(a.labels) + (a.annotations && a.annotations.summary ? '<br>' + escapeHTML(a.annotations.summary) : '') + '</td>' +
+          '<td>' + (a.deliveries || []).map(deliveryBadge).join('') + '</td>' +
+          '<td class="thumbnails">' + thumbnails(a.Images) + '</td></tr>';
+      }).join('') : '<tr><td colspan="6">没有报警记录</td></tr>';
+    });
+  }
+
+  $('#history-form').addEventListener('submit', function (e) {
+    e.preventDefault();
+    $('#notification').hidden = true;
+    loadHistory().then(function () { showError(null); }).catch(showError);
+  });
+
+  $('#history-list').addEventListener('click', function (e) {
+    var id = e.target.getAttribute('data-notification');
+    if (!id) {
+      return;
+    }
+    request('GET', '/notifications/' + encodeURIComponent(id)).then(function (n) {
+      $('#notification-id').textContent = '#' + n.id + ' ' + n.receiver + ' ' + formatTime(n.receivedAt);
+      var images = (n.data.images || []).slice();
+      (n.data.alerts || []).forEach(function (a) {
+        images = images.concat(a.Images || []);
+      });
+      $('#notification-images').innerHTML = thumbnails(images);
+      $('#notification-deliveries').innerHTML = (n.deliveries || []).map(function (d) {
+        var body = d.error ? '<div class="error">' + escapeHTML(d.error) + '</div>' : '';
+        Object.keys(d.fields || {}).sort().forEach(function (k) {
+          body += '<h4>' + escapeHTML(k) + '</h4><pre>' + escapeHTML(d.fields[k]) + '</pre>';
+        });
+        return '<div class="card"><h3>' + deliveryBadge(d) + '</h3>' + body + '</div>';
+      }).join('');
+      $('#notification').hidden = false;
+      $('#notification').scrollIntoView();
+      showError(null);
+    }).catch(showError);
+  });
+
+  // 模板调试
+  $('#playground-form').addEventListener('submit', function (e) {
+    e.preventDefault();
+    var form = e.target;
+    var req = {};
+    if (form.mode.value === 'template') {
+      req.template = form.template.value;
+    } else {
+      req.receiver = form.receiver.value;
+      req.integration = form.integration.value;
+    }
+    if (form.data.value.trim()) {
+      try {
+        req.data = JSON.parse(form.data.value);
+      } catch (err) {
+        showError(new Error('数据不是合法的 JSON：' + err.message));
+        return;
+      }
+    }
+    request('POST', '/templates/render', req).then(function (results) {
+      $('#playground-result').innerHTML = results.map(function (r) {
+        var body = r.error ? '<div class="error">' + escapeHTML(r.error) + '</div>' : '';
+        if (r.fields) {
+          Object.keys(r.fields).sort().forEach(function (k) {
+            body += '<h4>' + escapeHTML(k) + '</h4><pre>' + escapeHTML(r.fields[k]) + '</pre>';
+          });
+        } else if (!r.error) {
+          body += '<pre>' + escapeHTML(r.output) + '</pre>';
+        }
+        return '<div class="card">' + (r.integration ? '<h3>' + escapeHTML(r.integration) + '</h3>' : '') + body + '</div>';
+      }).join('');
+      showError(null);
+    }).catch(showError);
+  });
+
+  // 状态
+  function renderStatus() {
+    var v = config.versionInfo;
+    var rows = [['启动时间', formatTime(config.uptime)]].concat(Object.keys(v).map(function (k) {
+      return [k, v[k]];
+    }));
+    $('#status-info').innerHTML = rows.map(function (r) {
+      return '<tr><th>' + escapeHTML(r[0]) + '</th><td>' + escapeHTML(r[1]) + '</td></tr>';
+    }).join('');
+    $('#status-config').textContent = config.configYAML;
+  }
+
+  var pages = {
+    receivers: function () { return loadConfig().then(renderReceivers); },
+    history: function () { return (config ? Promise.resolve() : loadConfig()).then(loadHistory); },
+    playground: function () { return config ? Promise.resolve() : loadConfig(); },
+    status: function () { return loadConfig().then(renderStatus); }
+  };
+
+  function route() {
+    var page = location.hash.replace(/^#\//, '');
+    if (!pages[page]) {
+      page = 'receivers';
+    }
+    Object.keys(pages).forEach(function (p) {
+      $('#' + p).hidden = p !== page;
+    });
+    document.querySelectorAll('nav a').forEach(function (a) {
+      a.classList.toggle('active', a.getAttribute('data-page') === page);
+    });
+    showError(null);
+    pages[page]().catch(showError);
+  }
+
+  window.addEventListener('hashchange', route);
+  route();
+})();
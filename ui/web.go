@@ -0,0 +1,32 @@
+package ui
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/prometheus/common/route"
+)
+
+// Register registers the handlers serving the web UI. The pages only use the
+// /api/v1 endpoints.
+func Register(r *route.Router) {
+	fs := http.FileServer(Assets)
+
+	r.Get("/", func(w http.ResponseWriter, req *http.Request) {
+		disableCaching(w)
+		req.URL.Path = "/static/"
+		fs.ServeHTTP(w, req)
+	})
+
+	r.Get("/static/*filepath", func(w http.ResponseWriter, req *http.Request) {
+		disableCaching(w)
+		req.URL.Path = path.Join("/static", route.Param(req.Context(), "filepath"))
+		fs.ServeHTTP(w, req)
+	})
+}
+
+func disableCaching(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Pragma", "no-cache") // HTTP 1.0.
+	w.Header().Set("Expires", "0")       // Proxies.
+}
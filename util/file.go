@@ -2,6 +2,7 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -17,21 +18,15 @@ import (
 	"github.com/globalsign/mgo/bson"
 )
 
-func UploadFile(accessKey, secretKey, endpoint, bucket, region string, plot io.WriterTo) (string, error) {
-	s := session.Must(session.NewSessionWithOptions(session.Options{
-		Config: aws.Config{
-
-			Endpoint:    aws.String(endpoint),
-			Region:      aws.String(region),
-			DisableSSL:  aws.Bool(true),
-			Credentials: credentials.NewStaticCredentials(accessKey, secretKey, ""),
-		},
-	}))
-	if _, err := s.Config.Credentials.Get(); err != nil {
+// UploadFile uploads the plot to the bucket as a public-read object with the
+// given file extension (png, svg) and returns its public URL.
+func UploadFile(accessKey, secretKey, endpoint, bucket, region, ext string, plot io.WriterTo) (string, error) {
+	s, err := newSession(accessKey, secretKey, endpoint, region)
+	if err != nil {
 		return "", err
 	}
 
-	f, err := ioutil.TempFile("", "promoter-*.png")
+	f, err := ioutil.TempFile("", "promoter-*."+ext)
 	if err != nil {
 		return "", fmt.Errorf("failed to create tmp file: %v", err)
 	}
@@ -59,7 +54,12 @@ func UploadFile(accessKey, secretKey, endpoint, bucket, region string, plot io.W
 	_, err = f.Read(buffer)
 
 	// create a unique file name for the file
-	tempFileName := "pictures/" + bson.NewObjectId().Hex() + "_" + strconv.FormatInt(time.Now().Unix(), 10) + ".png"
+	tempFileName := "pictures/" + bson.NewObjectId().Hex() + "_" + strconv.FormatInt(time.Now().Unix(), 10) + "." + ext
+
+	contentType := http.DetectContentType(buffer)
+	if ext == "svg" {
+		contentType = "image/svg+xml"
+	}
 
 	_, err = s3.New(s).PutObject(&s3.PutObjectInput{
 		Bucket:        aws.String(bucket),
@@ -67,7 +67,7 @@ func UploadFile(accessKey, secretKey, endpoint, bucket, region string, plot io.W
 		ACL:           aws.String("public-read"),
 		Body:          bytes.NewReader(buffer),
 		ContentLength: aws.Int64(size),
-		ContentType:   aws.String(http.DetectContentType(buffer)),
+		ContentType:   aws.String(contentType),
 	})
 	if err != nil {
 		return "", err
@@ -76,3 +76,32 @@ func UploadFile(accessKey, secretKey, endpoint, bucket, region string, plot io.W
 	//return fmt.Sprintf("https://%s.s3-%s.amazonaws.com/%s", bucket, region, tempFileName), err
 	return fmt.Sprintf("http://%s.%s/%s", bucket, endpoint, tempFileName), err
 }
+
+// CheckBucket verifies that the bucket exists and is accessible with the
+// credentials.
+func CheckBucket(ctx context.Context, accessKey, secretKey, endpoint, bucket, region string) error {
+	s, err := newSession(accessKey, secretKey, endpoint, region)
+	if err != nil {
+		return err
+	}
+	_, err = s3.New(s).HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	return err
+}
+
+func newSession(accessKey, secretKey, endpoint, region string) (*session.Session, error) {
+	s := session.Must(session.NewSessionWithOptions(session.Options{
+		Config: aws.Config{
+
+			Endpoint:    aws.String(endpoint),
+			Region:      aws.String(region),
+			DisableSSL:  aws.Bool(true),
+			Credentials: credentials.NewStaticCredentials(accessKey, secretKey, ""),
+		},
+	}))
+	if _, err := s.Config.Credentials.Get(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}